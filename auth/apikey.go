@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	API_KEY_PREFIX = "nk_"
+	API_KEY_SCHEME = "ApiKey"
+)
+
+/**
+	Api key is "<prefix>.<secret>". Prefix is public, it is stored as
+	is to find the key and shown in listing. Only the hash of the whole
+	key is stored, see HashToken
+*/
+func GenerateApiKey() (string, string, error) {
+	prefix := make([]byte, 6)
+	if _, err := rand.Read(prefix); err != nil {
+		return "", "", err
+	}
+	secret, err := GenerateRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+	prefixString := API_KEY_PREFIX + hex.EncodeToString(prefix)
+	return prefixString, prefixString + "." + secret, nil
+}
+
+// Empty when the key is not in "<prefix>.<secret>" form
+func ApiKeyPrefix(key string) string {
+	prefixSecret := strings.SplitN(key, ".", 2)
+	if len(prefixSecret) != 2 || !strings.HasPrefix(prefixSecret[0], API_KEY_PREFIX) || len(prefixSecret[1]) == 0 {
+		return ""
+	}
+	return prefixSecret[0]
+}
+
+// Empty when the header is not in "ApiKey <key>" form, same as ParseBearer
+func ParseApiKey(header string) string {
+	splitHeader := strings.Split(header, " ")
+	if len(splitHeader) != 2 || splitHeader[0] != API_KEY_SCHEME {
+		return ""
+	}
+	return splitHeader[1]
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"testing"
+)
+
+func TestApiKey(t *testing.T) {
+	prefix, key, err := GenerateApiKey()
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if result := ApiKeyPrefix(key); result != prefix {
+		t.Fatalf("want %v get %v", prefix, result)
+	}
+	if result := ParseApiKey("ApiKey " + key); result != key {
+		t.Fatalf("want %v get %v", key, result)
+	}
+	for _, header := range []string{key, "Bearer " + key, "ApiKey a b", ""} {
+		if result := ParseApiKey(header); result != "" {
+			t.Fatalf("want empty get %v", result)
+		}
+	}
+	for _, invalid := range []string{prefix, prefix + ".", "other_abc.secret"} {
+		if result := ApiKeyPrefix(invalid); result != "" {
+			t.Fatalf("want empty get %v", result)
+		}
+	}
+}
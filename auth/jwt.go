@@ -29,11 +29,17 @@ func CreateToken(mapClaims jwt.MapClaims, secret []byte) (string, error) {
 }
 
 func KeyFunction(token *jwt.Token) (interface{}, error) {
-	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-		return nil, errors.New("asdlkj")
-	}
+	return SecretKeyFunction(GetAuthSecret())(token)
+}
 
-	return GetAuthSecret(), nil
+// Key function for a token signed with the given secret instead of the default one
+func SecretKeyFunction(secret []byte) func(token *jwt.Token) (interface{}, error) {
+	return func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("asdlkj")
+		}
+		return secret, nil
+	}
 }
 
 func CheckTokenExpiry(expiry interface{}) bool {
@@ -83,7 +89,11 @@ func BearerToken(jwtToken []byte) string {
 	return "Bearer " + string(jwtToken)
 }
 
+// Empty when the token is not in "Bearer <token>" form
 func ParseBearer(receivedToken string) string {
 	splitToken := strings.Split(receivedToken, " ")
+	if len(splitToken) != 2 || splitToken[0] != "Bearer" {
+		return ""
+	}
 	return splitToken[1]
 }
\ No newline at end of file
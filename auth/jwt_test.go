@@ -64,4 +64,14 @@ func TestCheckTokenExpiry(t *testing.T) {
 	if ok := CheckTokenExpiry(header["exp"]); ok {
 		t.Fatalf("Should fail")
 	}
-}
\ No newline at end of file
+}
+func TestParseBearer(t *testing.T) {
+	if result := ParseBearer("Bearer abc"); result != "abc" {
+		t.Fatalf("want abc get %v", result)
+	}
+	for _, token := range []string{"abc", "Basic abc", "Bearer a b", ""} {
+		if result := ParseBearer(token); result != "" {
+			t.Fatalf("want empty get %v", result)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	ALGORITHM_HS256 = "HS256"
+	ALGORITHM_RS256 = "RS256"
+	ALGORITHM_EDDSA = "EdDSA"
+)
+
+var (
+	ErrUnknownKeyId = errors.New("UNKNOWN KEY ID")
+	ErrUnsupportedKey = errors.New("UNSUPPORTED KEY")
+)
+
+/**
+	Key sign or verify a token. Private is nil for a key that is only
+	kept to verify token signed before a rotation. For HS256 both
+	Private and Public hold the secret
+*/
+type Key struct {
+	Id string
+	Method jwt.SigningMethod
+	Private interface{}
+	Public interface{}
+}
+
+func SecretKey(id string, secret []byte) Key {
+	return Key{Id: id, Method: jwt.SigningMethodHS256, Private: secret, Public: secret}
+}
+
+/**
+	HS256 secret that can only verify. Kept after switching to an
+	asymmetric key so token signed before the switch stay valid
+*/
+func VerifySecretKey(id string, secret []byte) Key {
+	return Key{Id: id, Method: jwt.SigningMethodHS256, Public: secret}
+}
+
+/**
+	Parse a PEM encoded key. Private key can be PKCS#8 RSA or Ed25519, or
+	PKCS#1 RSA. Public key is PKIX and can only verify
+*/
+func ParseKey(id string, pemBytes []byte) (Key, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return Key{}, fmt.Errorf("%w %v is not PEM", ErrUnsupportedKey, id)
+	}
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return Key{}, fmt.Errorf("%w %v %v", ErrUnsupportedKey, id, block.Type)
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return Key{Id: id, Method: jwt.SigningMethodRS256, Private: k, Public: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return Key{Id: id, Method: jwt.SigningMethodRS256, Public: k}, nil
+	case ed25519.PrivateKey:
+		return Key{Id: id, Method: SigningMethodEd25519, Private: k, Public: k.Public()}, nil
+	case ed25519.PublicKey:
+		return Key{Id: id, Method: SigningMethodEd25519, Public: k}, nil
+	default:
+		return Key{}, fmt.Errorf("%w %v %T", ErrUnsupportedKey, id, parsed)
+	}
+}
+
+func LoadKey(id, path string) (Key, error) {
+	pemBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+	return ParseKey(id, pemBytes)
+}
+
+/**
+	KeySet sign with one key and verify with every key in it, so
+	token signed by the previous key stay valid during a rotation.
+	The key is picked by the kid header, never by the alg header alone
+*/
+type KeySet struct {
+	signing Key
+	keys map[string]Key
+	// kid in the order they are added, JWKS keep the same order
+	order []string
+}
+
+func NewKeySet(signing Key, verifying ...Key) (*KeySet, error) {
+	if signing.Private == nil {
+		return nil, fmt.Errorf("%w %v cannot sign", ErrUnsupportedKey, signing.Id)
+	}
+	ks := &KeySet{
+		signing: signing,
+		keys: make(map[string]Key),
+	}
+	for _, key := range append([]Key{signing}, verifying...) {
+		if _, exist := ks.keys[key.Id]; exist {
+			return nil, fmt.Errorf("duplicate key id %v", key.Id)
+		}
+		ks.keys[key.Id] = key
+		ks.order = append(ks.order, key.Id)
+	}
+	return ks, nil
+}
+
+// HS256 key set with the shared secret, what every token used before kid
+func NewSecretKeySet(secret []byte) *KeySet {
+	ks, _ := NewKeySet(SecretKey("", secret))
+	return ks
+}
+
+func (ks *KeySet) CreateToken(mapClaims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, mapClaims)
+	if len(ks.signing.Id) != 0 {
+		token.Header["kid"] = ks.signing.Id
+	}
+	return token.SignedString(ks.signing.Private)
+}
+
+func (ks *KeySet) KeyFunction(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w %v", ErrUnknownKeyId, kid)
+	}
+	// reject e.g RS256 public key used as HS256 secret
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("%w %v for key %v", ErrUnsupportedKey, token.Method.Alg(), kid)
+	}
+	return key.Public, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Public part of every asymmetric key, HS256 secret is never published
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, kid := range ks.order {
+		key := ks.keys[kid]
+		jwk := JWK{Kid: kid, Use: "sig", Alg: key.Method.Alg()}
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = encodeBase64URL(public.N.Bytes())
+			jwk.E = encodeBase64URL(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = encodeBase64URL(public)
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
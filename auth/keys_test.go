@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func pemKey(t *testing.T, blockType string, key interface{}) []byte {
+	var der []byte
+	var err error
+	if blockType == "PUBLIC KEY" {
+		der, err = x509.MarshalPKIXPublicKey(key)
+	} else {
+		der, err = x509.MarshalPKCS8PrivateKey(key)
+	}
+	if err != nil {
+		t.Fatalf("Cannot marshal key %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"exp": time.Now().Add(time.Minute).Unix(),
+		"access_token": "123",
+	}
+}
+
+func TestKeySetSignAndVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	for _, private := range []interface{}{rsaKey, edKey} {
+		key, err := ParseKey("key-1", pemKey(t, "PRIVATE KEY", private))
+		if err != nil {
+			t.Fatalf("want nil get %v", err)
+		}
+		ks, err := NewKeySet(key)
+		if err != nil {
+			t.Fatalf("want nil get %v", err)
+		}
+		token, err := ks.CreateToken(testClaims())
+		if err != nil {
+			t.Fatalf("want nil get %v", err)
+		}
+		if accessToken, ok := VerifyToken(BearerToken([]byte(token)), ks.KeyFunction); !ok || accessToken != "123" {
+			t.Fatalf("%v want 123 get %v", key.Method.Alg(), accessToken)
+		}
+		parsed, _ := jwt.Parse(token, ks.KeyFunction)
+		if parsed.Header["kid"] != "key-1" {
+			t.Fatalf("want key-1 get %v", parsed.Header["kid"])
+		}
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	_, oldPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	newPublic, newPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	oldKey, _ := ParseKey("old", pemKey(t, "PRIVATE KEY", oldPrivate))
+	newKey, _ := ParseKey("new", pemKey(t, "PRIVATE KEY", newPrivate))
+
+	before, _ := NewKeySet(oldKey)
+	oldToken, _ := before.CreateToken(testClaims())
+
+	// only the public part of the old key is kept
+	oldPublic, err := ParseKey("old", pemKey(t, "PUBLIC KEY", oldPrivate.Public()))
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if _, err := NewKeySet(oldPublic); !errors.Is(err, ErrUnsupportedKey) {
+		t.Fatalf("public key should not sign get %v", err)
+	}
+	after, err := NewKeySet(newKey, oldPublic)
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if _, ok := VerifyToken(BearerToken([]byte(oldToken)), after.KeyFunction); !ok {
+		t.Fatalf("token of the previous key should stay valid")
+	}
+	newToken, _ := after.CreateToken(testClaims())
+	if _, ok := VerifyToken(BearerToken([]byte(newToken)), before.KeyFunction); ok {
+		t.Fatalf("unknown kid should be rejected")
+	}
+
+	// HS256 token signed with a published key as secret
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = "new"
+	forgedToken, _ := forged.SignedString([]byte(newPublic))
+	if _, ok := VerifyToken(BearerToken([]byte(forgedToken)), after.KeyFunction); ok {
+		t.Fatalf("alg of the key should be enforced")
+	}
+
+	jwks := after.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != "new" || jwks.Keys[1].Kid != "old" {
+		t.Fatalf("want new and old get %v", jwks)
+	}
+	if jwks.Keys[0].Kty != "OKP" || jwks.Keys[0].Alg != ALGORITHM_EDDSA || len(jwks.Keys[0].X) == 0 {
+		t.Fatalf("want Ed25519 JWK get %v", jwks.Keys[0])
+	}
+	if len(NewSecretKeySet([]byte(TEST_SECRET)).JWKS().Keys) != 0 {
+		t.Fatalf("secret should never be published")
+	}
+}
+
+func TestKeySetSecretRollover(t *testing.T) {
+	secretToken, _ := NewSecretKeySet([]byte(TEST_SECRET)).CreateToken(testClaims())
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+	key, _ := ParseKey("new", pemKey(t, "PRIVATE KEY", private))
+
+	if _, err := NewKeySet(VerifySecretKey("", []byte(TEST_SECRET))); !errors.Is(err, ErrUnsupportedKey) {
+		t.Fatalf("verify only secret should not sign get %v", err)
+	}
+	after, err := NewKeySet(key, VerifySecretKey("", []byte(TEST_SECRET)))
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if _, ok := VerifyToken(BearerToken([]byte(secretToken)), after.KeyFunction); !ok {
+		t.Fatalf("token signed with the secret should stay valid")
+	}
+	if token, _ := after.CreateToken(testClaims()); token == secretToken {
+		t.Fatalf("new token should be signed with the key")
+	}
+	if jwks := after.JWKS(); len(jwks.Keys) != 1 || jwks.Keys[0].Kid != "new" {
+		t.Fatalf("want only the new key get %v", jwks)
+	}
+
+	retired, _ := NewKeySet(key)
+	if _, ok := VerifyToken(BearerToken([]byte(secretToken)), retired.KeyFunction); ok {
+		t.Fatalf("retired secret should be rejected")
+	}
+}
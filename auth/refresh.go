@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+/**
+	Refresh token is an opaque random string, not a JWT, so it can
+	only be checked against the database and revoked at any time
+*/
+func GenerateRefreshToken() (string, error) {
+	return randomToken()
+}
+
+/**
+	Unsubscribe token is embedded in every message of a subscription so
+	it is kept as is, anyone holding it can only remove that subscription
+*/
+func GenerateUnsubscribeToken() (string, error) {
+	return randomToken()
+}
+
+func randomToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+/**
+	Only the hash is stored. The token already has enough entropy so a
+	plain SHA-256 is enough and, unlike bcrypt, can be looked up directly
+*/
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
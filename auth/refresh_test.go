@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"testing"
+)
+
+func TestRefreshToken(t *testing.T) {
+	first, err := GenerateRefreshToken()
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	second, _ := GenerateRefreshToken()
+	if first == second {
+		t.Fatalf("refresh token should be random")
+	}
+	if HashToken(first) != HashToken(first) || HashToken(first) == HashToken(second) {
+		t.Fatalf("hash should only match the same token")
+	}
+	if len(HashToken(first)) != 64 {
+		t.Fatalf("want 64 get %v", len(HashToken(first)))
+	}
+}
@@ -0,0 +1,219 @@
+package broker
+
+import (
+	"errors"
+	"sync"
+)
+
+/**
+	Policy decide what happen when a subscriber buffer is full
+	and a new message is published to its topic
+*/
+type Policy int
+
+const (
+	// Drop the oldest buffered message to make room for the new one
+	DropOldest Policy = iota
+	// Wait until the subscriber has room, publisher is slowed down
+	Block
+	// Close the subscription, subscriber need to subscribe again
+	Disconnect
+)
+
+const (
+	DEFAULT_BUFFER_SIZE = 64
+)
+
+var (
+	ErrSlowConsumer = errors.New("SUBSCRIBER DISCONNECTED FOR BEING TOO SLOW")
+	ErrUnsubscribed = errors.New("SUBSCRIBER UNSUBSCRIBED")
+)
+
+type Message struct {
+	Topic string
+	Payload interface{}
+}
+
+type Subscription struct {
+	topic string
+	policy Policy
+	messages chan Message
+	done chan struct{}
+
+	mu sync.Mutex
+	closed bool
+	closeOnce sync.Once
+	err error
+	dropped int
+}
+
+// Channel that receive every message published to the topic.
+// It is closed when the subscription end
+func (s *Subscription) Messages() <-chan Message {
+	return s.messages
+}
+
+func (s *Subscription) Topic() string {
+	return s.topic
+}
+
+// Reason the subscription closed, nil while still open
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Count message discarded by DropOldest policy
+func (s *Subscription) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+func (s *Subscription) close(reason error) {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.closeLocked(reason)
+	})
+}
+
+func (s *Subscription) closeLocked(reason error) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = reason
+	close(s.messages)
+}
+
+/**
+	Deliver a message following subscription policy. Return false
+	when the subscription should be removed from the broker
+*/
+func (s *Subscription) deliver(message Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.messages <- message:
+		return true
+	default:
+	}
+	switch s.policy {
+	case Block:
+		select {
+		case s.messages <- message:
+			return true
+		case <-s.done:
+			return false
+		}
+	case Disconnect:
+		s.closeLocked(ErrSlowConsumer)
+		return false
+	default:
+		for {
+			select {
+			case s.messages <- message:
+				return true
+			default:
+			}
+			select {
+			case <-s.messages:
+				s.dropped++
+			default:
+			}
+		}
+	}
+}
+
+/**
+	Broker is an in-process fan-out point. Every publisher write to a topic
+	and every live transport (WebSocket, SSE, webhook) subscribe to it
+*/
+type Broker struct {
+	mu sync.RWMutex
+	topics map[string]map[*Subscription]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		topics: make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+func (b *Broker) Subscribe(topic string, bufferSize int, policy Policy) *Subscription {
+	if bufferSize <= 0 {
+		bufferSize = DEFAULT_BUFFER_SIZE
+	}
+	subscription := &Subscription{
+		topic: topic,
+		policy: policy,
+		messages: make(chan Message, bufferSize),
+		done: make(chan struct{}),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.topics[topic]; !ok {
+		b.topics[topic] = make(map[*Subscription]struct{})
+	}
+	b.topics[topic][subscription] = struct{}{}
+	return subscription
+}
+
+func (b *Broker) remove(subscription *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subscribers, ok := b.topics[subscription.topic]
+	if !ok {
+		return
+	}
+	delete(subscribers, subscription)
+	if len(subscribers) == 0 {
+		delete(b.topics, subscription.topic)
+	}
+}
+
+func (b *Broker) Unsubscribe(subscription *Subscription) {
+	b.remove(subscription)
+	subscription.close(ErrUnsubscribed)
+}
+
+// Count subscription currently attached to a topic
+func (b *Broker) SubscriberCount(topic string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.topics[topic])
+}
+
+/**
+	Publish a payload to every subscription of the topic and return how many
+	subscription received it. Subscribers are copied first so a blocking
+	subscriber never hold the broker lock
+*/
+func (b *Broker) Publish(topic string, payload interface{}) int {
+	b.mu.RLock()
+	subscribers := make([]*Subscription, 0, len(b.topics[topic]))
+	for subscription := range b.topics[topic] {
+		subscribers = append(subscribers, subscription)
+	}
+	b.mu.RUnlock()
+
+	message := Message{
+		Topic: topic,
+		Payload: payload,
+	}
+	delivered := 0
+	for _, subscription := range subscribers {
+		if subscription.deliver(message) {
+			delivered++
+			continue
+		}
+		b.remove(subscription)
+	}
+	return delivered
+}
@@ -0,0 +1,132 @@
+package broker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPublishSubscribe(t *testing.T) {
+	b := NewBroker()
+	first := b.Subscribe("user/1", 2, DropOldest)
+	second := b.Subscribe("user/1", 2, DropOldest)
+	other := b.Subscribe("user/2", 2, DropOldest)
+
+	delivered := b.Publish("user/1", "hello")
+	if delivered != 2 {
+		t.Fatalf("want 2 get %v", delivered)
+	}
+	for _, subscription := range []*Subscription{first, second} {
+		message := <-subscription.Messages()
+		if message.Payload.(string) != "hello" {
+			t.Fatalf("want hello get %v", message.Payload)
+		}
+		if message.Topic != "user/1" {
+			t.Fatalf("want user/1 get %v", message.Topic)
+		}
+	}
+	if len(other.Messages()) != 0 {
+		t.Fatalf("other topic should not receive message")
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	b := NewBroker()
+	subscription := b.Subscribe("user/1", 1, DropOldest)
+	b.Unsubscribe(subscription)
+	if _, ok := <-subscription.Messages(); ok {
+		t.Fatalf("channel should be closed")
+	}
+	if subscription.Err() != ErrUnsubscribed {
+		t.Fatalf("want %v get %v", ErrUnsubscribed, subscription.Err())
+	}
+	if count := b.SubscriberCount("user/1"); count != 0 {
+		t.Fatalf("want 0 get %v", count)
+	}
+	if delivered := b.Publish("user/1", "hello"); delivered != 0 {
+		t.Fatalf("want 0 get %v", delivered)
+	}
+	b.Unsubscribe(subscription)
+}
+
+func TestDropOldestPolicy(t *testing.T) {
+	b := NewBroker()
+	subscription := b.Subscribe("user/1", 2, DropOldest)
+	b.Publish("user/1", 1)
+	b.Publish("user/1", 2)
+	b.Publish("user/1", 3)
+	if subscription.Dropped() != 1 {
+		t.Fatalf("want 1 get %v", subscription.Dropped())
+	}
+	first := <-subscription.Messages()
+	second := <-subscription.Messages()
+	if first.Payload.(int) != 2 || second.Payload.(int) != 3 {
+		t.Fatalf("want 2 and 3 get %v and %v", first.Payload, second.Payload)
+	}
+}
+
+func TestDisconnectPolicy(t *testing.T) {
+	b := NewBroker()
+	subscription := b.Subscribe("user/1", 1, Disconnect)
+	b.Publish("user/1", 1)
+	if delivered := b.Publish("user/1", 2); delivered != 0 {
+		t.Fatalf("want 0 get %v", delivered)
+	}
+	if subscription.Err() != ErrSlowConsumer {
+		t.Fatalf("want %v get %v", ErrSlowConsumer, subscription.Err())
+	}
+	if count := b.SubscriberCount("user/1"); count != 0 {
+		t.Fatalf("want 0 get %v", count)
+	}
+	message, ok := <-subscription.Messages()
+	if !ok || message.Payload.(int) != 1 {
+		t.Fatalf("buffered message should still be readable")
+	}
+	if _, ok := <-subscription.Messages(); ok {
+		t.Fatalf("channel should be closed")
+	}
+}
+
+func TestBlockPolicy(t *testing.T) {
+	b := NewBroker()
+	subscription := b.Subscribe("user/1", 1, Block)
+	b.Publish("user/1", 1)
+
+	published := make(chan int)
+	go func() {
+		published <- b.Publish("user/1", 2)
+	}()
+	select {
+	case <-published:
+		t.Fatalf("publish should wait for a slow subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+	<-subscription.Messages()
+	if delivered := <-published; delivered != 1 {
+		t.Fatalf("want 1 get %v", delivered)
+	}
+	message := <-subscription.Messages()
+	if message.Payload.(int) != 2 {
+		t.Fatalf("want 2 get %v", message.Payload)
+	}
+}
+
+func TestUnsubscribeReleaseBlockedPublisher(t *testing.T) {
+	b := NewBroker()
+	subscription := b.Subscribe("user/1", 1, Block)
+	b.Publish("user/1", 1)
+
+	published := make(chan int)
+	go func() {
+		published <- b.Publish("user/1", 2)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	b.Unsubscribe(subscription)
+	select {
+	case delivered := <-published:
+		if delivered != 0 {
+			t.Fatalf("want 0 get %v", delivered)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("unsubscribe should release blocked publisher")
+	}
+}
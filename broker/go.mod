@@ -0,0 +1,3 @@
+module github.com/humamfauzi/go-notification/broker
+
+go 1.15
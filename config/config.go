@@ -4,7 +4,6 @@ import (
 	"io/ioutil"
 	"encoding/json"
 	"strings"
-	"os"
 )
 
 type Config map[string]interface{}
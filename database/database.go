@@ -106,16 +106,28 @@ func ConvertJsonToQueryMap(dir string) error {
 	return nil
 }
 
-func WriteToDB(tx ITransaction, path string, input ...interface{}) (int64, error) {
-	query, err := Query(path, input...)
+/**
+	Fragments fill the %s of the query map template and only contain
+	column name and placeholder generated by the model. Every value
+	coming from outside is passed through args and bound by the driver.
+	Dialect without LastInsertId return 0 unless the query has RETURNING id
+*/
+func WriteToDB(tx ITransaction, path string, fragments []interface{}, args []interface{}) (int64, error) {
+	query, err := Query(path, fragments...)
 	if err != nil {
 		return 0, err
 	}
 	fmt.Println(query)
-	write, err := tx.Exec(query)
+	if strings.HasSuffix(query, RETURNING_ID) {
+		return returningId(tx, query, args)
+	}
+	write, err := tx.Exec(query, args...)
 	if err != nil {
 		return 0, err
 	}
+	if queryMap.Dialect() == DIALECT_POSTGRES {
+		return 0, nil
+	}
 	lastInsertId, err := write.LastInsertId()
 	if err != nil {
 		return 0, err
@@ -124,75 +136,56 @@ func WriteToDB(tx ITransaction, path string, input ...interface{}) (int64, error
 	return lastInsertId, nil
 }
 
-func Query(path string, input ...interface{}) (string, error) {
+// Same as WriteToDB but for update and delete that need to know how many row it touch
+func AffectToDB(tx ITransaction, path string, fragments []interface{}, args []interface{}) (int64, error) {
+	query, err := Query(path, fragments...)
+	if err != nil {
+		return 0, err
+	}
+	write, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return write.RowsAffected()
+}
+
+func Query(path string, fragments ...interface{}) (string, error) {
 	formatQuery, err := queryMap.GetQuery(path)
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf(formatQuery, input...), nil
+	return rebind(queryMap.Dialect(), fmt.Sprintf(formatQuery, fragments...)), nil
 }
-func createAfterWherePair(pairs [][]string) string {
-	if len(pairs) == 0 {
-		return ""
-	}
-	finalQuery := ""
-	for i := 0; i < len(pairs); i++ {
-		for j := 0; j < len(pairs[i]); j++ {
-			finalQuery += fmt.Sprintf(" %s ", pairs[i][j])
-		}
+
+// Placeholder group for a single row or an IN list e.g (?,?,?)
+func placeholderGroup(length int) string {
+	placeholders := make([]string, length)
+	for i := 0; i < length; i++ {
+		placeholders[i] = "?"
 	}
-	return finalQuery
+	return "(" + strings.Join(placeholders, ",") + ")"
 }
 
-func createColumnValuePairing(pairs [][]string) string {
-	if len(pairs) == 0 {
-		return ""
-	}
-	finalQuery := " WHERE "
-	for i := 0; i < len(pairs); i++ {
-		if len(pairs[i]) == 1 {
-			// for an or, and, parentheses
-			finalQuery += fmt.Sprintf(" %s ", pairs[i])
-		} else if len(pairs[i]) == 3 {
-			// for a condilitionals e.g '=', '!=', 'is not null'
-			finalQuery += fmt.Sprintf(" %s %s '%s' ", pairs[i][0], pairs[i][1], pairs[i][2])
-		}
-	}
-	return finalQuery
+var allowedOperator = map[string]bool{
+	"=": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true,
+	"LIKE": true, "NOT LIKE": true,
 }
 
 /**
-	Create an interface after path, currently can be inserted with
-	selectColumn []string, whereColumn [][]string, afterWhere[][]string
-	must be inserted in that order
+	Read using the query builder, model is used to check
+	every column the builder refer to
 */
-func ReadFromDB(tx ITransaction, path string, selectionInterface ...interface{}) (RowsScan, error) {
-	var selectColumn []string
-	var whereColumn, afterWhere [][]string
-	switch len(selectionInterface) {
-	case 1:
-		selectColumn = selectionInterface[0].([]string)
-	case 2:
-		selectColumn = selectionInterface[0].([]string)
-		whereColumn = selectionInterface[1].([][]string)
-	case 3:
-		selectColumn = selectionInterface[0].([]string)
-		whereColumn = selectionInterface[1].([][]string)
-		afterWhere = selectionInterface[2].([][]string)
-	default:
-		return &sql.Rows{}, errors.New("Query Requires Filter")
-
+func ReadFromDB(tx ITransaction, path string, qb *QueryBuilder, model IColumnMatcher) (RowsScan, error) {
+	column, clause, args, err := qb.Build(model)
+	if err != nil {
+		return &sql.Rows{}, err
 	}
-	column := strings.Join(selectColumn, ",")
-	whereQuery := createColumnValuePairing(whereColumn)
-	afterWhereQuery := createAfterWherePair(afterWhere)
-	whereQuery += afterWhereQuery
-	query, err := Query(path, column, whereQuery)
+	query, err := Query(path, column, clause)
 	fmt.Println(query)
 	if err != nil {
 		return &sql.Rows{}, err
 	}
-	rows, err := tx.Query(query)
+	rows, err := tx.Query(query, args...)
 	if err != nil {
 		return &sql.Rows{}, err
 	}
@@ -211,11 +204,18 @@ type RowsScan interface {
 }
 
 // ------- USER MODEL FUNCTION --------- //
+const (
+	USER_ROLE_USER = "user"
+	// Admin can do anything a user can, plus operating the delivery queue
+	USER_ROLE_ADMIN = "admin"
+)
+
 type UserProfile struct {
 	Email string `json:"email"`
 	Id string `json:"id"`
 	Password string `json:"password"`
 	Token string `json:"token"`
+	Role string `json:"role"`
 }
 
 func (up UserProfile) GetFilledKey() []string {
@@ -245,6 +245,10 @@ func (up *UserProfile) ColumnMatcher(columnName string) interface{} {
 		return &up.Email
 	case "password":
 		return &up.Password
+	case "token":
+		return &up.Token
+	case "role":
+		return &up.Role
 	default:
 		return nil
 	}
@@ -255,37 +259,31 @@ func (up *UserProfile) GetAllColumn() []interface{} {
 		&up.Id,
 		&up.Email,
 		&up.Password,
+		&up.Token,
+		&up.Role,
 	}
 }
 
 func (up *UserProfile) Get(tx ITransaction) error {
 	path := "users.get"
-	selectColumn := []string{"email", "id"}
-	wherePairs := [][]string{
-		[]string{
-			"id", "=", up.Id,
-		},
-	}
-	rows, err := ReadFromDB(tx, path, selectColumn, wherePairs)
+	qb := NewQueryBuilder().Select("email", "id").Where("id", "=", up.Id)
+	rows, err := ReadFromDB(tx, path, qb, up)
 	if err != nil {
 		return err
 	}
-	if err := up.Scan(rows, selectColumn); err != nil {
+	if err := up.Scan(rows, qb.SelectColumn()); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (up *UserProfile) Find(tx ITransaction, selectColumn []string, wherePairs[][]string) error {
+func (up *UserProfile) Find(tx ITransaction, qb *QueryBuilder) error {
 	path := "users.find"
-	if len(selectColumn) == 0 {
-		selectColumn = []string{"*"}
-	}
-	rows, err := ReadFromDB(tx, path, selectColumn, wherePairs)
+	rows, err := ReadFromDB(tx, path, qb, up)
 	if err != nil {
 		return err
 	}
-	if err := up.Scan(rows, selectColumn); err != nil {
+	if err := up.Scan(rows, qb.SelectColumn()); err != nil {
 		return err
 	}
 	return nil
@@ -307,53 +305,66 @@ func (up *UserProfile) Scan(rows RowsScan, selectRows []string) error {
 	return nil
 }
 
-func (up UserProfile) InsertFormat() string {
-	return fmt.Sprintf("('%s','%s', '%s')", up.Id, up.Email, up.Password)
+func (up UserProfile) InsertFormat() (string, []interface{}) {
+	return placeholderGroup(3), []interface{}{up.Id, up.Email, up.Password}
 }
 
 func (up UserProfile) Insert(tx ITransaction) (int64, error) {
 	path := "users.create"
-	lastInsertId, err := WriteToDB(tx, path, up.InsertFormat())
+	format, args := up.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
 	if err != nil {
 		return 0, err
 	}
 	return lastInsertId, nil
 }
 
-func (up UserProfile) UpdateFormat(updateables []string) string {
-	baseQuery := ""
+// Column written by UpdateFormat for the updateables, in the same order
+func (up UserProfile) UpdateColumns(updateables []string) []string {
+	columns := []string{}
 	for _, column := range updateables {
 		switch column {
 		case "email":
-			baseQuery += fmt.Sprintf("email = '%s',", up.Email)
+			columns = append(columns, "email")
 		case "token":
-			baseQuery += fmt.Sprintf("token = '%s',", up.Token)
-		case "passowrd":
-			baseQuery += fmt.Sprintf("password = '%s',", up.Password)
-		default:
-			baseQuery += ""
+			columns = append(columns, "token")
+		case "password":
+			columns = append(columns, "password")
+		case "role":
+			columns = append(columns, "role")
 		}
 	}
+	return columns
+}
+
+func (up UserProfile) UpdateFormat(updateables []string) (string, []interface{}) {
+	baseQuery := ""
+	args := []interface{}{}
+	for _, column := range up.UpdateColumns(updateables) {
+		baseQuery += column + " = ?,"
+		args = append(args, columnValue(&up, column))
+	}
 	baseQuery = strings.TrimSuffix(baseQuery, ",")
-	return baseQuery
+	return baseQuery, args
 }
 
 func (up UserProfile) Update(tx ITransaction, updateables []string) (int64, error) {
 	path := "users.update"
-	lastInsertId, err := WriteToDB(tx, path, up.UpdateFormat(updateables), up.Id)
+	format, args := up.UpdateFormat(updateables)
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, append(args, up.Id))
 	if err != nil {
 		return 0, err
 	}
 	return lastInsertId, nil
 }
 
-func (up UserProfile) DeleteFormat() string {
-	return fmt.Sprintf("'%s'", up.Id)
+func (up UserProfile) DeleteFormat() []interface{} {
+	return []interface{}{up.Id}
 }
 
 func (up UserProfile) Delete(tx ITransaction) (int64, error) {
 	path := "users.delete"
-	lastInsertId, err := WriteToDB(tx, path, up.DeleteFormat())
+	lastInsertId, err := WriteToDB(tx, path, nil, up.DeleteFormat())
 	if err != nil {
 		return 0, err
 	}
@@ -385,57 +396,157 @@ func (up UserProfiles) BulkDelete(tx ITransaction) error {
 }
 
 // ------- TOPIC MODEL FUNCTION --------- //
+const (
+	TOPIC_VISIBILITY_PUBLIC = "public"
+	TOPIC_VISIBILITY_UNLISTED = "unlisted"
+	TOPIC_VISIBILITY_PRIVATE = "private"
+)
+
+func IsTopicVisibility(visibility string) bool {
+	switch visibility {
+	case TOPIC_VISIBILITY_PUBLIC, TOPIC_VISIBILITY_UNLISTED, TOPIC_VISIBILITY_PRIVATE:
+		return true
+	default:
+		return false
+	}
+}
+
 type Topic struct {
 	Id int `json:"id"`
 	UserId string `json:"user_id"`
 	Title string `json:"title"`
-	Desc string `json:"description`
+	Desc string `json:"description"`
+	Visibility string `json:"visibility"`
+	// Zero while the topic is alive, see Delete
+	DeletedAt int64 `json:"deleted_at,omitempty"`
+	// Not a column, it come from topic_tags
+	Tags []string `json:"tags"`
 }
 
-func (t Topic) InsertFormat() string {
-	return fmt.Sprintf("('%s','%s','%s')", t.UserId, t.Title, t.Desc)
+func (t Topic) InsertFormat() (string, []interface{}) {
+	return placeholderGroup(4), []interface{}{t.UserId, t.Title, t.Desc, t.Visibility}
 }
 
 func (t Topic) Insert(tx ITransaction) (int64, error) {
 	path := "topic.insert"
-	lastInsertId, err := WriteToDB(tx, path, t.InsertFormat())
+	format, args := t.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
 	if err != nil {
 		return 0, err
 	}
 	return lastInsertId, nil
 }
 
-func (t Topic) UpdateFormat() string {
-	return fmt.Sprintf("(%s,%s)", t.Title, t.Desc)
+func (t Topic) UpdateColumns(updateables []string) []string {
+	columns := []string{}
+	for _, column := range updateables {
+		switch column {
+		case "title":
+			columns = append(columns, "title")
+		case "description":
+			columns = append(columns, "description")
+		case "visibility":
+			columns = append(columns, "visibility")
+		}
+	}
+	return columns
+}
+
+func (t Topic) UpdateFormat(updateables []string) (string, []interface{}) {
+	baseQuery := ""
+	args := []interface{}{}
+	for _, column := range t.UpdateColumns(updateables) {
+		baseQuery += column + " = ?,"
+		args = append(args, columnValue(&t, column))
+	}
+	baseQuery = strings.TrimSuffix(baseQuery, ",")
+	return baseQuery, args
 }
 
-func (t Topic) Update(tx ITransaction) (int64, error) {
+func (t Topic) Update(tx ITransaction, updateables []string) (int64, error) {
 	path := "topic.update"
-	lastInsertId, err := WriteToDB(tx, path, t.UpdateFormat)
+	format, args := t.UpdateFormat(updateables)
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, append(args, t.Id))
 	if err != nil {
 		return 0, err
 	}
 	return lastInsertId, nil
 }
 
+// Only move topics.user_id, the member role is changed by the caller
+func (t Topic) Transfer(tx ITransaction) (int64, error) {
+	path := "topic.transfer"
+	lastInsertId, err := WriteToDB(tx, path, nil, []interface{}{t.UserId, t.Id})
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+/**
+	Soft delete, the row stay so notification already sent keep
+	pointing to it. Only DeletedAt is written
+*/
 func (t Topic) Delete(tx ITransaction) (int64, error) {
 	path := "topic.delete"
-	lastInsertId, err := WriteToDB(tx, path, t.Id)
+	lastInsertId, err := WriteToDB(tx, path, nil, []interface{}{t.DeletedAt, t.Id})
 	if err != nil {
 		return 0, err
 	}
 	return lastInsertId, nil
 }
 
+/**
+	Hard delete, used when the owner account goes away since topics.user_id
+	cannot point to a missing user. Everything hanging off the topic goes
+	first, deliveries before the notification and subscriber they reference
+*/
+func (t Topic) Purge(tx ITransaction) (int64, error) {
+	paths := []string{
+		"topic.purgeDeliveryAttempts", "topic.purgeDeadLetters", "topic.purgeDeliveryJobs",
+		"topic.purgeNotifications", "topic.purgeSubscribers", "topic.purgeMembers",
+		"topic.purgeSubscriptionRequests", "topic.purgeApiKeyTopics", "topic.purgeTags",
+		"topic.purge",
+	}
+	for _, path := range paths {
+		if _, err := AffectToDB(tx, path, nil, []interface{}{t.Id}); err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+func (t Topic) CountSubscribers(tx ITransaction) (int, error) {
+	query, err := Query("topic.countSubscribers")
+	if err != nil {
+		return 0, err
+	}
+	rows, err := tx.Query(query, t.Id)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
 
 type Topics []Topic
 
-func (t Topics) InsertFormat() string {
+func (t Topics) InsertFormat() (string, []interface{}) {
 	finalQuery := make([]string, len(t))
+	args := []interface{}{}
 	for i:=0; i < len(t); i++ {
-		finalQuery[i] = t[i].InsertFormat()
+		format, rowArgs := t[i].InsertFormat()
+		finalQuery[i] = format
+		args = append(args, rowArgs...)
 	}
-	return strings.Join(finalQuery, ",")
+	return strings.Join(finalQuery, ","), args
 }
 
 func (t *Topic) ColumnMatcher(column string) interface{} {
@@ -444,10 +555,14 @@ func (t *Topic) ColumnMatcher(column string) interface{} {
 		return &t.Id
 	case "user_id":
 		return &t.UserId
-	case "desc":
+	case "description":
 		return &t.Desc
 	case "title":
 		return &t.Title
+	case "visibility":
+		return &t.Visibility
+	case "deleted_at":
+		return &t.DeletedAt
 	default:
 		return nil
 	}
@@ -457,27 +572,30 @@ func (t *Topic) GetAllColumn() []interface{} {
 	return []interface{}{
 		&t.Id,
 		&t.UserId,
-		&t.Desc,
 		&t.Title,
+		&t.Desc,
+		&t.Visibility,
+		&t.DeletedAt,
 	}
 }
 
 func (t Topics) Insert(tx ITransaction) (int64, error) {
 	path := "topics.insert"
-	lastInsertId, err := WriteToDB(tx, path, t.InsertFormat())
+	format, args := t.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
 	if err != nil {
 		return int64(0), err
 	}
 	return lastInsertId, nil
 }
 
-func (t *Topics) Get(tx ITransaction, selectColumn []string, wherePairs [][]string, afterWhere [][]string) error {
+func (t *Topics) Get(tx ITransaction, qb *QueryBuilder) error {
 	path := "topics.get"
-	rows, err := ReadFromDB(tx, path, selectColumn, wherePairs, afterWhere)
+	rows, err := ReadFromDB(tx, path, qb, &Topic{})
 	if err != nil {
 		return err
 	}
-	if err := t.Scan(rows, selectColumn); err != nil {
+	if err := t.Scan(rows, qb.SelectColumn()); err != nil {
 		return err
 	}
 	return nil
@@ -501,39 +619,220 @@ func (t *Topics) Scan(rows RowsScan, selectColumn []string) error {
 	return nil
 }
 
+// Tag of a topic, used to filter topic search
+type TopicTag struct {
+	Id int `json:"id"`
+	TopicId int `json:"topic_id"`
+	Tag string `json:"tag"`
+}
+
+func (tt TopicTag) InsertFormat() (string, []interface{}) {
+	return placeholderGroup(2), []interface{}{tt.TopicId, tt.Tag}
+}
+
+func (tt TopicTag) Insert(tx ITransaction) (int64, error) {
+	path := "topicTag.insert"
+	format, args := tt.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+func (tt *TopicTag) ColumnMatcher(column string) interface{} {
+	switch column {
+	case "id":
+		return &tt.Id
+	case "topic_id":
+		return &tt.TopicId
+	case "tag":
+		return &tt.Tag
+	default:
+		return nil
+	}
+}
+
+func (tt *TopicTag) GetAllColumn() []interface{} {
+	return []interface{}{
+		&tt.Id,
+		&tt.TopicId,
+		&tt.Tag,
+	}
+}
+
+type TopicTags []TopicTag
+
+func (tt *TopicTags) Get(tx ITransaction, qb *QueryBuilder) error {
+	path := "topicTags.get"
+	rows, err := ReadFromDB(tx, path, qb, &TopicTag{})
+	if err != nil {
+		return err
+	}
+	if err := tt.Scan(rows, qb.SelectColumn()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (tt *TopicTags) Scan(rows RowsScan, selectColumn []string) error {
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		topicTag := &TopicTag{}
+		scanArray := dynamicScan(selectColumn, topicTag)
+		if err := rows.Scan(scanArray...); err != nil {
+			return err
+		}
+		(*tt) = append(*tt, *topicTag)
+		count++
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Tag is replaced as a whole, the previous one is removed first
+func (tt TopicTags) Replace(tx ITransaction, topicId int) (int64, error) {
+	if _, err := WriteToDB(tx, "topicTags.deleteByTopic", nil, []interface{}{topicId}); err != nil {
+		return 0, err
+	}
+	for _, topicTag := range tt {
+		topicTag.TopicId = topicId
+		if _, err := topicTag.Insert(tx); err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+func NewTopicTags(tags []string) TopicTags {
+	topicTags := make(TopicTags, len(tags))
+	for i, tag := range tags {
+		topicTags[i].Tag = tag
+	}
+	return topicTags
+}
+
+/**
+	Topic with its activity, only read through topics.search. Both
+	count is computed by the query
+*/
+type TopicStat struct {
+	Topic
+	SubscriberCount int `json:"subscriber_count"`
+	// created_at of the latest notification, zero when nothing is published yet
+	LastActivityAt int64 `json:"last_activity_at"`
+}
+
+func (ts *TopicStat) ColumnMatcher(column string) interface{} {
+	switch column {
+	case "subscriber_count":
+		return &ts.SubscriberCount
+	case "last_activity_at":
+		return &ts.LastActivityAt
+	default:
+		return ts.Topic.ColumnMatcher(column)
+	}
+}
+
+func (ts *TopicStat) GetAllColumn() []interface{} {
+	return append(ts.Topic.GetAllColumn(), &ts.SubscriberCount, &ts.LastActivityAt)
+}
+
+type TopicStats []TopicStat
+
+/**
+	The clause is put right after topics so both count is only computed
+	for topic that pass the filter, not for every topic first. It can be
+	sorted on but not filtered on. Every column is always selected
+*/
+func (ts *TopicStats) Get(tx ITransaction, qb *QueryBuilder) error {
+	_, clause, args, err := qb.Build(&TopicStat{})
+	if err != nil {
+		return err
+	}
+	query, err := Query("topics.search", clause)
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	return ts.Scan(rows, []string{"*"})
+}
+
+func (ts *TopicStats) Scan(rows RowsScan, selectColumn []string) error {
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		topicStat := &TopicStat{}
+		scanArray := dynamicScan(selectColumn, topicStat)
+		if err := rows.Scan(scanArray...); err != nil {
+			return err
+		}
+		(*ts) = append(*ts, *topicStat)
+		count++
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 // ------- SUBSCRIBER MODEL FUNCTION --------- //
 type Subscriber struct {
 	Id int `json:"id"`
 	TopicId int `json:"topic_id"`
 	UserId string `json:"user_id"`
+	CallbackUrl string `json:"callback_url"`
+	Secret string `json:"-"`
+	// Let the user unsubscribe from a link in the message without login
+	UnsubscribeToken string `json:"-"`
 }
 
-func (s Subscriber) InsertFormat() string {
-	return fmt.Sprintf("(%d,'%s')", s.TopicId, s.UserId)
+func (s Subscriber) InsertFormat() (string, []interface{}) {
+	return placeholderGroup(5), []interface{}{s.TopicId, s.UserId, s.CallbackUrl, s.Secret, s.UnsubscribeToken}
 }
 
 func (s Subscriber) Insert(tx ITransaction) (int64, error) {
 	path:= "subscriber.create"
-	lastInsertId, err := WriteToDB(tx, path, s.InsertFormat())
+	format, args := s.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
 	if err != nil {
 		return 0, err
 	}
 	return lastInsertId, nil
 }
 
-func (s Subscriber) DeleteFormat() string {
-	return fmt.Sprintf("%d", s.Id)
+func (s Subscriber) DeleteFormat() []interface{} {
+	return []interface{}{s.Id}
 }
 
 func (s Subscriber) Delete(tx ITransaction) (int64, error) {
 	path := "subscriber.delete"
-	lastInsertId, err := WriteToDB(tx, path, s.DeleteFormat())
+	lastInsertId, err := WriteToDB(tx, path, nil, s.DeleteFormat())
 	if err != nil {
 		return 0, err
 	}
 	return lastInsertId, nil
 }
 
+/**
+	Delivery job and attempt reference the subscriber so they need to
+	go first, dead letter before the job it reference
+*/
+func (s Subscriber) DeleteDeliveries(tx ITransaction) (int64, error) {
+	for _, path := range []string{"subscriber.deleteDeliveryAttempts", "subscriber.deleteDeadLetters", "subscriber.deleteDeliveryJobs"} {
+		if _, err := WriteToDB(tx, path, nil, s.DeleteFormat()); err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
 func (s *Subscriber) ColumnMatcher(columnName string) interface{} {
 	switch columnName {
 	case "id":
@@ -542,6 +841,12 @@ func (s *Subscriber) ColumnMatcher(columnName string) interface{} {
 		return &s.TopicId
 	case "user_id":
 		return &s.UserId
+	case "callback_url":
+		return &s.CallbackUrl
+	case "secret":
+		return &s.Secret
+	case "unsubscribe_token":
+		return &s.UnsubscribeToken
 	default:
 		return nil
 	}
@@ -552,22 +857,21 @@ func (s *Subscriber) GetAllColumn() []interface{} {
 		&s.Id,
 		&s.TopicId,
 		&s.UserId,
+		&s.CallbackUrl,
+		&s.Secret,
+		&s.UnsubscribeToken,
 	}
 }
 
 type Subscribers []Subscriber
 
-func (s *Subscribers) Get(tx ITransaction, selectColumn []string, wherePairs [][]string) error {
+func (s *Subscribers) Get(tx ITransaction, qb *QueryBuilder) error {
 	path := "subscribers.get"
-	if len(selectColumn) == 0 {
-		selectColumn = []string{"*"}
-	}
-	rows, err := ReadFromDB(tx, path, selectColumn, wherePairs)
+	rows, err := ReadFromDB(tx, path, qb, &Subscriber{})
 	if err != nil {
 		return err
 	}
-
-	if err := s.Scan(rows, selectColumn); err != nil {
+	if err := s.Scan(rows, qb.SelectColumn()); err != nil {
 		return err
 	}
 	return nil
@@ -600,15 +904,19 @@ type Notification struct {
 	TopicId int `json:"topic_id"`
 	Message string `json:"message"`
 	IsRead bool `json:"is_read"`
+	CreatedAt int64 `json:"created_at"`
+	// Not a column, only sent with a new notification
+	UnsubscribeToken string `json:"unsubscribe_token,omitempty"`
 }
 
-func (n Notification) InsertFormat() string {
-	return fmt.Sprintf("('%s',%d,'%s')", n.UserId, n.TopicId, n.Message)
+func (n Notification) InsertFormat() (string, []interface{}) {
+	return placeholderGroup(4), []interface{}{n.UserId, n.TopicId, n.Message, n.CreatedAt}
 }
 
 func (n Notification) Insert(tx ITransaction) (int64, error) {
 	path := "notification.insertNotification"
-	lastInsertId, err := WriteToDB(tx, path, n.InsertFormat())
+	format, args := n.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
 	if err != nil {
 		return 0, err
 	}
@@ -617,17 +925,14 @@ func (n Notification) Insert(tx ITransaction) (int64, error) {
 
 func (n *Notification) Get(tx ITransaction) error {
 	path := "notification.get"
-	selectColumn := []string{"id", "user_id", "topic_id", "message", "is_read"}
-	wherePairs := [][]string{
-		[]string{
-			"id", "=", fmt.Sprintf("%d", n.Id),
-		},
-	}
-	rows, err := ReadFromDB(tx, path, selectColumn, wherePairs)
+	qb := NewQueryBuilder().
+		Select("id", "user_id", "topic_id", "message", "is_read", "created_at").
+		Where("id", "=", n.Id)
+	rows, err := ReadFromDB(tx, path, qb, n)
 	if err != nil {
 		return err
 	}
-	if err := n.Scan(rows, selectColumn); err != nil {
+	if err := n.Scan(rows, qb.SelectColumn()); err != nil {
 		return err
 	}
 	return nil
@@ -645,6 +950,8 @@ func (n *Notification) ColumnMatcher(column string) interface{} {
 		return &n.Message
 	case "is_read":
 		return &n.IsRead
+	case "created_at":
+		return &n.CreatedAt
 	default:
 		return nil
 	}
@@ -657,6 +964,7 @@ func (n *Notification) GetAllColumn() []interface{} {
 		&n.TopicId,
 		&n.Message,
 		&n.IsRead,
+		&n.CreatedAt,
 	}
 }
 
@@ -678,33 +986,34 @@ func (n *Notification) Scan(rows RowsScan, selectRows []string) error {
 
 type Notifications []Notification
 
-func (n Notifications) InsertFormat() string {
+func (n Notifications) InsertFormat() (string, []interface{}) {
 	finalQuery := make([]string, len(n))
+	args := []interface{}{}
 	for i:=0; i < len(n); i++ {
-		finalQuery[i] = n[i].InsertFormat()
+		format, rowArgs := n[i].InsertFormat()
+		finalQuery[i] = format
+		args = append(args, rowArgs...)
 	}
-	return strings.Join(finalQuery, ",")
+	return strings.Join(finalQuery, ","), args
 }
 
 func (n Notifications) Insert(tx ITransaction) (int64, error) {
 	path := "notification.bulkInsertNotification"
-	lastInsertId, err := WriteToDB(tx, path, n.InsertFormat())
+	format, args := n.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
 	if err != nil {
 		return 0, err
 	}
 	return lastInsertId, nil
 }
 
-func (n *Notifications) Get(tx ITransaction, selectColumn []string, wherePairs [][]string) error {
+func (n *Notifications) Get(tx ITransaction, qb *QueryBuilder) error {
 	path := "notifications.get"
-	if len(selectColumn) == 0 {
-		selectColumn = []string{"*"}
-	}
-	rows, err := ReadFromDB(tx, path, selectColumn, wherePairs)
+	rows, err := ReadFromDB(tx, path, qb, &Notification{})
 	if err != nil {
 		return err
 	}
-	if err := n.Scan(rows, selectColumn); err != nil {
+	if err := n.Scan(rows, qb.SelectColumn()); err != nil {
 		return err
 	}
 	return nil
@@ -728,6 +1037,7 @@ func (n *Notifications) Scan(rows RowsScan, selectColumn []string) error {
 	return nil
 }
 
+// Only for display, query should use InsertFormat so every value is bound
 func (n Notifications) ComposeInputBulkFormat() string {
 	finalFormat := make([]string, len(n))
 	baseFormat := "('%s',%v,'%s')"
@@ -745,20 +1055,1265 @@ func (n Notifications) ComposeIdBulkFormat() string {
 	return "(" + strings.Join(finalFormat, ",") + ")"
 }
 
+func (n Notifications) IdPlaceholderFormat() (string, []interface{}) {
+	args := make([]interface{}, len(n))
+	for i:=0; i < len(n); i++ {
+		args[i] = n[i].Id
+	}
+	return placeholderGroup(len(n)), args
+}
+
+// Only unread one is touched, return how many
 func (n Notifications) UpdateReadNotification(tx ITransaction) (int64, error) {
-	path := "notifications.updateRead"
-	lastInsertId, err := WriteToDB(tx, path, n.ComposeIdBulkFormat())
+	format, args := n.IdPlaceholderFormat()
+	return AffectToDB(tx, "notifications.updateRead", []interface{}{format}, args)
+}
+
+func (n Notifications) Delete(tx ITransaction) (int64, error) {
+	path := "notifications.delete"
+	format, args := n.IdPlaceholderFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
 	if err != nil {
 		return 0, err
 	}
 	return lastInsertId, nil
 }
 
-func (n Notifications) Delete(tx ITransaction) (int64, error) {
-	path := "notifications.delete"
-	lastInsertId, err := WriteToDB(tx, path, n.ComposeIdBulkFormat())
+// Same as subscriber, delivery of the notification need to go first
+func (n Notifications) DeleteDeliveries(tx ITransaction) (int64, error) {
+	format, args := n.IdPlaceholderFormat()
+	for _, path := range []string{"notifications.deleteDeliveryAttempts", "notifications.deleteDeadLetters", "notifications.deleteDeliveryJobs"} {
+		if _, err := WriteToDB(tx, path, []interface{}{format}, args); err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+/**
+	Every notification of a user, or only those with id below BeforeId
+	when it is set. Written as one statement so the number of notification
+	does not matter, unlike the id list that need one placeholder per id
+*/
+type UserNotifications struct {
+	UserId string
+	BeforeId int
+}
+
+func (un UserNotifications) Format() (string, []interface{}) {
+	if un.BeforeId > 0 {
+		return " AND id < ?", []interface{}{un.UserId, un.BeforeId}
+	}
+	return "", []interface{}{un.UserId}
+}
+
+func (un UserNotifications) has(notification Notification) bool {
+	if notification.UserId != un.UserId {
+		return false
+	}
+	return un.BeforeId <= 0 || notification.Id < un.BeforeId
+}
+
+func (un UserNotifications) UpdateReadNotification(tx ITransaction) (int64, error) {
+	format, args := un.Format()
+	return AffectToDB(tx, "notifications.readOfUser", []interface{}{format}, args)
+}
+
+func (un UserNotifications) Delete(tx ITransaction) (int64, error) {
+	format, args := un.Format()
+	return AffectToDB(tx, "notifications.deleteOfUser", []interface{}{format}, args)
+}
+
+func (un UserNotifications) DeleteDeliveries(tx ITransaction) (int64, error) {
+	format, args := un.Format()
+	for _, path := range []string{"notifications.deleteDeliveryAttemptsOfUser", "notifications.deleteDeadLettersOfUser", "notifications.deleteDeliveryJobsOfUser"} {
+		if _, err := AffectToDB(tx, path, []interface{}{format}, args); err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+// -------- UNREAD COUNT MODEL FUNCTION --------- //
+// Not a table, unread notification of a user counted per topic
+type UnreadCount struct {
+	TopicId int `json:"topic_id"`
+	Count int `json:"count"`
+}
+
+type UnreadCounts []UnreadCount
+
+/**
+	Aggregate is not something the query builder can express so the
+	query is taken as is from the query map with the user as its only
+	argument. Topic without unread notification is not returned
+*/
+func (uc *UnreadCounts) Get(tx ITransaction, userId string) error {
+	query, err := Query("notifications.countUnread")
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query(query, userId)
+	if err != nil {
+		return err
+	}
+	return uc.Scan(rows)
+}
+
+func (uc *UnreadCounts) Scan(rows RowsScan) error {
+	defer rows.Close()
+	for rows.Next() {
+		unreadCount := UnreadCount{}
+		if err := rows.Scan(&unreadCount.TopicId, &unreadCount.Count); err != nil {
+			return err
+		}
+		*uc = append(*uc, unreadCount)
+	}
+	return nil
+}
+
+// -------- DELIVERY ATTEMPT MODEL FUNCTION --------- //
+type DeliveryAttempt struct {
+	Id int `json:"id"`
+	SubscriberId int `json:"subscriber_id"`
+	NotificationId int `json:"notification_id"`
+	Url string `json:"url"`
+	Attempt int `json:"attempt"`
+	StatusCode int `json:"status_code"`
+	Error string `json:"error"`
+}
+
+func (da DeliveryAttempt) InsertFormat() (string, []interface{}) {
+	return placeholderGroup(6), []interface{}{da.SubscriberId, da.NotificationId, da.Url, da.Attempt, da.StatusCode, da.Error}
+}
+
+func (da DeliveryAttempt) Insert(tx ITransaction) (int64, error) {
+	path := "deliveryAttempt.insert"
+	format, args := da.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+// -------- DELIVERY JOB MODEL FUNCTION --------- //
+const (
+	JOB_STATE_PENDING = "pending"
+	JOB_STATE_IN_FLIGHT = "in_flight"
+	JOB_STATE_DELIVERED = "delivered"
+	JOB_STATE_FAILED = "failed"
+	JOB_STATE_DEAD = "dead"
+)
+
+/**
+	DeliveryJob is a single notification waiting to be delivered through
+	a non database channel. Every time is stored as unix second so the
+	comparison behave the same in every database
+*/
+type DeliveryJob struct {
+	Id int `json:"id"`
+	Channel string `json:"channel"`
+	SubscriberId int `json:"subscriber_id"`
+	NotificationId int `json:"notification_id"`
+	Payload string `json:"payload"`
+	State string `json:"state"`
+	Attempts int `json:"attempts"`
+	AvailableAt int64 `json:"available_at"`
+	LockedUntil int64 `json:"locked_until"`
+	ClaimToken string `json:"-"`
+	LastError string `json:"last_error"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+func (dj DeliveryJob) InsertFormat() (string, []interface{}) {
+	return placeholderGroup(11), []interface{}{
+		dj.Channel, dj.SubscriberId, dj.NotificationId, dj.Payload, dj.State,
+		dj.Attempts, dj.AvailableAt, dj.LockedUntil, dj.ClaimToken, dj.LastError, dj.CreatedAt,
+	}
+}
+
+func (dj DeliveryJob) Insert(tx ITransaction) (int64, error) {
+	path := "deliveryJob.insert"
+	format, args := dj.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
 	if err != nil {
 		return 0, err
 	}
 	return lastInsertId, nil
-}
\ No newline at end of file
+}
+
+/**
+	Claim only succeed when the job is still claimable at the time of update.
+	Caller read back the claimed job through its claim token
+*/
+func (dj DeliveryJob) Claim(tx ITransaction, now int64) (int64, error) {
+	path := "deliveryJob.claim"
+	args := []interface{}{dj.LockedUntil, dj.ClaimToken, dj.Id, now, now}
+	lastInsertId, err := WriteToDB(tx, path, nil, args)
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+func (dj DeliveryJob) UpdateFormat(updateables []string) (string, []interface{}) {
+	baseQuery := ""
+	args := []interface{}{}
+	for _, column := range updateables {
+		switch column {
+		case "state":
+			baseQuery += "state = ?,"
+			args = append(args, dj.State)
+		case "attempts":
+			baseQuery += "attempts = ?,"
+			args = append(args, dj.Attempts)
+		case "available_at":
+			baseQuery += "available_at = ?,"
+			args = append(args, dj.AvailableAt)
+		case "locked_until":
+			baseQuery += "locked_until = ?,"
+			args = append(args, dj.LockedUntil)
+		case "claim_token":
+			baseQuery += "claim_token = ?,"
+			args = append(args, dj.ClaimToken)
+		case "last_error":
+			baseQuery += "last_error = ?,"
+			args = append(args, dj.LastError)
+		default:
+			baseQuery += ""
+		}
+	}
+	baseQuery = strings.TrimSuffix(baseQuery, ",")
+	return baseQuery, args
+}
+
+func (dj DeliveryJob) Update(tx ITransaction, updateables []string) (int64, error) {
+	path := "deliveryJob.update"
+	format, args := dj.UpdateFormat(updateables)
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, append(args, dj.Id))
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+func (dj *DeliveryJob) ColumnMatcher(column string) interface{} {
+	switch column {
+	case "id":
+		return &dj.Id
+	case "channel":
+		return &dj.Channel
+	case "subscriber_id":
+		return &dj.SubscriberId
+	case "notification_id":
+		return &dj.NotificationId
+	case "payload":
+		return &dj.Payload
+	case "state":
+		return &dj.State
+	case "attempts":
+		return &dj.Attempts
+	case "available_at":
+		return &dj.AvailableAt
+	case "locked_until":
+		return &dj.LockedUntil
+	case "claim_token":
+		return &dj.ClaimToken
+	case "last_error":
+		return &dj.LastError
+	case "created_at":
+		return &dj.CreatedAt
+	default:
+		return nil
+	}
+}
+
+func (dj *DeliveryJob) GetAllColumn() []interface{} {
+	return []interface{}{
+		&dj.Id,
+		&dj.Channel,
+		&dj.SubscriberId,
+		&dj.NotificationId,
+		&dj.Payload,
+		&dj.State,
+		&dj.Attempts,
+		&dj.AvailableAt,
+		&dj.LockedUntil,
+		&dj.ClaimToken,
+		&dj.LastError,
+		&dj.CreatedAt,
+	}
+}
+
+type DeliveryJobs []DeliveryJob
+
+func (dj *DeliveryJobs) Get(tx ITransaction, qb *QueryBuilder) error {
+	path := "deliveryJobs.get"
+	rows, err := ReadFromDB(tx, path, qb, &DeliveryJob{})
+	if err != nil {
+		return err
+	}
+	if err := dj.Scan(rows, qb.SelectColumn()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (dj *DeliveryJobs) Scan(rows RowsScan, selectColumn []string) error {
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		job := &DeliveryJob{}
+		scanArray := dynamicScan(selectColumn, job)
+		if err := rows.Scan(scanArray...); err != nil {
+			return err
+		}
+		(*dj) = append(*dj, *job)
+		count++
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// -------- DEAD LETTER MODEL FUNCTION --------- //
+/**
+	DeadLetter is a snapshot of a job that used up all its attempts.
+	The job itself stay in delivery_jobs with dead state until requeued
+*/
+type DeadLetter struct {
+	Id int `json:"id"`
+	JobId int `json:"job_id"`
+	Channel string `json:"channel"`
+	SubscriberId int `json:"subscriber_id"`
+	NotificationId int `json:"notification_id"`
+	Payload string `json:"payload"`
+	Attempts int `json:"attempts"`
+	LastError string `json:"last_error"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+func NewDeadLetter(job DeliveryJob, now int64) DeadLetter {
+	return DeadLetter{
+		JobId: job.Id,
+		Channel: job.Channel,
+		SubscriberId: job.SubscriberId,
+		NotificationId: job.NotificationId,
+		Payload: job.Payload,
+		Attempts: job.Attempts,
+		LastError: job.LastError,
+		CreatedAt: now,
+	}
+}
+
+func (dl DeadLetter) InsertFormat() (string, []interface{}) {
+	return placeholderGroup(8), []interface{}{
+		dl.JobId, dl.Channel, dl.SubscriberId, dl.NotificationId, dl.Payload, dl.Attempts, dl.LastError, dl.CreatedAt,
+	}
+}
+
+func (dl DeadLetter) Insert(tx ITransaction) (int64, error) {
+	path := "deadLetter.insert"
+	format, args := dl.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+func (dl DeadLetter) Delete(tx ITransaction) (int64, error) {
+	path := "deadLetter.delete"
+	lastInsertId, err := WriteToDB(tx, path, nil, []interface{}{dl.Id})
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+func (dl *DeadLetter) ColumnMatcher(column string) interface{} {
+	switch column {
+	case "id":
+		return &dl.Id
+	case "job_id":
+		return &dl.JobId
+	case "channel":
+		return &dl.Channel
+	case "subscriber_id":
+		return &dl.SubscriberId
+	case "notification_id":
+		return &dl.NotificationId
+	case "payload":
+		return &dl.Payload
+	case "attempts":
+		return &dl.Attempts
+	case "last_error":
+		return &dl.LastError
+	case "created_at":
+		return &dl.CreatedAt
+	default:
+		return nil
+	}
+}
+
+func (dl *DeadLetter) GetAllColumn() []interface{} {
+	return []interface{}{
+		&dl.Id,
+		&dl.JobId,
+		&dl.Channel,
+		&dl.SubscriberId,
+		&dl.NotificationId,
+		&dl.Payload,
+		&dl.Attempts,
+		&dl.LastError,
+		&dl.CreatedAt,
+	}
+}
+
+type DeadLetters []DeadLetter
+
+func (dl *DeadLetters) Get(tx ITransaction, qb *QueryBuilder) error {
+	path := "deadLetters.get"
+	rows, err := ReadFromDB(tx, path, qb, &DeadLetter{})
+	if err != nil {
+		return err
+	}
+	if err := dl.Scan(rows, qb.SelectColumn()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (dl *DeadLetters) Scan(rows RowsScan, selectColumn []string) error {
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		deadLetter := &DeadLetter{}
+		scanArray := dynamicScan(selectColumn, deadLetter)
+		if err := rows.Scan(scanArray...); err != nil {
+			return err
+		}
+		(*dl) = append(*dl, *deadLetter)
+		count++
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// -------- TOPIC MEMBER MODEL FUNCTION --------- //
+const (
+	TOPIC_ROLE_OWNER = "owner"
+	TOPIC_ROLE_ADMIN = "admin"
+	TOPIC_ROLE_PUBLISHER = "publisher"
+	TOPIC_ROLE_SUBSCRIBER = "subscriber"
+	TOPIC_ROLE_VIEWER = "viewer"
+)
+
+// Every role can do what the role below it can
+var topicRoleRank = map[string]int{
+	TOPIC_ROLE_VIEWER: 1,
+	TOPIC_ROLE_SUBSCRIBER: 2,
+	TOPIC_ROLE_PUBLISHER: 3,
+	TOPIC_ROLE_ADMIN: 4,
+	TOPIC_ROLE_OWNER: 5,
+}
+
+func IsTopicRole(role string) bool {
+	_, ok := topicRoleRank[role]
+	return ok
+}
+
+// Unknown role is below every role
+func TopicRoleAtLeast(role, required string) bool {
+	rank, ok := topicRoleRank[role]
+	return ok && rank >= topicRoleRank[required]
+}
+
+/**
+	TopicMember give a user a role on a topic. Every topic has exactly
+	one owner member, the same user as topics.user_id
+*/
+type TopicMember struct {
+	Id int `json:"id"`
+	TopicId int `json:"topic_id"`
+	UserId string `json:"user_id"`
+	Role string `json:"role"`
+	InvitedBy string `json:"invited_by"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+func (tm TopicMember) InsertFormat() (string, []interface{}) {
+	return placeholderGroup(5), []interface{}{tm.TopicId, tm.UserId, tm.Role, tm.InvitedBy, tm.CreatedAt}
+}
+
+func (tm TopicMember) Insert(tx ITransaction) (int64, error) {
+	path := "topicMember.insert"
+	format, args := tm.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+// Member is found by topic and user, the id is not needed
+func (tm TopicMember) UpdateRole(tx ITransaction) (int64, error) {
+	path := "topicMember.updateRole"
+	lastInsertId, err := WriteToDB(tx, path, nil, []interface{}{tm.Role, tm.TopicId, tm.UserId})
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+func (tm TopicMember) DeleteFormat() []interface{} {
+	return []interface{}{tm.TopicId, tm.UserId}
+}
+
+func (tm TopicMember) Delete(tx ITransaction) (int64, error) {
+	path := "topicMember.delete"
+	lastInsertId, err := WriteToDB(tx, path, nil, tm.DeleteFormat())
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+func (tm *TopicMember) ColumnMatcher(column string) interface{} {
+	switch column {
+	case "id":
+		return &tm.Id
+	case "topic_id":
+		return &tm.TopicId
+	case "user_id":
+		return &tm.UserId
+	case "role":
+		return &tm.Role
+	case "invited_by":
+		return &tm.InvitedBy
+	case "created_at":
+		return &tm.CreatedAt
+	default:
+		return nil
+	}
+}
+
+func (tm *TopicMember) GetAllColumn() []interface{} {
+	return []interface{}{
+		&tm.Id,
+		&tm.TopicId,
+		&tm.UserId,
+		&tm.Role,
+		&tm.InvitedBy,
+		&tm.CreatedAt,
+	}
+}
+
+type TopicMembers []TopicMember
+
+func (tm *TopicMembers) Get(tx ITransaction, qb *QueryBuilder) error {
+	path := "topicMembers.get"
+	rows, err := ReadFromDB(tx, path, qb, &TopicMember{})
+	if err != nil {
+		return err
+	}
+	if err := tm.Scan(rows, qb.SelectColumn()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (tm *TopicMembers) Scan(rows RowsScan, selectColumn []string) error {
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		topicMember := &TopicMember{}
+		scanArray := dynamicScan(selectColumn, topicMember)
+		if err := rows.Scan(scanArray...); err != nil {
+			return err
+		}
+		(*tm) = append(*tm, *topicMember)
+		count++
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// -------- AUDIT LOG MODEL FUNCTION --------- //
+const (
+	AUDIT_PUBLISH_DENIED = "notification.publish.denied"
+	AUDIT_MEMBER_ADDED = "topic.member.added"
+	AUDIT_MEMBER_ROLE_CHANGED = "topic.member.role_changed"
+	AUDIT_MEMBER_REMOVED = "topic.member.removed"
+	AUDIT_MEMBER_DENIED = "topic.member.denied"
+	AUDIT_OWNERSHIP_TRANSFERRED = "topic.ownership.transferred"
+	AUDIT_TOPIC_UPDATED = "topic.updated"
+	AUDIT_TOPIC_DELETED = "topic.deleted"
+	AUDIT_SUBSCRIPTION_APPROVED = "topic.subscription.approved"
+	AUDIT_SUBSCRIPTION_REJECTED = "topic.subscription.rejected"
+	AUDIT_UNSUBSCRIBED = "topic.subscription.deleted"
+	AUDIT_REFRESH_TOKEN_REUSED = "user.refresh_token.reused"
+	AUDIT_API_KEY_CREATED = "api_key.created"
+	AUDIT_API_KEY_REVOKED = "api_key.revoked"
+)
+
+/**
+	AuditLog record who tried to do what on which target. It is
+	only appended, user_id has no foreign key so the trail stay
+	after the user is deleted
+*/
+type AuditLog struct {
+	Id int `json:"id"`
+	UserId string `json:"user_id"`
+	Action string `json:"action"`
+	Target string `json:"target"`
+	Detail string `json:"detail"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+func (al AuditLog) InsertFormat() (string, []interface{}) {
+	return placeholderGroup(5), []interface{}{al.UserId, al.Action, al.Target, al.Detail, al.CreatedAt}
+}
+
+func (al AuditLog) Insert(tx ITransaction) (int64, error) {
+	path := "auditLog.insert"
+	format, args := al.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+func (al *AuditLog) ColumnMatcher(column string) interface{} {
+	switch column {
+	case "id":
+		return &al.Id
+	case "user_id":
+		return &al.UserId
+	case "action":
+		return &al.Action
+	case "target":
+		return &al.Target
+	case "detail":
+		return &al.Detail
+	case "created_at":
+		return &al.CreatedAt
+	default:
+		return nil
+	}
+}
+
+func (al *AuditLog) GetAllColumn() []interface{} {
+	return []interface{}{
+		&al.Id,
+		&al.UserId,
+		&al.Action,
+		&al.Target,
+		&al.Detail,
+		&al.CreatedAt,
+	}
+}
+
+type AuditLogs []AuditLog
+
+func (al *AuditLogs) Get(tx ITransaction, qb *QueryBuilder) error {
+	path := "auditLogs.get"
+	rows, err := ReadFromDB(tx, path, qb, &AuditLog{})
+	if err != nil {
+		return err
+	}
+	if err := al.Scan(rows, qb.SelectColumn()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (al *AuditLogs) Scan(rows RowsScan, selectColumn []string) error {
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		auditLog := &AuditLog{}
+		scanArray := dynamicScan(selectColumn, auditLog)
+		if err := rows.Scan(scanArray...); err != nil {
+			return err
+		}
+		(*al) = append(*al, *auditLog)
+		count++
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// -------- REFRESH TOKEN MODEL FUNCTION --------- //
+var (
+	ErrRefreshTokenReused = errors.New("REFRESH TOKEN ALREADY USED")
+)
+
+/**
+	RefreshToken is only stored as a hash. Every use rotate it, the
+	used token is revoked and point to its replacement. Tokens rotated
+	from the same login share a family so a reused token can revoke
+	every token of that login
+*/
+type RefreshToken struct {
+	Id int `json:"id"`
+	UserId string `json:"user_id"`
+	FamilyId string `json:"family_id"`
+	TokenHash string `json:"-"`
+	ReplacedBy string `json:"-"`
+	ExpiresAt int64 `json:"expires_at"`
+	RevokedAt int64 `json:"revoked_at"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+func (rt RefreshToken) InsertFormat() (string, []interface{}) {
+	return placeholderGroup(7), []interface{}{
+		rt.UserId, rt.FamilyId, rt.TokenHash, rt.ReplacedBy,
+		rt.ExpiresAt, rt.RevokedAt, rt.CreatedAt,
+	}
+}
+
+func (rt RefreshToken) Insert(tx ITransaction) (int64, error) {
+	path := "refreshToken.insert"
+	format, args := rt.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+/**
+	Rotate only succeed when the token is not revoked yet at the time of
+	update. Caller read the token back and compare ReplacedBy to know
+	whether it won
+*/
+func (rt RefreshToken) Rotate(tx ITransaction) (int64, error) {
+	path := "refreshToken.rotate"
+	args := []interface{}{rt.RevokedAt, rt.ReplacedBy, rt.Id}
+	lastInsertId, err := WriteToDB(tx, path, nil, args)
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+func (rt RefreshToken) RevokeFamily(tx ITransaction) (int64, error) {
+	path := "refreshToken.revokeFamily"
+	lastInsertId, err := WriteToDB(tx, path, nil, []interface{}{rt.RevokedAt, rt.FamilyId})
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+// Revoke every token of the user, used on logout
+func (rt RefreshToken) RevokeUser(tx ITransaction) (int64, error) {
+	path := "refreshToken.revokeUser"
+	lastInsertId, err := WriteToDB(tx, path, nil, []interface{}{rt.RevokedAt, rt.UserId})
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+func (rt *RefreshToken) ColumnMatcher(column string) interface{} {
+	switch column {
+	case "id":
+		return &rt.Id
+	case "user_id":
+		return &rt.UserId
+	case "family_id":
+		return &rt.FamilyId
+	case "token_hash":
+		return &rt.TokenHash
+	case "replaced_by":
+		return &rt.ReplacedBy
+	case "expires_at":
+		return &rt.ExpiresAt
+	case "revoked_at":
+		return &rt.RevokedAt
+	case "created_at":
+		return &rt.CreatedAt
+	default:
+		return nil
+	}
+}
+
+func (rt *RefreshToken) GetAllColumn() []interface{} {
+	return []interface{}{
+		&rt.Id,
+		&rt.UserId,
+		&rt.FamilyId,
+		&rt.TokenHash,
+		&rt.ReplacedBy,
+		&rt.ExpiresAt,
+		&rt.RevokedAt,
+		&rt.CreatedAt,
+	}
+}
+
+type RefreshTokens []RefreshToken
+
+func (rt *RefreshTokens) Get(tx ITransaction, qb *QueryBuilder) error {
+	path := "refreshTokens.get"
+	rows, err := ReadFromDB(tx, path, qb, &RefreshToken{})
+	if err != nil {
+		return err
+	}
+	if err := rt.Scan(rows, qb.SelectColumn()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (rt *RefreshTokens) Scan(rows RowsScan, selectColumn []string) error {
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		refreshToken := &RefreshToken{}
+		scanArray := dynamicScan(selectColumn, refreshToken)
+		if err := rows.Scan(scanArray...); err != nil {
+			return err
+		}
+		(*rt) = append(*rt, *refreshToken)
+		count++
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// -------- API KEY MODEL FUNCTION --------- //
+/**
+	ApiKey let a backend service publish without a user login. Only
+	the prefix is stored as is to find the key, the whole key is kept
+	as a hash. TopicIds is not a column, it come from api_key_topics
+*/
+type ApiKey struct {
+	Id int `json:"id"`
+	UserId string `json:"user_id"`
+	Name string `json:"name"`
+	Prefix string `json:"prefix"`
+	KeyHash string `json:"-"`
+	LastUsedAt int64 `json:"last_used_at"`
+	RevokedAt int64 `json:"revoked_at"`
+	CreatedAt int64 `json:"created_at"`
+	TopicIds []int `json:"topic_ids"`
+}
+
+func (ak ApiKey) InsertFormat() (string, []interface{}) {
+	return placeholderGroup(7), []interface{}{
+		ak.UserId, ak.Name, ak.Prefix, ak.KeyHash,
+		ak.LastUsedAt, ak.RevokedAt, ak.CreatedAt,
+	}
+}
+
+func (ak ApiKey) Insert(tx ITransaction) (int64, error) {
+	path := "apiKey.insert"
+	format, args := ak.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+func (ak ApiKey) UpdateFormat(updateables []string) (string, []interface{}) {
+	baseQuery := ""
+	args := []interface{}{}
+	for _, column := range updateables {
+		switch column {
+		case "name":
+			baseQuery += "name = ?,"
+			args = append(args, ak.Name)
+		case "last_used_at":
+			baseQuery += "last_used_at = ?,"
+			args = append(args, ak.LastUsedAt)
+		case "revoked_at":
+			baseQuery += "revoked_at = ?,"
+			args = append(args, ak.RevokedAt)
+		}
+	}
+	baseQuery = strings.TrimSuffix(baseQuery, ",")
+	return baseQuery, args
+}
+
+func (ak ApiKey) Update(tx ITransaction, updateables []string) (int64, error) {
+	path := "apiKey.update"
+	format, args := ak.UpdateFormat(updateables)
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, append(args, ak.Id))
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+func (ak *ApiKey) ColumnMatcher(column string) interface{} {
+	switch column {
+	case "id":
+		return &ak.Id
+	case "user_id":
+		return &ak.UserId
+	case "name":
+		return &ak.Name
+	case "prefix":
+		return &ak.Prefix
+	case "key_hash":
+		return &ak.KeyHash
+	case "last_used_at":
+		return &ak.LastUsedAt
+	case "revoked_at":
+		return &ak.RevokedAt
+	case "created_at":
+		return &ak.CreatedAt
+	default:
+		return nil
+	}
+}
+
+func (ak *ApiKey) GetAllColumn() []interface{} {
+	return []interface{}{
+		&ak.Id,
+		&ak.UserId,
+		&ak.Name,
+		&ak.Prefix,
+		&ak.KeyHash,
+		&ak.LastUsedAt,
+		&ak.RevokedAt,
+		&ak.CreatedAt,
+	}
+}
+
+type ApiKeys []ApiKey
+
+func (ak *ApiKeys) Get(tx ITransaction, qb *QueryBuilder) error {
+	path := "apiKeys.get"
+	rows, err := ReadFromDB(tx, path, qb, &ApiKey{})
+	if err != nil {
+		return err
+	}
+	if err := ak.Scan(rows, qb.SelectColumn()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (ak *ApiKeys) Scan(rows RowsScan, selectColumn []string) error {
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		apiKey := &ApiKey{}
+		scanArray := dynamicScan(selectColumn, apiKey)
+		if err := rows.Scan(scanArray...); err != nil {
+			return err
+		}
+		(*ak) = append(*ak, *apiKey)
+		count++
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Topic an api key can publish to
+type ApiKeyTopic struct {
+	Id int `json:"id"`
+	ApiKeyId int `json:"api_key_id"`
+	TopicId int `json:"topic_id"`
+}
+
+func (akt ApiKeyTopic) InsertFormat() (string, []interface{}) {
+	return placeholderGroup(2), []interface{}{akt.ApiKeyId, akt.TopicId}
+}
+
+func (akt ApiKeyTopic) Insert(tx ITransaction) (int64, error) {
+	path := "apiKeyTopic.insert"
+	format, args := akt.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+func (akt *ApiKeyTopic) ColumnMatcher(column string) interface{} {
+	switch column {
+	case "id":
+		return &akt.Id
+	case "api_key_id":
+		return &akt.ApiKeyId
+	case "topic_id":
+		return &akt.TopicId
+	default:
+		return nil
+	}
+}
+
+func (akt *ApiKeyTopic) GetAllColumn() []interface{} {
+	return []interface{}{
+		&akt.Id,
+		&akt.ApiKeyId,
+		&akt.TopicId,
+	}
+}
+
+type ApiKeyTopics []ApiKeyTopic
+
+func (akt *ApiKeyTopics) Get(tx ITransaction, qb *QueryBuilder) error {
+	path := "apiKeyTopics.get"
+	rows, err := ReadFromDB(tx, path, qb, &ApiKeyTopic{})
+	if err != nil {
+		return err
+	}
+	if err := akt.Scan(rows, qb.SelectColumn()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (akt *ApiKeyTopics) Scan(rows RowsScan, selectColumn []string) error {
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		apiKeyTopic := &ApiKeyTopic{}
+		scanArray := dynamicScan(selectColumn, apiKeyTopic)
+		if err := rows.Scan(scanArray...); err != nil {
+			return err
+		}
+		(*akt) = append(*akt, *apiKeyTopic)
+		count++
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// -------- SUBSCRIPTION REQUEST MODEL FUNCTION --------- //
+const (
+	SUBSCRIPTION_REQUEST_PENDING = "pending"
+	SUBSCRIPTION_REQUEST_APPROVED = "approved"
+	SUBSCRIPTION_REQUEST_REJECTED = "rejected"
+)
+
+var (
+	ErrAlreadyDecided = errors.New("SUBSCRIPTION REQUEST ALREADY DECIDED")
+)
+
+/**
+	Subscribing to a private topic wait for its owner. Callback URL and
+	secret are kept so the subscriber can be written as is on approval
+*/
+type SubscriptionRequest struct {
+	Id int `json:"id"`
+	TopicId int `json:"topic_id"`
+	UserId string `json:"user_id"`
+	CallbackUrl string `json:"callback_url"`
+	Secret string `json:"-"`
+	Status string `json:"status"`
+	DecidedBy string `json:"decided_by"`
+	CreatedAt int64 `json:"created_at"`
+	DecidedAt int64 `json:"decided_at"`
+}
+
+func (sr SubscriptionRequest) InsertFormat() (string, []interface{}) {
+	return placeholderGroup(6), []interface{}{sr.TopicId, sr.UserId, sr.CallbackUrl, sr.Secret, sr.Status, sr.CreatedAt}
+}
+
+func (sr SubscriptionRequest) Insert(tx ITransaction) (int64, error) {
+	path := "subscriptionRequest.insert"
+	format, args := sr.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+// Only a pending request is decided, return how many row is touched
+func (sr SubscriptionRequest) Decide(tx ITransaction) (int64, error) {
+	path := "subscriptionRequest.decide"
+	return AffectToDB(tx, path, nil, []interface{}{sr.Status, sr.DecidedBy, sr.DecidedAt, sr.Id})
+}
+
+// Subscriber written when the request is approved
+func (sr SubscriptionRequest) Subscriber() Subscriber {
+	return Subscriber{
+		TopicId: sr.TopicId,
+		UserId: sr.UserId,
+		CallbackUrl: sr.CallbackUrl,
+		Secret: sr.Secret,
+	}
+}
+
+func (sr *SubscriptionRequest) ColumnMatcher(column string) interface{} {
+	switch column {
+	case "id":
+		return &sr.Id
+	case "topic_id":
+		return &sr.TopicId
+	case "user_id":
+		return &sr.UserId
+	case "callback_url":
+		return &sr.CallbackUrl
+	case "secret":
+		return &sr.Secret
+	case "status":
+		return &sr.Status
+	case "decided_by":
+		return &sr.DecidedBy
+	case "created_at":
+		return &sr.CreatedAt
+	case "decided_at":
+		return &sr.DecidedAt
+	default:
+		return nil
+	}
+}
+
+func (sr *SubscriptionRequest) GetAllColumn() []interface{} {
+	return []interface{}{
+		&sr.Id,
+		&sr.TopicId,
+		&sr.UserId,
+		&sr.CallbackUrl,
+		&sr.Secret,
+		&sr.Status,
+		&sr.DecidedBy,
+		&sr.CreatedAt,
+		&sr.DecidedAt,
+	}
+}
+
+type SubscriptionRequests []SubscriptionRequest
+
+func (sr *SubscriptionRequests) Get(tx ITransaction, qb *QueryBuilder) error {
+	path := "subscriptionRequests.get"
+	rows, err := ReadFromDB(tx, path, qb, &SubscriptionRequest{})
+	if err != nil {
+		return err
+	}
+	if err := sr.Scan(rows, qb.SelectColumn()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (sr *SubscriptionRequests) Scan(rows RowsScan, selectColumn []string) error {
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		subscriptionRequest := &SubscriptionRequest{}
+		scanArray := dynamicScan(selectColumn, subscriptionRequest)
+		if err := rows.Scan(scanArray...); err != nil {
+			return err
+		}
+		(*sr) = append(*sr, *subscriptionRequest)
+		count++
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// -------- SCHEMA MIGRATION MODEL FUNCTION --------- //
+type SchemaMigration struct {
+	Version int64 `json:"version"`
+	Name string `json:"name"`
+	AppliedAt int64 `json:"applied_at"`
+}
+
+func CreateSchemaMigrationTable(tx ITransaction) error {
+	path := "schemaMigration.create"
+	_, err := WriteToDB(tx, path, nil, nil)
+	return err
+}
+
+func (sm SchemaMigration) InsertFormat() (string, []interface{}) {
+	return placeholderGroup(3), []interface{}{sm.Version, sm.Name, sm.AppliedAt}
+}
+
+func (sm SchemaMigration) Insert(tx ITransaction) (int64, error) {
+	path := "schemaMigration.insert"
+	format, args := sm.InsertFormat()
+	lastInsertId, err := WriteToDB(tx, path, []interface{}{format}, args)
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+func (sm SchemaMigration) Delete(tx ITransaction) (int64, error) {
+	path := "schemaMigration.delete"
+	lastInsertId, err := WriteToDB(tx, path, nil, []interface{}{sm.Version})
+	if err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
+
+func (sm *SchemaMigration) ColumnMatcher(column string) interface{} {
+	switch column {
+	case "version":
+		return &sm.Version
+	case "name":
+		return &sm.Name
+	case "applied_at":
+		return &sm.AppliedAt
+	default:
+		return nil
+	}
+}
+
+func (sm *SchemaMigration) GetAllColumn() []interface{} {
+	return []interface{}{
+		&sm.Version,
+		&sm.Name,
+		&sm.AppliedAt,
+	}
+}
+
+type SchemaMigrations []SchemaMigration
+
+func (sm *SchemaMigrations) Get(tx ITransaction, qb *QueryBuilder) error {
+	path := "schemaMigrations.get"
+	rows, err := ReadFromDB(tx, path, qb, &SchemaMigration{})
+	if err != nil {
+		return err
+	}
+	if err := sm.Scan(rows, qb.SelectColumn()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (sm *SchemaMigrations) Scan(rows RowsScan, selectColumn []string) error {
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		migration := &SchemaMigration{}
+		scanArray := dynamicScan(selectColumn, migration)
+		if err := rows.Scan(scanArray...); err != nil {
+			return err
+		}
+		(*sm) = append(*sm, *migration)
+		count++
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -3,13 +3,31 @@ package database
 import (
 	"testing"
 	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 )
 
 var (
 	db ITransactionSQL
+	sqlitePath string
 )
 
+// Every test share one SQLite file that removed after the run
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "notification-database")
+	if err != nil {
+		panic(err)
+	}
+	sqlitePath = filepath.Join(dir, "test.db")
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestConvertJsonToQueryMap(t *testing.T) {
 	dir := "queryMap.json"
 	if err := ConvertJsonToQueryMap(dir); err != nil {
@@ -22,12 +40,11 @@ func TestConvertJsonToQueryMap(t *testing.T) {
 }
 
 func TestConnectionDatabase(t *testing.T) {
-	connProp := MysqlDatabaseAccess{
-		Username: "root",
-		Password: "",
-		Protocol: "tcp",
-		Address: "localhost",
-		DBName: "try1",
+	if err := ConvertJsonToQueryMap(SQLITE_QUERY_MAP); err != nil {
+		t.Fatalf("Failed to read query map %v", err)
+	}
+	connProp := SqliteDatabaseAccess{
+		Path: sqlitePath,
 	}
 	connDB, err := connProp.ConnectDatabase()
 	if err != nil {
@@ -37,6 +54,13 @@ func TestConnectionDatabase(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to Ping")
 	}
+	migrator, err := NewMigrator(connDB, MigrationDirectory("."))
+	if err != nil {
+		t.Fatalf("Failed to load migration %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Failed to migrate %v", err)
+	}
 	db = connDB
 }
 
@@ -173,13 +197,114 @@ func TestGetTopics(t *testing.T) {
 	}
 
 	getTopics := Topics{}
-	selectColumn := []string{"id"}
+	qb := NewQueryBuilder().Select("id")
 
-	if err := getTopics.Get(db, selectColumn, [][]string{}, [][]string{}); err != nil {
+	if err := getTopics.Get(db, qb); err != nil {
 		t.Fatalf("Cannot get topics %v", err)
 	}
 
 	if len(getTopics) == 0 {
 		t.Fatalf("topics len should equal to %d, %v", 2, getTopics)
 	}
-}
\ No newline at end of file
+}
+// Record what would be sent to the database without connecting to one
+type recordTransaction struct {
+	query string
+	args []interface{}
+}
+
+type recordResult struct{}
+
+func (rr recordResult) LastInsertId() (int64, error) { return 1, nil }
+func (rr recordResult) RowsAffected() (int64, error) { return 1, nil }
+
+func (rt *recordTransaction) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	rt.query = query
+	rt.args = args
+	return nil, errors.New("recorded")
+}
+
+func (rt *recordTransaction) Exec(query string, args ...interface{}) (sql.Result, error) {
+	rt.query = query
+	rt.args = args
+	return recordResult{}, nil
+}
+
+func TestInsertWithQuote(t *testing.T) {
+	if err := ConvertJsonToQueryMap("queryMap.json"); err != nil {
+		t.Fatalf("Failed to read query map %v", err)
+	}
+	message := "it's Bob's notification"
+	notifications := Notifications{
+		Notification{UserId: "user/1", TopicId: 1, Message: message},
+		Notification{UserId: "user/2", TopicId: 1, Message: message},
+	}
+	tx := &recordTransaction{}
+	if _, err := notifications.Insert(tx); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	want := "INSERT INTO notifications (user_id, topic_id, message, created_at) VALUES (?,?,?,?),(?,?,?,?)"
+	if tx.query != want {
+		t.Fatalf("want %v get %v", want, tx.query)
+	}
+	if len(tx.args) != 8 || tx.args[2] != message || tx.args[6] != message {
+		t.Fatalf("want message bound as argument get %v", tx.args)
+	}
+}
+
+func TestUpdateWithInjection(t *testing.T) {
+	if err := ConvertJsonToQueryMap("queryMap.json"); err != nil {
+		t.Fatalf("Failed to read query map %v", err)
+	}
+	email := "x', password = '' WHERE '1' = '1"
+	user := UserProfile{Id: "user/1", Email: email}
+	tx := &recordTransaction{}
+	if _, err := user.Update(tx, []string{"email"}); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	want := "UPDATE users SET email = ? WHERE id = ?"
+	if tx.query != want {
+		t.Fatalf("want %v get %v", want, tx.query)
+	}
+	if !reflect.DeepEqual(tx.args, []interface{}{email, "user/1"}) {
+		t.Fatalf("want %v get %v", []interface{}{email, "user/1"}, tx.args)
+	}
+}
+
+func TestReadWithInjection(t *testing.T) {
+	if err := ConvertJsonToQueryMap("queryMap.json"); err != nil {
+		t.Fatalf("Failed to read query map %v", err)
+	}
+	token := "' OR '1' = '1"
+	tx := &recordTransaction{}
+	qb := NewQueryBuilder().Select("id").Where("token", "=", token)
+	ReadFromDB(tx, "users.find", qb, &UserProfile{})
+	if strings.Contains(tx.query, token) {
+		t.Fatalf("value should not be in query %v", tx.query)
+	}
+	if !reflect.DeepEqual(tx.args, []interface{}{token}) {
+		t.Fatalf("want %v get %v", []interface{}{token}, tx.args)
+	}
+}
+
+func TestRejectInvalidQueryColumn(t *testing.T) {
+	if err := ConvertJsonToQueryMap("queryMap.json"); err != nil {
+		t.Fatalf("Failed to read query map %v", err)
+	}
+	invalid := []*QueryBuilder{
+		NewQueryBuilder().Select("id; DROP TABLE users"),
+		NewQueryBuilder().Where("id = 1 OR 1", "=", "1"),
+		NewQueryBuilder().Where("id", "= 1 OR id =", "1"),
+		NewQueryBuilder().OrderBy("id; DROP TABLE users", ORDER_ASC),
+	}
+	for _, qb := range invalid {
+		tx := &recordTransaction{}
+		_, err := ReadFromDB(tx, "users.find", qb, &UserProfile{})
+		if err == nil {
+			t.Fatalf("want error get nil")
+		}
+		if len(tx.query) != 0 {
+			t.Fatalf("query should not be sent %v", tx.query)
+		}
+	}
+}
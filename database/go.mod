@@ -2,4 +2,8 @@ module github.com/humamfauzi/go-notification/database
 
 go 1.15
 
-require github.com/go-sql-driver/mysql v1.5.0
+require (
+	github.com/go-sql-driver/mysql v1.5.0
+	github.com/lib/pq v1.9.0
+	github.com/mattn/go-sqlite3 v1.14.7
+)
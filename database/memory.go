@@ -0,0 +1,1104 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDuplicateKey = errors.New("DUPLICATE KEY")
+	ErrForeignKey = errors.New("FOREIGN KEY CONSTRAINT FAILED")
+)
+
+func columnValue(model IColumnMatcher, column string) interface{} {
+	return reflect.ValueOf(model.ColumnMatcher(column)).Elem().Interface()
+}
+
+// Number and bool compared as number, string compared to number is parsed first
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func compareValue(a, b interface{}) int {
+	numberA, okA := numericValue(a)
+	numberB, okB := numericValue(b)
+	if okA != okB {
+		if !okA {
+			numberA, okA = parseNumber(a)
+		} else {
+			numberB, okB = parseNumber(b)
+		}
+	}
+	if okA && okB {
+		switch {
+		case numberA < numberB:
+			return -1
+		case numberA > numberB:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func parseNumber(value interface{}) (float64, bool) {
+	number, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+	return number, err == nil
+}
+
+/**
+	Same as SQLite and MySQL default, LIKE does not care about case.
+	Character after escape is taken as is, zero escape mean none
+*/
+func likeValue(value, pattern interface{}, escape rune) bool {
+	expression := "(?is)^"
+	escaped := false
+	for _, char := range fmt.Sprint(pattern) {
+		if escaped {
+			expression += regexp.QuoteMeta(string(char))
+			escaped = false
+			continue
+		}
+		switch char {
+		case escape:
+			escaped = true
+		case '%':
+			expression += ".*"
+		case '_':
+			expression += "."
+		default:
+			expression += regexp.QuoteMeta(string(char))
+		}
+	}
+	matched, _ := regexp.MatchString(expression+"$", fmt.Sprint(value))
+	return matched
+}
+
+func (c condition) match(model IColumnMatcher) bool {
+	if c.group != nil {
+		return c.group.match(model)
+	}
+	switch c.operator {
+	case "IS NULL":
+		return false
+	case "IS NOT NULL":
+		return true
+	}
+	value := columnValue(model, c.column)
+	switch c.operator {
+	case "IN":
+		for _, arg := range c.args {
+			if compareValue(value, arg) == 0 {
+				return true
+			}
+		}
+		return false
+	case "LIKE":
+		return likeValue(value, c.args[0], 0)
+	case "NOT LIKE":
+		return !likeValue(value, c.args[0], 0)
+	case "CONTAINS":
+		return likeValue(value, c.args[0], rune(LIKE_ESCAPE[0]))
+	}
+	compared := compareValue(value, c.args[0])
+	switch c.operator {
+	case "=":
+		return compared == 0
+	case "!=", "<>":
+		return compared != 0
+	case "<":
+		return compared < 0
+	case "<=":
+		return compared <= 0
+	case ">":
+		return compared > 0
+	case ">=":
+		return compared >= 0
+	}
+	return false
+}
+
+/**
+	AND is evaluated before OR like in SQL, so the condition is
+	split into chain of AND and the row match when any chain match
+*/
+func (qb *QueryBuilder) match(model IColumnMatcher) bool {
+	if len(qb.conditions) == 0 {
+		return true
+	}
+	chain := true
+	for i, c := range qb.conditions {
+		if i > 0 && c.connector == "OR" {
+			if chain {
+				return true
+			}
+			chain = true
+		}
+		chain = chain && c.match(model)
+	}
+	return chain
+}
+
+/**
+	Filter, order, page and project rows the same way the query
+	builder would do it in SQL. newRow create an empty model for
+	the projection of the selected column
+*/
+func selectRows(qb *QueryBuilder, rows []IColumnMatcher, newRow func() IColumnMatcher) ([]IColumnMatcher, error) {
+	if _, _, _, err := qb.Build(newRow()); err != nil {
+		return nil, err
+	}
+	matched := []IColumnMatcher{}
+	for _, row := range rows {
+		if qb.match(row) {
+			matched = append(matched, row)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		for _, order := range qb.orders {
+			compared := compareValue(columnValue(matched[i], order.column), columnValue(matched[j], order.column))
+			if compared == 0 {
+				continue
+			}
+			if order.direction == ORDER_DESC {
+				return compared > 0
+			}
+			return compared < 0
+		}
+		return false
+	})
+	if qb.offset > 0 {
+		if qb.offset >= len(matched) {
+			matched = matched[:0]
+		} else {
+			matched = matched[qb.offset:]
+		}
+	}
+	if qb.limit > 0 && qb.limit < len(matched) {
+		matched = matched[:qb.limit]
+	}
+	selectColumn := qb.SelectColumn()
+	projected := make([]IColumnMatcher, len(matched))
+	for i, row := range matched {
+		projected[i] = newRow()
+		if len(selectColumn) == 1 && selectColumn[0] == "*" {
+			reflect.ValueOf(projected[i]).Elem().Set(reflect.ValueOf(row).Elem())
+			continue
+		}
+		for _, column := range selectColumn {
+			reflect.ValueOf(projected[i].ColumnMatcher(column)).Elem().Set(reflect.ValueOf(row.ColumnMatcher(column)).Elem())
+		}
+	}
+	if len(projected) == 0 {
+		return projected, sql.ErrNoRows
+	}
+	return projected, nil
+}
+
+/**
+	MemoryStore keep users, topics, subscribers and notifications in
+	memory so handler can be tested without any database. Id and foreign
+	key behave like the SQL schema. Delivery job is only kept, nothing
+	deliver it
+*/
+type MemoryStore struct {
+	mutex sync.Mutex
+	users []*UserProfile
+	topics []*Topic
+	subscribers []*Subscriber
+	notifications []*Notification
+	jobs []*DeliveryJob
+	topicMembers []*TopicMember
+	subscriptionRequests []*SubscriptionRequest
+	auditLogs []*AuditLog
+	refreshTokens []*RefreshToken
+	apiKeys []*ApiKey
+	apiKeyTopics []*ApiKeyTopic
+	topicTags []*TopicTag
+	lastId map[string]int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		lastId: make(map[string]int),
+	}
+}
+
+func (ms *MemoryStore) nextId(table string) int {
+	ms.lastId[table]++
+	return ms.lastId[table]
+}
+
+func (ms *MemoryStore) userExist(id string) bool {
+	for _, user := range ms.users {
+		if user.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (ms *MemoryStore) topicExist(id int) bool {
+	for _, topic := range ms.topics {
+		if topic.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (ms *MemoryStore) InsertUser(user UserProfile) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if ms.userExist(user.Id) {
+		return fmt.Errorf("%w users.id %v", ErrDuplicateKey, user.Id)
+	}
+	// token is not part of the insert and role has a default
+	user.Token = ""
+	user.Role = USER_ROLE_USER
+	ms.users = append(ms.users, &user)
+	return nil
+}
+
+func (ms *MemoryStore) FindUser(qb *QueryBuilder) (UserProfile, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	rows := make([]IColumnMatcher, len(ms.users))
+	for i := range ms.users {
+		rows[i] = ms.users[i]
+	}
+	selected, err := selectRows(qb, rows, func() IColumnMatcher { return &UserProfile{} })
+	if err != nil {
+		return UserProfile{}, err
+	}
+	// Scan keep the last row
+	return *selected[len(selected)-1].(*UserProfile), nil
+}
+
+func (ms *MemoryStore) UpdateUser(user UserProfile, updateables []string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	for _, stored := range ms.users {
+		if stored.Id != user.Id {
+			continue
+		}
+		for _, column := range user.UpdateColumns(updateables) {
+			reflect.ValueOf(stored.ColumnMatcher(column)).Elem().Set(reflect.ValueOf(user.ColumnMatcher(column)).Elem())
+		}
+	}
+	return nil
+}
+
+// Same cascade as SQLStore, owned topics are purged instead of soft deleted
+func (ms *MemoryStore) DeleteUser(user UserProfile) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	purged := make(map[int]bool)
+	topics := []*Topic{}
+	for _, topic := range ms.topics {
+		if topic.UserId == user.Id {
+			purged[topic.Id] = true
+			continue
+		}
+		topics = append(topics, topic)
+	}
+	ms.topics = topics
+	removed := make(map[int]bool)
+	subscribers := []*Subscriber{}
+	for _, subscriber := range ms.subscribers {
+		if subscriber.UserId == user.Id || purged[subscriber.TopicId] {
+			removed[subscriber.Id] = true
+			continue
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+	ms.subscribers = subscribers
+	jobs := []*DeliveryJob{}
+	for _, job := range ms.jobs {
+		if !removed[job.SubscriberId] {
+			jobs = append(jobs, job)
+		}
+	}
+	ms.jobs = jobs
+	deleted := make(map[int]bool)
+	for _, notification := range ms.notifications {
+		if notification.UserId == user.Id || purged[notification.TopicId] {
+			deleted[notification.Id] = true
+		}
+	}
+	ms.removeNotifications(deleted)
+	for i, stored := range ms.users {
+		if stored.Id == user.Id {
+			ms.users = append(ms.users[:i], ms.users[i+1:]...)
+			break
+		}
+	}
+	// refresh_tokens.user_id is ON DELETE CASCADE
+	refreshTokens := []*RefreshToken{}
+	for _, refreshToken := range ms.refreshTokens {
+		if refreshToken.UserId != user.Id {
+			refreshTokens = append(refreshTokens, refreshToken)
+		}
+	}
+	ms.refreshTokens = refreshTokens
+	// topic_members.user_id is ON DELETE CASCADE
+	topicMembers := []*TopicMember{}
+	for _, topicMember := range ms.topicMembers {
+		if topicMember.UserId != user.Id && !purged[topicMember.TopicId] {
+			topicMembers = append(topicMembers, topicMember)
+		}
+	}
+	ms.topicMembers = topicMembers
+	// subscription_requests.user_id is ON DELETE CASCADE
+	subscriptionRequests := []*SubscriptionRequest{}
+	for _, subscriptionRequest := range ms.subscriptionRequests {
+		if subscriptionRequest.UserId != user.Id && !purged[subscriptionRequest.TopicId] {
+			subscriptionRequests = append(subscriptionRequests, subscriptionRequest)
+		}
+	}
+	ms.subscriptionRequests = subscriptionRequests
+	topicTags := []*TopicTag{}
+	for _, topicTag := range ms.topicTags {
+		if !purged[topicTag.TopicId] {
+			topicTags = append(topicTags, topicTag)
+		}
+	}
+	ms.topicTags = topicTags
+	// api_keys.user_id and api_key_topics.api_key_id are ON DELETE CASCADE
+	apiKeys := []*ApiKey{}
+	revoked := make(map[int]bool)
+	for _, apiKey := range ms.apiKeys {
+		if apiKey.UserId == user.Id {
+			revoked[apiKey.Id] = true
+			continue
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+	ms.apiKeys = apiKeys
+	apiKeyTopics := []*ApiKeyTopic{}
+	for _, apiKeyTopic := range ms.apiKeyTopics {
+		if !revoked[apiKeyTopic.ApiKeyId] && !purged[apiKeyTopic.TopicId] {
+			apiKeyTopics = append(apiKeyTopics, apiKeyTopic)
+		}
+	}
+	ms.apiKeyTopics = apiKeyTopics
+	return nil
+}
+
+func (ms *MemoryStore) InsertTopic(topic Topic) (int64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if !ms.userExist(topic.UserId) {
+		return 0, fmt.Errorf("%w topics.user_id %v", ErrForeignKey, topic.UserId)
+	}
+	topic.Id = ms.nextId("topics")
+	ms.replaceTopicTags(topic.Id, topic.Tags)
+	// tag is only kept in topic_tags, same as the database
+	topic.Tags = nil
+	ms.topics = append(ms.topics, &topic)
+	ms.topicMembers = append(ms.topicMembers, &TopicMember{
+		Id: ms.nextId("topic_members"),
+		TopicId: topic.Id,
+		UserId: topic.UserId,
+		Role: TOPIC_ROLE_OWNER,
+		InvitedBy: topic.UserId,
+		CreatedAt: time.Now().Unix(),
+	})
+	return int64(topic.Id), nil
+}
+
+func (ms *MemoryStore) GetTopics(qb *QueryBuilder) (Topics, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	rows := make([]IColumnMatcher, len(ms.topics))
+	for i := range ms.topics {
+		rows[i] = ms.topics[i]
+	}
+	selected, err := selectRows(qb, rows, func() IColumnMatcher { return &Topic{} })
+	topics := Topics{}
+	for _, row := range selected {
+		topics = append(topics, *row.(*Topic))
+	}
+	return topics, err
+}
+
+func (ms *MemoryStore) UpdateTopic(topic Topic, updateables []string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	for _, stored := range ms.topics {
+		if stored.Id != topic.Id {
+			continue
+		}
+		for _, column := range topic.UpdateColumns(updateables) {
+			reflect.ValueOf(stored.ColumnMatcher(column)).Elem().Set(reflect.ValueOf(topic.ColumnMatcher(column)).Elem())
+		}
+	}
+	for _, column := range updateables {
+		if column == "tags" {
+			ms.replaceTopicTags(topic.Id, topic.Tags)
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStore) replaceTopicTags(topicId int, tags []string) {
+	kept := []*TopicTag{}
+	for _, stored := range ms.topicTags {
+		if stored.TopicId != topicId {
+			kept = append(kept, stored)
+		}
+	}
+	for _, tag := range tags {
+		kept = append(kept, &TopicTag{Id: ms.nextId("topic_tags"), TopicId: topicId, Tag: tag})
+	}
+	ms.topicTags = kept
+}
+
+func (ms *MemoryStore) GetTopicTags(qb *QueryBuilder) (TopicTags, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	rows := make([]IColumnMatcher, len(ms.topicTags))
+	for i := range ms.topicTags {
+		rows[i] = ms.topicTags[i]
+	}
+	selected, err := selectRows(qb, rows, func() IColumnMatcher { return &TopicTag{} })
+	topicTags := TopicTags{}
+	for _, row := range selected {
+		topicTags = append(topicTags, *row.(*TopicTag))
+	}
+	return topicTags, err
+}
+
+// Both count is computed here like the subquery of topics.search
+func (ms *MemoryStore) SearchTopics(qb *QueryBuilder) (TopicStats, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	rows := make([]IColumnMatcher, len(ms.topics))
+	for i, topic := range ms.topics {
+		topicStat := &TopicStat{Topic: *topic}
+		for _, subscriber := range ms.subscribers {
+			if subscriber.TopicId == topic.Id {
+				topicStat.SubscriberCount++
+			}
+		}
+		for _, notification := range ms.notifications {
+			if notification.TopicId == topic.Id && notification.CreatedAt > topicStat.LastActivityAt {
+				topicStat.LastActivityAt = notification.CreatedAt
+			}
+		}
+		rows[i] = topicStat
+	}
+	selected, err := selectRows(qb, rows, func() IColumnMatcher { return &TopicStat{} })
+	topicStats := TopicStats{}
+	for _, row := range selected {
+		topicStats = append(topicStats, *row.(*TopicStat))
+	}
+	return topicStats, err
+}
+
+func (ms *MemoryStore) DeleteTopic(topic Topic) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	removed := make(map[int]bool)
+	subscribers := []*Subscriber{}
+	for _, stored := range ms.subscribers {
+		if stored.TopicId == topic.Id {
+			removed[stored.Id] = true
+			continue
+		}
+		subscribers = append(subscribers, stored)
+	}
+	ms.subscribers = subscribers
+	jobs := []*DeliveryJob{}
+	for _, job := range ms.jobs {
+		if !removed[job.SubscriberId] {
+			jobs = append(jobs, job)
+		}
+	}
+	ms.jobs = jobs
+	for _, stored := range ms.topics {
+		if stored.Id == topic.Id {
+			stored.DeletedAt = topic.DeletedAt
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStore) CountSubscribers(topicId int) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	count := 0
+	for _, stored := range ms.subscribers {
+		if stored.TopicId == topicId {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (ms *MemoryStore) InsertSubscriber(subscriber Subscriber) (int64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if !ms.topicExist(subscriber.TopicId) {
+		return 0, fmt.Errorf("%w subscribers.topic_id %v", ErrForeignKey, subscriber.TopicId)
+	}
+	if !ms.userExist(subscriber.UserId) {
+		return 0, fmt.Errorf("%w subscribers.user_id %v", ErrForeignKey, subscriber.UserId)
+	}
+	if ms.findSubscriber(subscriber) != nil {
+		return 0, fmt.Errorf("%w subscribers %v %v", ErrDuplicateKey, subscriber.TopicId, subscriber.UserId)
+	}
+	subscriber.Id = ms.nextId("subscribers")
+	ms.subscribers = append(ms.subscribers, &subscriber)
+	return int64(subscriber.Id), nil
+}
+
+// Same topic and user, or same unsubscribe token
+func (ms *MemoryStore) findSubscriber(subscriber Subscriber) *Subscriber {
+	for _, stored := range ms.subscribers {
+		if stored.TopicId == subscriber.TopicId && stored.UserId == subscriber.UserId {
+			return stored
+		}
+		if len(subscriber.UnsubscribeToken) != 0 && stored.UnsubscribeToken == subscriber.UnsubscribeToken {
+			return stored
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStore) DeleteSubscriber(subscriber Subscriber) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	jobs := []*DeliveryJob{}
+	for _, job := range ms.jobs {
+		if job.SubscriberId != subscriber.Id {
+			jobs = append(jobs, job)
+		}
+	}
+	ms.jobs = jobs
+	for i, stored := range ms.subscribers {
+		if stored.Id == subscriber.Id {
+			ms.subscribers = append(ms.subscribers[:i], ms.subscribers[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStore) GetSubscribers(qb *QueryBuilder) (Subscribers, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	rows := make([]IColumnMatcher, len(ms.subscribers))
+	for i := range ms.subscribers {
+		rows[i] = ms.subscribers[i]
+	}
+	selected, err := selectRows(qb, rows, func() IColumnMatcher { return &Subscriber{} })
+	subscribers := Subscribers{}
+	for _, row := range selected {
+		subscribers = append(subscribers, *row.(*Subscriber))
+	}
+	return subscribers, err
+}
+
+// Nothing is kept when one of the notification fail, like a transaction
+func (ms *MemoryStore) InsertNotifications(notifications Notifications, jobFor func(notification Notification) (*DeliveryJob, error)) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	lastId := ms.lastId["notifications"]
+	lastJobId := ms.lastId["delivery_jobs"]
+	inserted := []*Notification{}
+	jobs := []*DeliveryJob{}
+	for i := 0; i < len(notifications); i++ {
+		if !ms.userExist(notifications[i].UserId) || !ms.topicExist(notifications[i].TopicId) {
+			ms.lastId["notifications"] = lastId
+			ms.lastId["delivery_jobs"] = lastJobId
+			return fmt.Errorf("%w notifications %v", ErrForeignKey, notifications[i])
+		}
+		notifications[i].Id = ms.nextId("notifications")
+		notifications[i].IsRead = false
+		notification := notifications[i]
+		notification.UnsubscribeToken = ""
+		inserted = append(inserted, &notification)
+		job, err := jobFor(notifications[i])
+		if err != nil {
+			ms.lastId["notifications"] = lastId
+			ms.lastId["delivery_jobs"] = lastJobId
+			return err
+		}
+		if job != nil {
+			job.Id = ms.nextId("delivery_jobs")
+			jobs = append(jobs, job)
+		}
+	}
+	ms.notifications = append(ms.notifications, inserted...)
+	ms.jobs = append(ms.jobs, jobs...)
+	return nil
+}
+
+func (ms *MemoryStore) GetNotifications(qb *QueryBuilder) (Notifications, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	rows := make([]IColumnMatcher, len(ms.notifications))
+	for i := range ms.notifications {
+		rows[i] = ms.notifications[i]
+	}
+	selected, err := selectRows(qb, rows, func() IColumnMatcher { return &Notification{} })
+	notifications := Notifications{}
+	for _, row := range selected {
+		notifications = append(notifications, *row.(*Notification))
+	}
+	return notifications, err
+}
+
+func (ms *MemoryStore) UpdateReadNotification(notifications Notifications) (int64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	updated := int64(0)
+	for _, notification := range notifications {
+		for _, stored := range ms.notifications {
+			if stored.Id == notification.Id && !stored.IsRead {
+				stored.IsRead = true
+				updated++
+			}
+		}
+	}
+	return updated, nil
+}
+
+func (ms *MemoryStore) CountUnreadNotifications(userId string) (UnreadCounts, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	counts := make(map[int]int)
+	for _, stored := range ms.notifications {
+		if stored.UserId == userId && !stored.IsRead {
+			counts[stored.TopicId]++
+		}
+	}
+	unreadCounts := UnreadCounts{}
+	for topicId, count := range counts {
+		unreadCounts = append(unreadCounts, UnreadCount{TopicId: topicId, Count: count})
+	}
+	sort.Slice(unreadCounts, func(i, j int) bool {
+		return unreadCounts[i].TopicId < unreadCounts[j].TopicId
+	})
+	return unreadCounts, nil
+}
+
+func (ms *MemoryStore) DeleteNotifications(notifications Notifications) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	deleted := make(map[int]bool)
+	for _, notification := range notifications {
+		deleted[notification.Id] = true
+	}
+	ms.removeNotifications(deleted)
+	return nil
+}
+
+func (ms *MemoryStore) UpdateReadUserNotifications(userNotifications UserNotifications) (int64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	var updated int64
+	for _, stored := range ms.notifications {
+		if userNotifications.has(*stored) && !stored.IsRead {
+			stored.IsRead = true
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+func (ms *MemoryStore) DeleteUserNotifications(userNotifications UserNotifications) (int64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	deleted := make(map[int]bool)
+	for _, stored := range ms.notifications {
+		if userNotifications.has(*stored) {
+			deleted[stored.Id] = true
+		}
+	}
+	ms.removeNotifications(deleted)
+	return int64(len(deleted)), nil
+}
+
+// Caller hold the mutex, job of the notification go together with it
+func (ms *MemoryStore) removeNotifications(deleted map[int]bool) {
+	kept := []*Notification{}
+	for _, stored := range ms.notifications {
+		if !deleted[stored.Id] {
+			kept = append(kept, stored)
+		}
+	}
+	ms.notifications = kept
+	jobs := []*DeliveryJob{}
+	for _, job := range ms.jobs {
+		if !deleted[job.NotificationId] {
+			jobs = append(jobs, job)
+		}
+	}
+	ms.jobs = jobs
+}
+
+func (ms *MemoryStore) InsertTopicMember(topicMember TopicMember) (int64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if !ms.topicExist(topicMember.TopicId) {
+		return 0, fmt.Errorf("%w topic_members.topic_id %v", ErrForeignKey, topicMember.TopicId)
+	}
+	if !ms.userExist(topicMember.UserId) {
+		return 0, fmt.Errorf("%w topic_members.user_id %v", ErrForeignKey, topicMember.UserId)
+	}
+	if ms.findTopicMember(topicMember.TopicId, topicMember.UserId) != nil {
+		return 0, fmt.Errorf("%w topic_members %v %v", ErrDuplicateKey, topicMember.TopicId, topicMember.UserId)
+	}
+	topicMember.Id = ms.nextId("topic_members")
+	ms.topicMembers = append(ms.topicMembers, &topicMember)
+	return int64(topicMember.Id), nil
+}
+
+func (ms *MemoryStore) findTopicMember(topicId int, userId string) *TopicMember {
+	for _, stored := range ms.topicMembers {
+		if stored.TopicId == topicId && stored.UserId == userId {
+			return stored
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStore) GetTopicMembers(qb *QueryBuilder) (TopicMembers, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	rows := make([]IColumnMatcher, len(ms.topicMembers))
+	for i := range ms.topicMembers {
+		rows[i] = ms.topicMembers[i]
+	}
+	selected, err := selectRows(qb, rows, func() IColumnMatcher { return &TopicMember{} })
+	topicMembers := TopicMembers{}
+	for _, row := range selected {
+		topicMembers = append(topicMembers, *row.(*TopicMember))
+	}
+	return topicMembers, err
+}
+
+func (ms *MemoryStore) UpdateTopicMemberRole(topicMember TopicMember) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if stored := ms.findTopicMember(topicMember.TopicId, topicMember.UserId); stored != nil {
+		stored.Role = topicMember.Role
+	}
+	return nil
+}
+
+func (ms *MemoryStore) DeleteTopicMember(topicMember TopicMember) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	for i, stored := range ms.topicMembers {
+		if stored.TopicId == topicMember.TopicId && stored.UserId == topicMember.UserId {
+			ms.topicMembers = append(ms.topicMembers[:i], ms.topicMembers[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStore) TransferTopicOwnership(topicId int, from string, to string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if !ms.userExist(to) {
+		return fmt.Errorf("%w topics.user_id %v", ErrForeignKey, to)
+	}
+	for _, topic := range ms.topics {
+		if topic.Id == topicId {
+			topic.UserId = to
+		}
+	}
+	if stored := ms.findTopicMember(topicId, to); stored != nil {
+		stored.Role = TOPIC_ROLE_OWNER
+	}
+	if stored := ms.findTopicMember(topicId, from); stored != nil {
+		stored.Role = TOPIC_ROLE_ADMIN
+	}
+	return nil
+}
+
+func (ms *MemoryStore) InsertSubscriptionRequest(subscriptionRequest SubscriptionRequest) (int64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if !ms.topicExist(subscriptionRequest.TopicId) {
+		return 0, fmt.Errorf("%w subscription_requests.topic_id %v", ErrForeignKey, subscriptionRequest.TopicId)
+	}
+	if !ms.userExist(subscriptionRequest.UserId) {
+		return 0, fmt.Errorf("%w subscription_requests.user_id %v", ErrForeignKey, subscriptionRequest.UserId)
+	}
+	subscriptionRequest.Id = ms.nextId("subscription_requests")
+	subscriptionRequest.DecidedBy = ""
+	subscriptionRequest.DecidedAt = 0
+	ms.subscriptionRequests = append(ms.subscriptionRequests, &subscriptionRequest)
+	return int64(subscriptionRequest.Id), nil
+}
+
+func (ms *MemoryStore) GetSubscriptionRequests(qb *QueryBuilder) (SubscriptionRequests, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	rows := make([]IColumnMatcher, len(ms.subscriptionRequests))
+	for i := range ms.subscriptionRequests {
+		rows[i] = ms.subscriptionRequests[i]
+	}
+	selected, err := selectRows(qb, rows, func() IColumnMatcher { return &SubscriptionRequest{} })
+	subscriptionRequests := SubscriptionRequests{}
+	for _, row := range selected {
+		subscriptionRequests = append(subscriptionRequests, *row.(*SubscriptionRequest))
+	}
+	return subscriptionRequests, err
+}
+
+func (ms *MemoryStore) DecideSubscriptionRequest(subscriptionRequest SubscriptionRequest, subscriber Subscriber) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	var stored *SubscriptionRequest
+	for _, candidate := range ms.subscriptionRequests {
+		if candidate.Id == subscriptionRequest.Id {
+			stored = candidate
+		}
+	}
+	if stored == nil || stored.Status != SUBSCRIPTION_REQUEST_PENDING {
+		return ErrAlreadyDecided
+	}
+	if subscriptionRequest.Status == SUBSCRIPTION_REQUEST_APPROVED {
+		if !ms.topicExist(stored.TopicId) {
+			return fmt.Errorf("%w subscribers.topic_id %v", ErrForeignKey, stored.TopicId)
+		}
+		if ms.findSubscriber(subscriber) != nil {
+			return fmt.Errorf("%w subscribers %v %v", ErrDuplicateKey, subscriber.TopicId, subscriber.UserId)
+		}
+		subscriber.Id = ms.nextId("subscribers")
+		ms.subscribers = append(ms.subscribers, &subscriber)
+		if ms.findTopicMember(stored.TopicId, stored.UserId) == nil {
+			ms.topicMembers = append(ms.topicMembers, &TopicMember{
+				Id: ms.nextId("topic_members"),
+				TopicId: stored.TopicId,
+				UserId: stored.UserId,
+				Role: TOPIC_ROLE_SUBSCRIBER,
+				InvitedBy: subscriptionRequest.DecidedBy,
+				CreatedAt: subscriptionRequest.DecidedAt,
+			})
+		}
+	}
+	stored.Status = subscriptionRequest.Status
+	stored.DecidedBy = subscriptionRequest.DecidedBy
+	stored.DecidedAt = subscriptionRequest.DecidedAt
+	return nil
+}
+
+func (ms *MemoryStore) InsertAuditLog(auditLog AuditLog) (int64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	auditLog.Id = ms.nextId("audit_logs")
+	ms.auditLogs = append(ms.auditLogs, &auditLog)
+	return int64(auditLog.Id), nil
+}
+
+func (ms *MemoryStore) GetAuditLogs(qb *QueryBuilder) (AuditLogs, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	rows := make([]IColumnMatcher, len(ms.auditLogs))
+	for i := range ms.auditLogs {
+		rows[i] = ms.auditLogs[i]
+	}
+	selected, err := selectRows(qb, rows, func() IColumnMatcher { return &AuditLog{} })
+	auditLogs := AuditLogs{}
+	for _, row := range selected {
+		auditLogs = append(auditLogs, *row.(*AuditLog))
+	}
+	return auditLogs, err
+}
+
+// Delivery job written with notification, there is no queue in memory
+func (ms *MemoryStore) InsertRefreshToken(refreshToken RefreshToken) (int64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	return ms.insertRefreshToken(refreshToken)
+}
+
+func (ms *MemoryStore) insertRefreshToken(refreshToken RefreshToken) (int64, error) {
+	if !ms.userExist(refreshToken.UserId) {
+		return 0, fmt.Errorf("%w refresh_tokens.user_id %v", ErrForeignKey, refreshToken.UserId)
+	}
+	for _, stored := range ms.refreshTokens {
+		if stored.TokenHash == refreshToken.TokenHash {
+			return 0, fmt.Errorf("%w refresh_tokens.token_hash", ErrDuplicateKey)
+		}
+	}
+	refreshToken.Id = ms.nextId("refresh_tokens")
+	ms.refreshTokens = append(ms.refreshTokens, &refreshToken)
+	return int64(refreshToken.Id), nil
+}
+
+func (ms *MemoryStore) GetRefreshTokens(qb *QueryBuilder) (RefreshTokens, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	rows := make([]IColumnMatcher, len(ms.refreshTokens))
+	for i := range ms.refreshTokens {
+		rows[i] = ms.refreshTokens[i]
+	}
+	selected, err := selectRows(qb, rows, func() IColumnMatcher { return &RefreshToken{} })
+	refreshTokens := RefreshTokens{}
+	for _, row := range selected {
+		refreshTokens = append(refreshTokens, *row.(*RefreshToken))
+	}
+	return refreshTokens, err
+}
+
+func (ms *MemoryStore) RotateRefreshToken(current RefreshToken, next RefreshToken) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	for _, stored := range ms.refreshTokens {
+		if stored.Id != current.Id {
+			continue
+		}
+		if stored.RevokedAt != 0 {
+			return ErrRefreshTokenReused
+		}
+		if _, err := ms.insertRefreshToken(next); err != nil {
+			return err
+		}
+		stored.RevokedAt = next.CreatedAt
+		stored.ReplacedBy = next.TokenHash
+		return nil
+	}
+	return sql.ErrNoRows
+}
+
+func (ms *MemoryStore) RevokeRefreshTokenFamily(familyId string, revokedAt int64) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	for _, stored := range ms.refreshTokens {
+		if stored.FamilyId == familyId && stored.RevokedAt == 0 {
+			stored.RevokedAt = revokedAt
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStore) RevokeUserRefreshTokens(userId string, revokedAt int64) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	for _, stored := range ms.refreshTokens {
+		if stored.UserId == userId && stored.RevokedAt == 0 {
+			stored.RevokedAt = revokedAt
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStore) InsertApiKey(apiKey ApiKey) (int64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if !ms.userExist(apiKey.UserId) {
+		return 0, fmt.Errorf("%w api_keys.user_id %v", ErrForeignKey, apiKey.UserId)
+	}
+	for _, stored := range ms.apiKeys {
+		if stored.Prefix == apiKey.Prefix {
+			return 0, fmt.Errorf("%w api_keys.prefix %v", ErrDuplicateKey, apiKey.Prefix)
+		}
+	}
+	for _, topicId := range apiKey.TopicIds {
+		if !ms.topicExist(topicId) {
+			return 0, fmt.Errorf("%w api_key_topics.topic_id %v", ErrForeignKey, topicId)
+		}
+	}
+	apiKey.Id = ms.nextId("api_keys")
+	for _, topicId := range apiKey.TopicIds {
+		ms.apiKeyTopics = append(ms.apiKeyTopics, &ApiKeyTopic{
+			Id: ms.nextId("api_key_topics"),
+			ApiKeyId: apiKey.Id,
+			TopicId: topicId,
+		})
+	}
+	// topic is only kept in api_key_topics, same as the database
+	apiKey.TopicIds = nil
+	ms.apiKeys = append(ms.apiKeys, &apiKey)
+	return int64(apiKey.Id), nil
+}
+
+func (ms *MemoryStore) GetApiKeys(qb *QueryBuilder) (ApiKeys, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	rows := make([]IColumnMatcher, len(ms.apiKeys))
+	for i := range ms.apiKeys {
+		rows[i] = ms.apiKeys[i]
+	}
+	selected, err := selectRows(qb, rows, func() IColumnMatcher { return &ApiKey{} })
+	apiKeys := ApiKeys{}
+	for _, row := range selected {
+		apiKeys = append(apiKeys, *row.(*ApiKey))
+	}
+	return apiKeys, err
+}
+
+func (ms *MemoryStore) UpdateApiKey(apiKey ApiKey, updateables []string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	for _, stored := range ms.apiKeys {
+		if stored.Id != apiKey.Id {
+			continue
+		}
+		for _, column := range updateables {
+			switch column {
+			case "name":
+				stored.Name = apiKey.Name
+			case "last_used_at":
+				stored.LastUsedAt = apiKey.LastUsedAt
+			case "revoked_at":
+				stored.RevokedAt = apiKey.RevokedAt
+			}
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStore) GetApiKeyTopics(qb *QueryBuilder) (ApiKeyTopics, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	rows := make([]IColumnMatcher, len(ms.apiKeyTopics))
+	for i := range ms.apiKeyTopics {
+		rows[i] = ms.apiKeyTopics[i]
+	}
+	selected, err := selectRows(qb, rows, func() IColumnMatcher { return &ApiKeyTopic{} })
+	apiKeyTopics := ApiKeyTopics{}
+	for _, row := range selected {
+		apiKeyTopics = append(apiKeyTopics, *row.(*ApiKeyTopic))
+	}
+	return apiKeyTopics, err
+}
+
+func (ms *MemoryStore) DeliveryJobs() DeliveryJobs {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	jobs := DeliveryJobs{}
+	for _, job := range ms.jobs {
+		jobs = append(jobs, *job)
+	}
+	return jobs
+}
@@ -0,0 +1,335 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func memoryStoreWithTopic(t *testing.T) (*MemoryStore, int) {
+	ms := NewMemoryStore()
+	for _, user := range []UserProfile{
+		UserProfile{Id: "user/1", Email: "a@a.a", Password: "secret"},
+		UserProfile{Id: "user/2", Email: "b@b.b", Password: "secret"},
+	} {
+		if err := ms.InsertUser(user); err != nil {
+			t.Fatalf("Failed to insert user %v", err)
+		}
+	}
+	topicId, err := ms.InsertTopic(Topic{UserId: "user/1", Title: "first"})
+	if err != nil {
+		t.Fatalf("Failed to insert topic %v", err)
+	}
+	return ms, int(topicId)
+}
+
+func TestMemoryStoreQuery(t *testing.T) {
+	ms, topicId := memoryStoreWithTopic(t)
+	notifications := Notifications{
+		Notification{UserId: "user/1", TopicId: topicId, Message: "hello world"},
+		Notification{UserId: "user/2", TopicId: topicId, Message: "hello there"},
+		Notification{UserId: "user/1", TopicId: topicId, Message: "bye"},
+		Notification{UserId: "user/2", TopicId: topicId, Message: "bye"},
+	}
+	noJob := func(Notification) (*DeliveryJob, error) { return nil, nil }
+	if err := ms.InsertNotifications(notifications, noJob); err != nil {
+		t.Fatalf("Failed to insert notification %v", err)
+	}
+	if notifications[3].Id != 4 {
+		t.Fatalf("want 4 get %v", notifications[3].Id)
+	}
+
+	// AND before OR, same as SQL
+	qb := NewQueryBuilder().
+		Where("user_id", "=", "user/2").
+		Where("message", "=", "bye").
+		Or().
+		Where("id", "=", 1).
+		OrderBy("id", ORDER_DESC)
+	result, err := ms.GetNotifications(qb)
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if len(result) != 2 || result[0].Id != 4 || result[1].Id != 1 {
+		t.Fatalf("want id 4 and 1 get %v", result)
+	}
+
+	qb = NewQueryBuilder().
+		Select("id").
+		Where("message", "LIKE", "HELLO%").
+		Group(func(g *QueryBuilder) {
+			g.Where("user_id", "=", "user/1").Or().In("id", 2, 3)
+		}).
+		Limit(1).
+		Offset(1)
+	result, err = ms.GetNotifications(qb)
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if len(result) != 1 || result[0].Id != 2 || len(result[0].Message) != 0 {
+		t.Fatalf("want only id 2 get %v", result)
+	}
+
+	qb = NewQueryBuilder().Where("user_id", "=", "user/3")
+	if _, err := ms.GetNotifications(qb); err != sql.ErrNoRows {
+		t.Fatalf("want %v get %v", sql.ErrNoRows, err)
+	}
+	qb = NewQueryBuilder().Where("user_id; DROP TABLE users", "=", "user/1")
+	if _, err := ms.GetNotifications(qb); !errors.Is(err, ErrInvalidColumn) {
+		t.Fatalf("want %v get %v", ErrInvalidColumn, err)
+	}
+}
+
+func TestMemoryStoreUser(t *testing.T) {
+	ms, topicId := memoryStoreWithTopic(t)
+	if err := ms.InsertUser(UserProfile{Id: "user/1"}); !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("want %v get %v", ErrDuplicateKey, err)
+	}
+	user := UserProfile{Id: "user/2", Email: "c@c.c", Token: "token"}
+	if err := ms.UpdateUser(user, []string{"email", "token"}); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	stored, err := ms.FindUser(NewQueryBuilder().Where("token", "=", "token"))
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if stored.Email != "c@c.c" || stored.Password != "secret" {
+		t.Fatalf("only email and token should change get %v", stored)
+	}
+
+	if _, err := ms.InsertSubscriber(Subscriber{TopicId: topicId, UserId: "user/2"}); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if err := ms.DeleteUser(UserProfile{Id: "user/1"}); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if _, err := ms.GetTopics(NewQueryBuilder()); err != sql.ErrNoRows {
+		t.Fatalf("owned topic should be purged get %v", err)
+	}
+	if _, err := ms.GetSubscribers(NewQueryBuilder()); err != sql.ErrNoRows {
+		t.Fatalf("subscriber of purged topic should be removed get %v", err)
+	}
+	if err := ms.DeleteUser(stored); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if _, err := ms.FindUser(NewQueryBuilder().Where("id", "=", "user/2")); err != sql.ErrNoRows {
+		t.Fatalf("want %v get %v", sql.ErrNoRows, err)
+	}
+}
+
+func TestMemoryStoreInsertNotifications(t *testing.T) {
+	ms, topicId := memoryStoreWithTopic(t)
+	withJob := func(notification Notification) (*DeliveryJob, error) {
+		return &DeliveryJob{NotificationId: notification.Id, State: JOB_STATE_PENDING}, nil
+	}
+	notifications := Notifications{
+		Notification{UserId: "user/1", TopicId: topicId, Message: "kept"},
+		Notification{UserId: "user/3", TopicId: topicId, Message: "unknown user"},
+	}
+	if err := ms.InsertNotifications(notifications, withJob); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("want %v get %v", ErrForeignKey, err)
+	}
+	if _, err := ms.GetNotifications(NewQueryBuilder()); err != sql.ErrNoRows {
+		t.Fatalf("failed insert should keep nothing get %v", err)
+	}
+	if len(ms.DeliveryJobs()) != 0 {
+		t.Fatalf("failed insert should keep no job get %v", ms.DeliveryJobs())
+	}
+
+	notifications = notifications[:1]
+	if err := ms.InsertNotifications(notifications, withJob); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	jobs := ms.DeliveryJobs()
+	if len(jobs) != 1 || jobs[0].NotificationId != notifications[0].Id {
+		t.Fatalf("want job of notification %v get %v", notifications[0].Id, jobs)
+	}
+	if updated, err := ms.UpdateReadNotification(notifications); err != nil || updated != 1 {
+		t.Fatalf("want 1 get %v %v", updated, err)
+	}
+	if updated, err := ms.UpdateReadNotification(notifications); err != nil || updated != 0 {
+		t.Fatalf("already read should not be counted get %v %v", updated, err)
+	}
+	read, _ := ms.GetNotifications(NewQueryBuilder().Where("is_read", "=", true))
+	if len(read) != 1 {
+		t.Fatalf("want 1 read notification get %v", read)
+	}
+}
+
+func TestMemoryStoreTopicMember(t *testing.T) {
+	ms, topicId := memoryStoreWithTopic(t)
+	owner, err := ms.GetTopicMembers(NewQueryBuilder().Where("topic_id", "=", topicId))
+	if err != nil || len(owner) != 1 || owner[0].UserId != "user/1" || owner[0].Role != TOPIC_ROLE_OWNER {
+		t.Fatalf("topic user should be the owner member get %v %v", owner, err)
+	}
+	member := TopicMember{TopicId: topicId, UserId: "user/2", Role: TOPIC_ROLE_PUBLISHER, InvitedBy: "user/1"}
+	if _, err := ms.InsertTopicMember(member); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if _, err := ms.InsertTopicMember(member); !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("want %v get %v", ErrDuplicateKey, err)
+	}
+	if _, err := ms.InsertTopicMember(TopicMember{TopicId: topicId, UserId: "user/3"}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("want %v get %v", ErrForeignKey, err)
+	}
+
+	if err := ms.TransferTopicOwnership(topicId, "user/1", "user/2"); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	topics, _ := ms.GetTopics(NewQueryBuilder().Where("id", "=", topicId))
+	if topics[0].UserId != "user/2" {
+		t.Fatalf("want user/2 get %v", topics[0].UserId)
+	}
+	qb := NewQueryBuilder().Where("topic_id", "=", topicId).OrderBy("user_id", ORDER_ASC)
+	members, err := ms.GetTopicMembers(qb)
+	if err != nil || members[0].Role != TOPIC_ROLE_ADMIN || members[1].Role != TOPIC_ROLE_OWNER {
+		t.Fatalf("want admin and owner get %v %v", members, err)
+	}
+
+	if err := ms.DeleteUser(UserProfile{Id: "user/1"}); err != nil {
+		t.Fatalf("member should not block delete get %v", err)
+	}
+	members, err = ms.GetTopicMembers(NewQueryBuilder().Where("topic_id", "=", topicId))
+	if err != nil || len(members) != 1 || members[0].UserId != "user/2" {
+		t.Fatalf("member should be deleted with the user get %v %v", members, err)
+	}
+}
+
+// Same rotation contract for every store
+func checkRefreshTokenRotation(t *testing.T, store Store, userId string) {
+	first := RefreshToken{UserId: userId, FamilyId: "family/1", TokenHash: "first", ExpiresAt: 100, CreatedAt: 1}
+	firstId, err := store.InsertRefreshToken(first)
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	first.Id = int(firstId)
+	second := RefreshToken{UserId: userId, FamilyId: first.FamilyId, TokenHash: "second", ExpiresAt: 100, CreatedAt: 2}
+	if err := store.RotateRefreshToken(first, second); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	stale := RefreshToken{UserId: userId, FamilyId: first.FamilyId, TokenHash: "stale", ExpiresAt: 100, CreatedAt: 3}
+	if err := store.RotateRefreshToken(first, stale); err != ErrRefreshTokenReused {
+		t.Fatalf("want %v get %v", ErrRefreshTokenReused, err)
+	}
+	qb := NewQueryBuilder().Where("token_hash", "=", "stale")
+	if _, err := store.GetRefreshTokens(qb); err != sql.ErrNoRows {
+		t.Fatalf("reused rotation should write nothing get %v", err)
+	}
+
+	if err := store.RevokeRefreshTokenFamily(first.FamilyId, 4); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	qb = NewQueryBuilder().Where("family_id", "=", first.FamilyId).OrderBy("id", ORDER_ASC)
+	family, err := store.GetRefreshTokens(qb)
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if len(family) != 2 || family[0].RevokedAt != 2 || family[0].ReplacedBy != "second" || family[1].RevokedAt != 4 {
+		t.Fatalf("want whole family revoked get %v", family)
+	}
+}
+
+func TestMemoryStoreRefreshToken(t *testing.T) {
+	ms, _ := memoryStoreWithTopic(t)
+	checkRefreshTokenRotation(t, ms, "user/2")
+	if err := ms.DeleteUser(UserProfile{Id: "user/2"}); err != nil {
+		t.Fatalf("refresh token should not block delete get %v", err)
+	}
+	if _, err := ms.GetRefreshTokens(NewQueryBuilder()); err != sql.ErrNoRows {
+		t.Fatalf("refresh token should be deleted with the user get %v", err)
+	}
+}
+
+func TestMemoryStoreApiKey(t *testing.T) {
+	ms, topicId := memoryStoreWithTopic(t)
+	apiKey := ApiKey{UserId: "user/2", Name: "billing", Prefix: "nk_1", KeyHash: "hash", TopicIds: []int{topicId}}
+	if _, err := ms.InsertApiKey(ApiKey{UserId: "user/2", Prefix: "nk_0", TopicIds: []int{topicId + 1}}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("want %v get %v", ErrForeignKey, err)
+	}
+	apiKeyId, err := ms.InsertApiKey(apiKey)
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if _, err := ms.InsertApiKey(apiKey); !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("want %v get %v", ErrDuplicateKey, err)
+	}
+	apiKeyTopics, err := ms.GetApiKeyTopics(NewQueryBuilder().Where("api_key_id", "=", apiKeyId))
+	if err != nil || len(apiKeyTopics) != 1 || apiKeyTopics[0].TopicId != topicId {
+		t.Fatalf("want topic %v get %v %v", topicId, apiKeyTopics, err)
+	}
+
+	used := ApiKey{Id: int(apiKeyId), Name: "ignored", LastUsedAt: 10}
+	if err := ms.UpdateApiKey(used, []string{"last_used_at"}); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	stored, err := ms.GetApiKeys(NewQueryBuilder().Where("prefix", "=", "nk_1"))
+	if err != nil || stored[0].LastUsedAt != 10 || stored[0].Name != "billing" {
+		t.Fatalf("only last_used_at should change get %v %v", stored, err)
+	}
+
+	if err := ms.DeleteUser(UserProfile{Id: "user/2"}); err != nil {
+		t.Fatalf("api key should not block delete get %v", err)
+	}
+	if _, err := ms.GetApiKeyTopics(NewQueryBuilder()); err != sql.ErrNoRows {
+		t.Fatalf("api key topic should be deleted with the user get %v", err)
+	}
+}
+
+func TestMemoryStoreSubscriptionRequest(t *testing.T) {
+	ms, topicId := memoryStoreWithTopic(t)
+	pending := SubscriptionRequest{TopicId: topicId, UserId: "user/2", CallbackUrl: "https://a.a", Secret: "secret", Status: SUBSCRIPTION_REQUEST_PENDING}
+	if _, err := ms.InsertSubscriptionRequest(SubscriptionRequest{TopicId: topicId + 1, UserId: "user/2"}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("want %v get %v", ErrForeignKey, err)
+	}
+	requestId, err := ms.InsertSubscriptionRequest(pending)
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	approved := SubscriptionRequest{Id: int(requestId), Status: SUBSCRIPTION_REQUEST_APPROVED, DecidedBy: "user/1", DecidedAt: 10}
+	if err := ms.DecideSubscriptionRequest(approved, pending.Subscriber()); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	stored, err := ms.GetSubscriptionRequests(NewQueryBuilder().Where("id", "=", requestId))
+	if err != nil || stored[0].Status != SUBSCRIPTION_REQUEST_APPROVED || stored[0].DecidedAt != 10 {
+		t.Fatalf("want approved request get %v %v", stored, err)
+	}
+	subscribers, err := ms.GetSubscribers(NewQueryBuilder().Where("user_id", "=", "user/2"))
+	if err != nil || subscribers[0].Secret != "secret" || subscribers[0].CallbackUrl != "https://a.a" {
+		t.Fatalf("approved request should be a subscriber get %v %v", subscribers, err)
+	}
+	members, err := ms.GetTopicMembers(NewQueryBuilder().Where("user_id", "=", "user/2"))
+	if err != nil || members[0].Role != TOPIC_ROLE_SUBSCRIBER || members[0].InvitedBy != "user/1" {
+		t.Fatalf("approved request should be a subscriber member get %v %v", members, err)
+	}
+	rejected := SubscriptionRequest{Id: int(requestId), Status: SUBSCRIPTION_REQUEST_REJECTED, DecidedBy: "user/1", DecidedAt: 20}
+	if err := ms.DecideSubscriptionRequest(rejected, pending.Subscriber()); err != ErrAlreadyDecided {
+		t.Fatalf("want %v get %v", ErrAlreadyDecided, err)
+	}
+}
+
+func TestMemoryStoreSubscriber(t *testing.T) {
+	ms, topicId := memoryStoreWithTopic(t)
+	subscriber := Subscriber{TopicId: topicId, UserId: "user/2", UnsubscribeToken: "token"}
+	subscriberId, err := ms.InsertSubscriber(subscriber)
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if _, err := ms.InsertSubscriber(subscriber); !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("want %v get %v", ErrDuplicateKey, err)
+	}
+	withJob := func(notification Notification) (*DeliveryJob, error) {
+		return &DeliveryJob{SubscriberId: int(subscriberId), NotificationId: notification.Id}, nil
+	}
+	if err := ms.InsertNotifications(Notifications{Notification{UserId: "user/2", TopicId: topicId}}, withJob); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if err := ms.DeleteSubscriber(Subscriber{Id: int(subscriberId)}); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if _, err := ms.GetSubscribers(NewQueryBuilder()); err != sql.ErrNoRows {
+		t.Fatalf("want %v get %v", sql.ErrNoRows, err)
+	}
+	if len(ms.DeliveryJobs()) != 0 {
+		t.Fatalf("job should be deleted with the subscriber get %v", ms.DeliveryJobs())
+	}
+}
@@ -0,0 +1,268 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MIGRATION_DIRECTORY = "migrations"
+	MIGRATION_UP = "up"
+	MIGRATION_DOWN = "down"
+)
+
+var (
+	ErrSchemaBehind = errors.New("SCHEMA IS BEHIND")
+	ErrUnknownMigration = errors.New("APPLIED MIGRATION NOT FOUND")
+	migrationFilePattern = regexp.MustCompile(`^([0-9]+)_([a-zA-Z0-9_]+)\.(up|down)\.sql$`)
+)
+
+/**
+	Migration is a pair of file e.g 0001_create_users.up.sql and
+	0001_create_users.down.sql. Version is the number in front
+*/
+type Migration struct {
+	Version int64
+	Name string
+	Up string
+	Down string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied bool
+	AppliedAt int64
+}
+
+// Migration directory of the dialect in the loaded query map
+func MigrationDirectory(base string) string {
+	return filepath.Join(base, MIGRATION_DIRECTORY, queryMap.Dialect())
+}
+
+func LoadMigrations(dir string) ([]Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, file := range files {
+		match := migrationFilePattern.FindStringSubmatch(file.Name())
+		if file.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("MIGRATION %d HAS TWO NAME %s AND %s", version, migration.Name, match[2])
+		}
+		if match[3] == MIGRATION_UP {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if len(strings.TrimSpace(migration.Up)) == 0 || len(strings.TrimSpace(migration.Down)) == 0 {
+			return nil, fmt.Errorf("MIGRATION %d_%s NEED BOTH UP AND DOWN", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+/**
+	Not every driver accept more than one statement in a single Exec so
+	the file is split on semicolon. Migration should not have semicolon
+	inside a string
+*/
+func splitStatement(body string) []string {
+	statements := []string{}
+	for _, statement := range strings.Split(body, ";") {
+		if statement = strings.TrimSpace(statement); len(statement) != 0 {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+/**
+	Migrator apply migration and record it in schema_migrations. Every
+	migration run in its own transaction together with its record, MySQL
+	commit DDL implicitly so a failed migration there need manual cleanup
+*/
+type Migrator struct {
+	DB ITransactionSQL
+	Migrations []Migration
+	now func() time.Time
+}
+
+func NewMigrator(db ITransactionSQL, dir string) (*Migrator, error) {
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		DB: db,
+		Migrations: migrations,
+		now: time.Now,
+	}, nil
+}
+
+func (m *Migrator) applied() (map[int64]SchemaMigration, error) {
+	if err := CreateSchemaMigrationTable(m.DB); err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]SchemaMigration)
+	schemaMigrations := SchemaMigrations{}
+	qb := NewQueryBuilder().OrderBy("version", ORDER_ASC)
+	err := schemaMigrations.Get(m.DB, qb)
+	if err == sql.ErrNoRows {
+		return applied, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, schemaMigration := range schemaMigrations {
+		applied[schemaMigration.Version] = schemaMigration
+	}
+	return applied, nil
+}
+
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	status := make([]MigrationStatus, len(m.Migrations))
+	for i, migration := range m.Migrations {
+		schemaMigration, ok := applied[migration.Version]
+		status[i] = MigrationStatus{
+			Migration: migration,
+			Applied: ok,
+			AppliedAt: schemaMigration.AppliedAt,
+		}
+	}
+	return status, nil
+}
+
+func (m *Migrator) Pending() ([]Migration, error) {
+	status, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+	pending := []Migration{}
+	for _, s := range status {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+func (m *Migrator) run(migration Migration, direction string) error {
+	body := migration.Up
+	if direction == MIGRATION_DOWN {
+		body = migration.Down
+	}
+	return CreateSQLTransaction(m.DB, func(tx *sql.Tx) error {
+		for _, statement := range splitStatement(body) {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("MIGRATION %d_%s %s: %w", migration.Version, migration.Name, direction, err)
+			}
+		}
+		schemaMigration := SchemaMigration{
+			Version: migration.Version,
+			Name: migration.Name,
+			AppliedAt: m.now().Unix(),
+		}
+		if direction == MIGRATION_DOWN {
+			_, err := schemaMigration.Delete(tx)
+			return err
+		}
+		_, err := schemaMigration.Insert(tx)
+		return err
+	})
+}
+
+// Apply every pending migration in order, return how many applied
+func (m *Migrator) Up() (int, error) {
+	pending, err := m.Pending()
+	if err != nil {
+		return 0, err
+	}
+	for i, migration := range pending {
+		if err := m.run(migration, MIGRATION_UP); err != nil {
+			return i, err
+		}
+	}
+	return len(pending), nil
+}
+
+// Roll back the last applied migration, steps times
+func (m *Migrator) Down(steps int) (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	versions := make([]int64, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] > versions[j]
+	})
+	byVersion := make(map[int64]Migration, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		byVersion[migration.Version] = migration
+	}
+	count := 0
+	for _, version := range versions {
+		if count >= steps {
+			break
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			return count, fmt.Errorf("%w %d", ErrUnknownMigration, version)
+		}
+		if err := m.run(migration, MIGRATION_DOWN); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Server should not start when a migration is not applied yet
+func (m *Migrator) EnsureCurrent() error {
+	pending, err := m.Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) != 0 {
+		return fmt.Errorf("%w, %d migration pending starting from %04d_%s", ErrSchemaBehind, len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
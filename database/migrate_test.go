@@ -0,0 +1,189 @@
+package database
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notification-migration")
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"0002_second.up.sql": "CREATE TABLE second (id INTEGER)",
+		"0002_second.down.sql": "DROP TABLE second",
+		"0001_first.up.sql": "CREATE TABLE first (id INTEGER)",
+		"0001_first.down.sql": "DROP TABLE first",
+		"README.md": "ignored",
+	}
+	for name, body := range files {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644)
+	}
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Name != "second" {
+		t.Fatalf("want first and second in order get %v", migrations)
+	}
+
+	os.Remove(filepath.Join(dir, "0002_second.down.sql"))
+	if _, err := LoadMigrations(dir); err == nil {
+		t.Fatalf("migration without down should be rejected")
+	}
+}
+
+func TestSplitStatement(t *testing.T) {
+	result := splitStatement("CREATE TABLE a (id INT);\n\nCREATE INDEX b ON a (id);\n")
+	want := []string{"CREATE TABLE a (id INT)", "CREATE INDEX b ON a (id)"}
+	if !reflect.DeepEqual(result, want) {
+		t.Fatalf("want %v get %v", want, result)
+	}
+}
+
+// Every dialect should have the same migration
+func TestMigrationDialect(t *testing.T) {
+	mysql, err := LoadMigrations(filepath.Join(MIGRATION_DIRECTORY, DIALECT_MYSQL))
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	for _, dialect := range []string{DIALECT_SQLITE, DIALECT_POSTGRES} {
+		migrations, err := LoadMigrations(filepath.Join(MIGRATION_DIRECTORY, dialect))
+		if err != nil {
+			t.Fatalf("want nil get %v", err)
+		}
+		if len(migrations) != len(mysql) {
+			t.Fatalf("want %v get %v for %v", len(mysql), len(migrations), dialect)
+		}
+		for i := range migrations {
+			if migrations[i].Version != mysql[i].Version || migrations[i].Name != mysql[i].Name {
+				t.Fatalf("want %v get %v for %v", mysql[i].Name, migrations[i].Name, dialect)
+			}
+		}
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	if err := ConvertJsonToQueryMap(SQLITE_QUERY_MAP); err != nil {
+		t.Fatalf("Failed to read query map %v", err)
+	}
+	memoryDB, err := SqliteDatabaseAccess{}.ConnectDatabase()
+	if err != nil {
+		t.Fatalf("Cannot Connect to DB %v", err)
+	}
+	defer memoryDB.Close()
+	migrator, err := NewMigrator(memoryDB, MigrationDirectory("."))
+	if err != nil {
+		t.Fatalf("Failed to load migration %v", err)
+	}
+	total := len(migrator.Migrations)
+
+	if err := migrator.EnsureCurrent(); !errors.Is(err, ErrSchemaBehind) {
+		t.Fatalf("want %v get %v", ErrSchemaBehind, err)
+	}
+	applied, err := migrator.Up()
+	if err != nil || applied != total {
+		t.Fatalf("want %v get %v %v", total, applied, err)
+	}
+	if err := migrator.EnsureCurrent(); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if applied, _ := migrator.Up(); applied != 0 {
+		t.Fatalf("want 0 get %v", applied)
+	}
+
+	rolledBack, err := migrator.Down(2)
+	if err != nil || rolledBack != 2 {
+		t.Fatalf("want 2 get %v %v", rolledBack, err)
+	}
+	status, err := migrator.Status()
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	for i, s := range status {
+		if s.Applied != (i < total-2) {
+			t.Fatalf("want applied %v get %v for %v", i < total-2, s.Applied, s.Name)
+		}
+	}
+	if _, err := memoryDB.Exec("SELECT id FROM topic_tags"); err == nil {
+		t.Fatalf("topic_tags should be dropped")
+	}
+	if applied, err := migrator.Up(); err != nil || applied != 2 {
+		t.Fatalf("want 2 get %v %v", applied, err)
+	}
+}
+
+func TestMigrateUniqueSubscribers(t *testing.T) {
+	if err := ConvertJsonToQueryMap(SQLITE_QUERY_MAP); err != nil {
+		t.Fatalf("Failed to read query map %v", err)
+	}
+	memoryDB, err := SqliteDatabaseAccess{}.ConnectDatabase()
+	if err != nil {
+		t.Fatalf("Cannot Connect to DB %v", err)
+	}
+	defer memoryDB.Close()
+	migrator, err := NewMigrator(memoryDB, MigrationDirectory("."))
+	if err != nil {
+		t.Fatalf("Failed to load migration %v", err)
+	}
+	// stop right before subscribers become unique
+	migrations := migrator.Migrations
+	for i, migration := range migrations {
+		if migration.Name == "add_unique_subscribers" {
+			migrator.Migrations = migrations[:i]
+		}
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Failed to migrate %v", err)
+	}
+	// subscriber 2 duplicate 1, the last dead letter point to a subscriber that is gone
+	for _, statement := range []string{
+		"INSERT INTO users (id) VALUES ('user/1')",
+		"INSERT INTO topics (id, user_id) VALUES (1, 'user/1')",
+		"INSERT INTO subscribers (id, topic_id, user_id) VALUES (1, 1, 'user/1'), (2, 1, 'user/1')",
+		"INSERT INTO notifications (id, user_id, topic_id) VALUES (1, 'user/1', 1)",
+		"INSERT INTO delivery_jobs (id, channel, subscriber_id, notification_id, payload, state, available_at, last_error, created_at) VALUES (1, 'webhook', 2, 1, '', 'dead', 0, '', 0), (2, 'webhook', 1, 1, '', 'dead', 0, '', 0)",
+		"INSERT INTO delivery_attempts (subscriber_id, notification_id, url, attempt) VALUES (2, 1, '', 1)",
+		"INSERT INTO dead_letters (job_id, channel, subscriber_id, notification_id, payload, attempts, last_error, created_at) VALUES (1, 'webhook', 2, 1, '', 1, '', 0), (2, 'webhook', 99, 1, '', 1, '', 0)",
+	} {
+		if _, err := memoryDB.Exec(statement); err != nil {
+			t.Fatalf("Failed to insert %v", err)
+		}
+	}
+	migrator.Migrations = migrations
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+
+	var subscriberIds []int
+	for _, table := range []string{"delivery_jobs", "delivery_attempts", "dead_letters"} {
+		rows, err := memoryDB.Query("SELECT subscriber_id FROM " + table + " ORDER BY id")
+		if err != nil {
+			t.Fatalf("want nil get %v", err)
+		}
+		for rows.Next() {
+			var subscriberId int
+			if err := rows.Scan(&subscriberId); err != nil {
+				t.Fatalf("want nil get %v", err)
+			}
+			subscriberIds = append(subscriberIds, subscriberId)
+		}
+		rows.Close()
+	}
+	if want := []int{1, 1, 1, 1, 99}; !reflect.DeepEqual(subscriberIds, want) {
+		t.Fatalf("want %v get %v", want, subscriberIds)
+	}
+	// dead letter of the duplicate no longer block unsubscribe
+	if _, err := memoryDB.Exec("DELETE FROM dead_letters WHERE subscriber_id = 99"); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if err := NewSQLStore(memoryDB).DeleteSubscriber(Subscriber{Id: 1}); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+}
@@ -0,0 +1,7 @@
+CREATE TABLE users (
+    id VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    password VARCHAR(255),
+    token TEXT,
+    PRIMARY KEY (id)
+);
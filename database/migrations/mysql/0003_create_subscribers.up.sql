@@ -0,0 +1,10 @@
+CREATE TABLE subscribers (
+    id INT NOT NULL AUTO_INCREMENT,
+    topic_id INT NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    callback_url VARCHAR(2048) NOT NULL DEFAULT '',
+    secret VARCHAR(255) NOT NULL DEFAULT '',
+    PRIMARY KEY (id),
+    FOREIGN KEY (topic_id) REFERENCES topics(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE notifications (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id VARCHAR(255) NOT NULL,
+    topic_id INT NOT NULL,
+    message TEXT,
+    is_read TINYINT(1) NOT NULL DEFAULT 0,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (topic_id) REFERENCES topics(id)
+);
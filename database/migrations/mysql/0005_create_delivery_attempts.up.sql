@@ -0,0 +1,13 @@
+CREATE TABLE delivery_attempts (
+    id INT NOT NULL AUTO_INCREMENT,
+    subscriber_id INT NOT NULL,
+    notification_id INT NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    attempt INT NOT NULL,
+    status_code INT NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    FOREIGN KEY (subscriber_id) REFERENCES subscribers(id),
+    FOREIGN KEY (notification_id) REFERENCES notifications(id)
+);
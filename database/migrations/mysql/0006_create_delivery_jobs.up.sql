@@ -0,0 +1,18 @@
+CREATE TABLE delivery_jobs (
+    id INT NOT NULL AUTO_INCREMENT,
+    channel VARCHAR(32) NOT NULL,
+    subscriber_id INT NOT NULL,
+    notification_id INT NOT NULL,
+    payload TEXT NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    available_at BIGINT NOT NULL,
+    locked_until BIGINT NOT NULL DEFAULT 0,
+    claim_token VARCHAR(64) NOT NULL DEFAULT '',
+    last_error TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (id),
+    INDEX delivery_jobs_claimable (state, available_at),
+    FOREIGN KEY (subscriber_id) REFERENCES subscribers(id),
+    FOREIGN KEY (notification_id) REFERENCES notifications(id)
+);
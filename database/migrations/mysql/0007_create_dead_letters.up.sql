@@ -0,0 +1,13 @@
+CREATE TABLE dead_letters (
+    id INT NOT NULL AUTO_INCREMENT,
+    job_id INT NOT NULL,
+    channel VARCHAR(32) NOT NULL,
+    subscriber_id INT NOT NULL,
+    notification_id INT NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INT NOT NULL,
+    last_error TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (job_id) REFERENCES delivery_jobs(id)
+);
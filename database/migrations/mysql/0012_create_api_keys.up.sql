@@ -0,0 +1,23 @@
+CREATE TABLE api_keys (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(32) NOT NULL,
+    key_hash CHAR(64) NOT NULL,
+    last_used_at BIGINT NOT NULL DEFAULT 0,
+    revoked_at BIGINT NOT NULL DEFAULT 0,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY api_keys_prefix (prefix),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE api_key_topics (
+    id INT NOT NULL AUTO_INCREMENT,
+    api_key_id INT NOT NULL,
+    topic_id INT NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY api_key_topics_key_topic (api_key_id, topic_id),
+    FOREIGN KEY (api_key_id) REFERENCES api_keys(id) ON DELETE CASCADE,
+    FOREIGN KEY (topic_id) REFERENCES topics(id)
+);
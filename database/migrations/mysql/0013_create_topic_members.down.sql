@@ -0,0 +1,17 @@
+CREATE TABLE topic_publishers (
+    id INT NOT NULL AUTO_INCREMENT,
+    topic_id INT NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    granted_by VARCHAR(255) NOT NULL,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY topic_publishers_topic_user (topic_id, user_id),
+    FOREIGN KEY (topic_id) REFERENCES topics(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+INSERT INTO topic_publishers (topic_id, user_id, granted_by, created_at)
+SELECT topic_id, user_id, invited_by, created_at FROM topic_members
+WHERE role IN ('admin', 'publisher');
+
+DROP TABLE topic_members;
@@ -0,0 +1,23 @@
+CREATE TABLE topic_members (
+    id INT NOT NULL AUTO_INCREMENT,
+    topic_id INT NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    role VARCHAR(32) NOT NULL,
+    invited_by VARCHAR(255) NOT NULL,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY topic_members_topic_user (topic_id, user_id),
+    INDEX topic_members_user (user_id),
+    FOREIGN KEY (topic_id) REFERENCES topics(id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO topic_members (topic_id, user_id, role, invited_by, created_at)
+SELECT id, user_id, 'owner', user_id, 0 FROM topics;
+
+INSERT INTO topic_members (topic_id, user_id, role, invited_by, created_at)
+SELECT tp.topic_id, tp.user_id, 'publisher', tp.granted_by, tp.created_at
+FROM topic_publishers tp JOIN topics t ON t.id = tp.topic_id
+WHERE tp.user_id <> t.user_id;
+
+DROP TABLE topic_publishers;
@@ -0,0 +1,15 @@
+CREATE TABLE subscription_requests (
+    id INT NOT NULL AUTO_INCREMENT,
+    topic_id INT NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    callback_url VARCHAR(2048) NOT NULL DEFAULT '',
+    secret VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL,
+    decided_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,
+    decided_at BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (id),
+    INDEX subscription_requests_topic (topic_id, status),
+    FOREIGN KEY (topic_id) REFERENCES topics(id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
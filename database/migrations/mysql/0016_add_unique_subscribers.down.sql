@@ -0,0 +1 @@
+DROP INDEX subscribers_topic_user ON subscribers;
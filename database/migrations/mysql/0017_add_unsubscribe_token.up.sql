@@ -0,0 +1,5 @@
+ALTER TABLE subscribers ADD COLUMN unsubscribe_token VARCHAR(64) NOT NULL DEFAULT '';
+
+UPDATE subscribers SET unsubscribe_token = SHA2(CONCAT(UUID(), RAND(), id), 256);
+
+CREATE UNIQUE INDEX subscribers_unsubscribe_token ON subscribers (unsubscribe_token);
@@ -0,0 +1,9 @@
+CREATE TABLE topic_tags (
+    id INT NOT NULL AUTO_INCREMENT,
+    topic_id INT NOT NULL,
+    tag VARCHAR(32) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY topic_tags_topic_tag (topic_id, tag),
+    INDEX topic_tags_tag (tag),
+    FOREIGN KEY (topic_id) REFERENCES topics(id)
+);
@@ -0,0 +1,6 @@
+CREATE TABLE users (
+    id VARCHAR(255) NOT NULL PRIMARY KEY,
+    email VARCHAR(255),
+    password VARCHAR(255),
+    token TEXT
+);
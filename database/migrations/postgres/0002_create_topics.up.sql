@@ -0,0 +1,6 @@
+CREATE TABLE topics (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL REFERENCES users(id),
+    title VARCHAR(255),
+    description VARCHAR(255)
+);
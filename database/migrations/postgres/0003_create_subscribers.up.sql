@@ -0,0 +1,7 @@
+CREATE TABLE subscribers (
+    id SERIAL PRIMARY KEY,
+    topic_id INTEGER NOT NULL REFERENCES topics(id),
+    user_id VARCHAR(255) NOT NULL REFERENCES users(id),
+    callback_url VARCHAR(2048) NOT NULL DEFAULT '',
+    secret VARCHAR(255) NOT NULL DEFAULT ''
+);
@@ -0,0 +1,7 @@
+CREATE TABLE notifications (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL REFERENCES users(id),
+    topic_id INTEGER NOT NULL REFERENCES topics(id),
+    message TEXT,
+    is_read BOOLEAN NOT NULL DEFAULT FALSE
+);
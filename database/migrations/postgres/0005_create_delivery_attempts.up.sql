@@ -0,0 +1,10 @@
+CREATE TABLE delivery_attempts (
+    id SERIAL PRIMARY KEY,
+    subscriber_id INTEGER NOT NULL REFERENCES subscribers(id),
+    notification_id INTEGER NOT NULL REFERENCES notifications(id),
+    url VARCHAR(2048) NOT NULL,
+    attempt INTEGER NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,16 @@
+CREATE TABLE delivery_jobs (
+    id SERIAL PRIMARY KEY,
+    channel VARCHAR(32) NOT NULL,
+    subscriber_id INTEGER NOT NULL REFERENCES subscribers(id),
+    notification_id INTEGER NOT NULL REFERENCES notifications(id),
+    payload TEXT NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    available_at BIGINT NOT NULL,
+    locked_until BIGINT NOT NULL DEFAULT 0,
+    claim_token VARCHAR(64) NOT NULL DEFAULT '',
+    last_error TEXT NOT NULL,
+    created_at BIGINT NOT NULL
+);
+
+CREATE INDEX delivery_jobs_claimable ON delivery_jobs (state, available_at);
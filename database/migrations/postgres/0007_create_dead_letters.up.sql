@@ -0,0 +1,11 @@
+CREATE TABLE dead_letters (
+    id SERIAL PRIMARY KEY,
+    job_id INTEGER NOT NULL REFERENCES delivery_jobs(id),
+    channel VARCHAR(32) NOT NULL,
+    subscriber_id INTEGER NOT NULL,
+    notification_id INTEGER NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    last_error TEXT NOT NULL,
+    created_at BIGINT NOT NULL
+);
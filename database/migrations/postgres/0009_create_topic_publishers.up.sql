@@ -0,0 +1,8 @@
+CREATE TABLE topic_publishers (
+    id SERIAL PRIMARY KEY,
+    topic_id INTEGER NOT NULL REFERENCES topics(id),
+    user_id VARCHAR(255) NOT NULL REFERENCES users(id),
+    granted_by VARCHAR(255) NOT NULL,
+    created_at BIGINT NOT NULL,
+    UNIQUE (topic_id, user_id)
+);
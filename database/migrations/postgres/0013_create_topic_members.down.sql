@@ -0,0 +1,14 @@
+CREATE TABLE topic_publishers (
+    id SERIAL PRIMARY KEY,
+    topic_id INTEGER NOT NULL REFERENCES topics(id),
+    user_id VARCHAR(255) NOT NULL REFERENCES users(id),
+    granted_by VARCHAR(255) NOT NULL,
+    created_at BIGINT NOT NULL,
+    UNIQUE (topic_id, user_id)
+);
+
+INSERT INTO topic_publishers (topic_id, user_id, granted_by, created_at)
+SELECT topic_id, user_id, invited_by, created_at FROM topic_members
+WHERE role IN ('admin', 'publisher');
+
+DROP TABLE topic_members;
@@ -0,0 +1,21 @@
+CREATE TABLE topic_members (
+    id SERIAL PRIMARY KEY,
+    topic_id INTEGER NOT NULL REFERENCES topics(id),
+    user_id VARCHAR(255) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(32) NOT NULL,
+    invited_by VARCHAR(255) NOT NULL,
+    created_at BIGINT NOT NULL,
+    UNIQUE (topic_id, user_id)
+);
+
+CREATE INDEX topic_members_user ON topic_members (user_id);
+
+INSERT INTO topic_members (topic_id, user_id, role, invited_by, created_at)
+SELECT id, user_id, 'owner', user_id, 0 FROM topics;
+
+INSERT INTO topic_members (topic_id, user_id, role, invited_by, created_at)
+SELECT tp.topic_id, tp.user_id, 'publisher', tp.granted_by, tp.created_at
+FROM topic_publishers tp JOIN topics t ON t.id = tp.topic_id
+WHERE tp.user_id <> t.user_id;
+
+DROP TABLE topic_publishers;
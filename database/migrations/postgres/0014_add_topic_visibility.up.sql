@@ -0,0 +1 @@
+ALTER TABLE topics ADD COLUMN visibility VARCHAR(16) NOT NULL DEFAULT 'public';
@@ -0,0 +1,13 @@
+CREATE TABLE subscription_requests (
+    id SERIAL PRIMARY KEY,
+    topic_id INTEGER NOT NULL REFERENCES topics(id),
+    user_id VARCHAR(255) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    callback_url VARCHAR(2048) NOT NULL DEFAULT '',
+    secret VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL,
+    decided_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,
+    decided_at BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX subscription_requests_topic ON subscription_requests (topic_id, status);
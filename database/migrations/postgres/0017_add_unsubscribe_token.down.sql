@@ -0,0 +1,2 @@
+DROP INDEX subscribers_unsubscribe_token;
+ALTER TABLE subscribers DROP COLUMN unsubscribe_token;
@@ -0,0 +1,5 @@
+ALTER TABLE subscribers ADD COLUMN unsubscribe_token VARCHAR(64) NOT NULL DEFAULT '';
+
+UPDATE subscribers SET unsubscribe_token = md5(random()::text || id::text) || md5(random()::text || clock_timestamp()::text);
+
+CREATE UNIQUE INDEX subscribers_unsubscribe_token ON subscribers (unsubscribe_token);
@@ -0,0 +1,3 @@
+ALTER TABLE notifications ADD COLUMN created_at BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX notifications_user_id_id ON notifications (user_id, id);
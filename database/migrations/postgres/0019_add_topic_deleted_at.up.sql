@@ -0,0 +1 @@
+ALTER TABLE topics ADD COLUMN deleted_at BIGINT NOT NULL DEFAULT 0;
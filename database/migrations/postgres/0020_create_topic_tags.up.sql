@@ -0,0 +1,8 @@
+CREATE TABLE topic_tags (
+    id SERIAL PRIMARY KEY,
+    topic_id INTEGER NOT NULL REFERENCES topics(id),
+    tag VARCHAR(32) NOT NULL,
+    UNIQUE (topic_id, tag)
+);
+
+CREATE INDEX topic_tags_tag ON topic_tags (tag);
@@ -0,0 +1,6 @@
+CREATE TABLE users (
+    id TEXT NOT NULL PRIMARY KEY,
+    email TEXT,
+    password TEXT,
+    token TEXT
+);
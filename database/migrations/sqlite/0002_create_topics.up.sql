@@ -0,0 +1,6 @@
+CREATE TABLE topics (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    title TEXT,
+    description TEXT
+);
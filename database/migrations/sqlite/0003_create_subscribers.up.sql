@@ -0,0 +1,7 @@
+CREATE TABLE subscribers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    topic_id INTEGER NOT NULL REFERENCES topics(id),
+    user_id TEXT NOT NULL REFERENCES users(id),
+    callback_url TEXT NOT NULL DEFAULT '',
+    secret TEXT NOT NULL DEFAULT ''
+);
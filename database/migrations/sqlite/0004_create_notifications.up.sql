@@ -0,0 +1,7 @@
+CREATE TABLE notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    topic_id INTEGER NOT NULL REFERENCES topics(id),
+    message TEXT,
+    is_read INTEGER NOT NULL DEFAULT 0
+);
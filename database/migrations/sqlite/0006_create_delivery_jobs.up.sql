@@ -0,0 +1,16 @@
+CREATE TABLE delivery_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    channel TEXT NOT NULL,
+    subscriber_id INTEGER NOT NULL REFERENCES subscribers(id),
+    notification_id INTEGER NOT NULL REFERENCES notifications(id),
+    payload TEXT NOT NULL,
+    state TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    available_at INTEGER NOT NULL,
+    locked_until INTEGER NOT NULL DEFAULT 0,
+    claim_token TEXT NOT NULL DEFAULT '',
+    last_error TEXT NOT NULL,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX delivery_jobs_claimable ON delivery_jobs (state, available_at);
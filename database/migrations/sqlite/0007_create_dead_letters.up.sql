@@ -0,0 +1,11 @@
+CREATE TABLE dead_letters (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_id INTEGER NOT NULL REFERENCES delivery_jobs(id),
+    channel TEXT NOT NULL,
+    subscriber_id INTEGER NOT NULL,
+    notification_id INTEGER NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    last_error TEXT NOT NULL,
+    created_at INTEGER NOT NULL
+);
@@ -0,0 +1,8 @@
+CREATE TABLE topic_publishers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    topic_id INTEGER NOT NULL REFERENCES topics(id),
+    user_id TEXT NOT NULL REFERENCES users(id),
+    granted_by TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    UNIQUE (topic_id, user_id)
+);
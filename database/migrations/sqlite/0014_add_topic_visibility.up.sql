@@ -0,0 +1 @@
+ALTER TABLE topics ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public';
@@ -0,0 +1,13 @@
+CREATE TABLE subscription_requests (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    topic_id INTEGER NOT NULL REFERENCES topics(id),
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    callback_url TEXT NOT NULL DEFAULT '',
+    secret TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    decided_by TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL,
+    decided_at INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX subscription_requests_topic ON subscription_requests (topic_id, status);
@@ -0,0 +1,21 @@
+UPDATE delivery_jobs SET subscriber_id = (
+    SELECT MIN(s2.id) FROM subscribers s1
+    JOIN subscribers s2 ON s2.topic_id = s1.topic_id AND s2.user_id = s1.user_id
+    WHERE s1.id = delivery_jobs.subscriber_id
+) WHERE EXISTS (SELECT 1 FROM subscribers s1 WHERE s1.id = delivery_jobs.subscriber_id);
+
+UPDATE delivery_attempts SET subscriber_id = (
+    SELECT MIN(s2.id) FROM subscribers s1
+    JOIN subscribers s2 ON s2.topic_id = s1.topic_id AND s2.user_id = s1.user_id
+    WHERE s1.id = delivery_attempts.subscriber_id
+) WHERE EXISTS (SELECT 1 FROM subscribers s1 WHERE s1.id = delivery_attempts.subscriber_id);
+
+UPDATE dead_letters SET subscriber_id = (
+    SELECT MIN(s2.id) FROM subscribers s1
+    JOIN subscribers s2 ON s2.topic_id = s1.topic_id AND s2.user_id = s1.user_id
+    WHERE s1.id = dead_letters.subscriber_id
+) WHERE EXISTS (SELECT 1 FROM subscribers s1 WHERE s1.id = dead_letters.subscriber_id);
+
+DELETE FROM subscribers WHERE id NOT IN (SELECT MIN(id) FROM subscribers GROUP BY topic_id, user_id);
+
+CREATE UNIQUE INDEX subscribers_topic_user ON subscribers (topic_id, user_id);
@@ -0,0 +1,5 @@
+ALTER TABLE subscribers ADD COLUMN unsubscribe_token TEXT NOT NULL DEFAULT '';
+
+UPDATE subscribers SET unsubscribe_token = lower(hex(randomblob(32)));
+
+CREATE UNIQUE INDEX subscribers_unsubscribe_token ON subscribers (unsubscribe_token);
@@ -0,0 +1,2 @@
+DROP INDEX notifications_user_id_id;
+ALTER TABLE notifications DROP COLUMN created_at;
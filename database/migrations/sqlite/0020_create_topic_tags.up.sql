@@ -0,0 +1,8 @@
+CREATE TABLE topic_tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    topic_id INTEGER NOT NULL REFERENCES topics(id),
+    tag TEXT NOT NULL,
+    UNIQUE (topic_id, tag)
+);
+
+CREATE INDEX topic_tags_tag ON topic_tags (tag);
@@ -0,0 +1 @@
+DROP INDEX notifications_topic_id_created_at;
@@ -0,0 +1 @@
+CREATE INDEX notifications_topic_id_created_at ON notifications (topic_id, created_at);
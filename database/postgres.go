@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+	"net/url"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+const (
+	DIALECT_MYSQL = "mysql"
+	DIALECT_SQLITE = "sqlite"
+	DIALECT_POSTGRES = "postgres"
+	POSTGRES_QUERY_MAP = "queryMap.postgres.json"
+	RETURNING_ID = "RETURNING id"
+)
+
+type PostgresDatabaseAccess struct {
+	Username string
+	Password string
+	Address string
+	DBName string
+	SSLMode string
+}
+
+func (pda PostgresDatabaseAccess) ConnectDatabase() (ITransactionSQL, error) {
+	sslMode := pda.SSLMode
+	if len(sslMode) == 0 {
+		sslMode = "disable"
+	}
+	composed := url.URL{
+		Scheme: "postgres",
+		User: url.UserPassword(pda.Username, pda.Password),
+		Host: pda.Address,
+		Path: "/" + pda.DBName,
+		RawQuery: "sslmode=" + url.QueryEscape(sslMode),
+	}
+	db, err := sql.Open("postgres", composed.String())
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func (pda PostgresDatabaseAccess) QueryMapName() string {
+	return POSTGRES_QUERY_MAP
+}
+
+/**
+	Dialect is written in the query map so the query map chosen at
+	startup decide how the query is sent. Query map without dialect
+	is treated as MySQL
+*/
+func (qm QueryMap) Dialect() string {
+	name, ok := qm["dialect"]["name"].(string)
+	if !ok {
+		return DIALECT_MYSQL
+	}
+	return name
+}
+
+/**
+	Postgres use numbered placeholder. Query only ever contain
+	placeholder generated by the model or the query builder, value
+	never appear in it, so every ? can be replaced in order
+*/
+func rebind(dialect, query string) string {
+	if dialect != DIALECT_POSTGRES {
+		return query
+	}
+	var builder strings.Builder
+	position := 0
+	for _, char := range query {
+		if char != '?' {
+			builder.WriteRune(char)
+			continue
+		}
+		position++
+		builder.WriteString("$" + strconv.Itoa(position))
+	}
+	return builder.String()
+}
+
+/**
+	Postgres driver does not support LastInsertId, insert in its
+	query map end with RETURNING id and the id is read from the row
+*/
+func returningId(tx ITransaction, query string, args []interface{}) (int64, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var lastInsertId int64
+	for rows.Next() {
+		if err := rows.Scan(&lastInsertId); err != nil {
+			return 0, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return lastInsertId, nil
+}
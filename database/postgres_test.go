@@ -0,0 +1,160 @@
+package database
+
+import (
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRebind(t *testing.T) {
+	query := "UPDATE users SET email = ?,token = ? WHERE id = ?"
+	want := "UPDATE users SET email = $1,token = $2 WHERE id = $3"
+	if result := rebind(DIALECT_POSTGRES, query); result != want {
+		t.Fatalf("want %v get %v", want, result)
+	}
+	if result := rebind(DIALECT_SQLITE, query); result != query {
+		t.Fatalf("want %v get %v", query, result)
+	}
+}
+
+func TestQueryMapDialect(t *testing.T) {
+	for name, want := range map[string]string{
+		MYSQL_QUERY_MAP: DIALECT_MYSQL,
+		SQLITE_QUERY_MAP: DIALECT_SQLITE,
+		POSTGRES_QUERY_MAP: DIALECT_POSTGRES,
+	} {
+		if err := ConvertJsonToQueryMap(name); err != nil {
+			t.Fatalf("Failed to read query map %v", err)
+		}
+		if queryMap.Dialect() != want {
+			t.Fatalf("want %v get %v", want, queryMap.Dialect())
+		}
+	}
+	if (QueryMap{}).Dialect() != DIALECT_MYSQL {
+		t.Fatalf("query map without dialect should be %v", DIALECT_MYSQL)
+	}
+}
+
+func TestPostgresQuery(t *testing.T) {
+	if err := ConvertJsonToQueryMap(POSTGRES_QUERY_MAP); err != nil {
+		t.Fatalf("Failed to read query map %v", err)
+	}
+	tx := &recordTransaction{}
+	notifications := Notifications{
+		Notification{UserId: "user/1", TopicId: 1, Message: "it's"},
+	}
+	// record transaction cannot return rows, only the query matter here
+	notifications.Insert(tx)
+	want := "INSERT INTO notifications (user_id, topic_id, message, created_at) VALUES ($1,$2,$3,$4) RETURNING id"
+	if tx.query != want {
+		t.Fatalf("want %v get %v", want, tx.query)
+	}
+
+	tx = &recordTransaction{}
+	user := UserProfile{Id: "user/1", Email: "a@a.a"}
+	lastInsertId, err := user.Update(tx, []string{"email"})
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if lastInsertId != 0 {
+		t.Fatalf("want 0 get %v", lastInsertId)
+	}
+	if tx.query != "UPDATE users SET email = $1 WHERE id = $2" {
+		t.Fatalf("want numbered placeholder get %v", tx.query)
+	}
+
+	tx = &recordTransaction{}
+	qb := NewQueryBuilder().Where("user_id", "=", "user/1").In("id", 1, 2).Limit(5)
+	ReadFromDB(tx, "notifications.get", qb, &Notification{})
+	want = "SELECT * FROM notifications WHERE user_id = $1 AND id IN ($2,$3) LIMIT 5"
+	if tx.query != want {
+		t.Fatalf("want %v get %v", want, tx.query)
+	}
+	if !reflect.DeepEqual(tx.args, []interface{}{"user/1", 1, 2}) {
+		t.Fatalf("want %v get %v", []interface{}{"user/1", 1, 2}, tx.args)
+	}
+}
+
+/**
+	Need a running Postgres, e.g
+	POSTGRES_TEST_ADDRESS=localhost:5432 POSTGRES_TEST_USER=postgres go test ./...
+*/
+func TestPostgresDatabase(t *testing.T) {
+	address := os.Getenv("POSTGRES_TEST_ADDRESS")
+	if len(address) == 0 {
+		t.Skip("POSTGRES_TEST_ADDRESS is not set")
+	}
+	dbName := os.Getenv("POSTGRES_TEST_DB")
+	if len(dbName) == 0 {
+		dbName = "postgres"
+	}
+	if err := ConvertJsonToQueryMap(POSTGRES_QUERY_MAP); err != nil {
+		t.Fatalf("Failed to read query map %v", err)
+	}
+	pgDB, err := PostgresDatabaseAccess{
+		Username: os.Getenv("POSTGRES_TEST_USER"),
+		Password: os.Getenv("POSTGRES_TEST_PASSWORD"),
+		Address: address,
+		DBName: dbName,
+	}.ConnectDatabase()
+	if err != nil {
+		t.Fatalf("Cannot Connect to DB %v", err)
+	}
+	defer pgDB.Close()
+	if err := pgDB.Ping(); err != nil {
+		t.Fatalf("Failed to Ping %v", err)
+	}
+	migrator, err := NewMigrator(pgDB, MigrationDirectory("."))
+	if err != nil {
+		t.Fatalf("Failed to load migration %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Failed to migrate %v", err)
+	}
+
+	user := UserProfile{
+		Id: "user/postgres/" + strconv.FormatInt(time.Now().UnixNano(), 10),
+		Email: "o'brien@example.com",
+	}
+	if _, err := user.Insert(pgDB); err != nil {
+		t.Fatalf("Failed to insert user %v", err)
+	}
+	topicId, err := Topic{UserId: user.Id, Title: "it's a topic"}.Insert(pgDB)
+	if err != nil {
+		t.Fatalf("Failed to insert topic %v", err)
+	}
+	if topicId == 0 {
+		t.Fatalf("topic id should be returned")
+	}
+	notifications := Notifications{
+		Notification{UserId: user.Id, TopicId: int(topicId), Message: "'); DROP TABLE notifications; --"},
+		Notification{UserId: user.Id, TopicId: int(topicId), Message: "second"},
+	}
+	if _, err := notifications.Insert(pgDB); err != nil {
+		t.Fatalf("Failed to insert notification %v", err)
+	}
+
+	stored := Notifications{}
+	qb := NewQueryBuilder().Where("user_id", "=", user.Id).OrderBy("id", ORDER_ASC)
+	if err := stored.Get(pgDB, qb); err != nil {
+		t.Fatalf("Failed to get notification %v", err)
+	}
+	if len(stored) != 2 || stored[0].Message != notifications[0].Message {
+		t.Fatalf("want %v get %v", notifications, stored)
+	}
+	if _, err := stored.UpdateReadNotification(pgDB); err != nil {
+		t.Fatalf("Failed to mark read %v", err)
+	}
+	read := Notification{Id: stored[1].Id}
+	if err := read.Get(pgDB); err != nil {
+		t.Fatalf("Failed to get notification %v", err)
+	}
+	if !read.IsRead {
+		t.Fatalf("want true get %v", read.IsRead)
+	}
+	if _, err := stored.Delete(pgDB); err != nil {
+		t.Fatalf("Failed to delete notification %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	ORDER_ASC = "ASC"
+	ORDER_DESC = "DESC"
+	// Not a string escape on any dialect unlike backslash on MySQL
+	LIKE_ESCAPE = "!"
+)
+
+var (
+	ErrInvalidColumn = errors.New("INVALID COLUMN")
+	ErrInvalidOperator = errors.New("INVALID OPERATOR")
+	ErrEmptyIn = errors.New("EMPTY IN VALUE")
+	ErrInvalidDirection = errors.New("INVALID ORDER DIRECTION")
+	ErrInvalidLimit = errors.New("INVALID LIMIT OR OFFSET")
+)
+
+/**
+	condition is a single part of where clause. It either a comparison,
+	an IN, a NULL check, or a group of other condition in parentheses
+*/
+type condition struct {
+	connector string
+	column string
+	operator string
+	args []interface{}
+	group *QueryBuilder
+}
+
+type orderBy struct {
+	column string
+	direction string
+}
+
+/**
+	QueryBuilder compose the select column and everything after WHERE.
+	Condition is joined with AND unless Or is called before it. Every
+	value become a placeholder, column is checked against the model
+	ColumnMatcher when the query is built. Error is kept and returned
+	on Build so the chain does not need to be checked on every call
+*/
+type QueryBuilder struct {
+	selectColumn []string
+	conditions []condition
+	connector string
+	orders []orderBy
+	limit int
+	offset int
+	err error
+}
+
+func NewQueryBuilder() *QueryBuilder {
+	return &QueryBuilder{
+		connector: "AND",
+	}
+}
+
+func (qb *QueryBuilder) setError(err error) *QueryBuilder {
+	if qb.err == nil {
+		qb.err = err
+	}
+	return qb
+}
+
+func (qb *QueryBuilder) addCondition(c condition) *QueryBuilder {
+	c.connector = qb.connector
+	qb.conditions = append(qb.conditions, c)
+	qb.connector = "AND"
+	return qb
+}
+
+func (qb *QueryBuilder) Select(columns ...string) *QueryBuilder {
+	qb.selectColumn = append(qb.selectColumn, columns...)
+	return qb
+}
+
+// Select column that need to be scanned, empty select means every column
+func (qb *QueryBuilder) SelectColumn() []string {
+	if len(qb.selectColumn) == 0 {
+		return []string{"*"}
+	}
+	return qb.selectColumn
+}
+
+func (qb *QueryBuilder) Where(column, operator string, value interface{}) *QueryBuilder {
+	operator = strings.ToUpper(operator)
+	if !allowedOperator[operator] {
+		return qb.setError(fmt.Errorf("%w %q", ErrInvalidOperator, operator))
+	}
+	return qb.addCondition(condition{
+		column: column,
+		operator: operator,
+		args: []interface{}{value},
+	})
+}
+
+// Join the next condition with AND, this is the default
+func (qb *QueryBuilder) And() *QueryBuilder {
+	qb.connector = "AND"
+	return qb
+}
+
+// Join the next condition with OR
+func (qb *QueryBuilder) Or() *QueryBuilder {
+	qb.connector = "OR"
+	return qb
+}
+
+func (qb *QueryBuilder) In(column string, values ...interface{}) *QueryBuilder {
+	if len(values) == 0 {
+		return qb.setError(fmt.Errorf("%w %q", ErrEmptyIn, column))
+	}
+	return qb.addCondition(condition{
+		column: column,
+		operator: "IN",
+		args: values,
+	})
+}
+
+/**
+	Case insensitive substring match that behave the same on every
+	dialect, LIKE alone is case sensitive on Postgres. Both side is
+	lowered and wildcard in the text is escaped so it only match itself
+*/
+func (qb *QueryBuilder) Contains(column, text string) *QueryBuilder {
+	pattern := strings.NewReplacer(LIKE_ESCAPE, LIKE_ESCAPE+LIKE_ESCAPE, "%", LIKE_ESCAPE+"%", "_", LIKE_ESCAPE+"_").
+		Replace(strings.ToLower(text))
+	return qb.addCondition(condition{
+		column: column,
+		operator: "CONTAINS",
+		args: []interface{}{"%" + pattern + "%"},
+	})
+}
+
+func (qb *QueryBuilder) IsNull(column string) *QueryBuilder {
+	return qb.addCondition(condition{
+		column: column,
+		operator: "IS NULL",
+	})
+}
+
+func (qb *QueryBuilder) IsNotNull(column string) *QueryBuilder {
+	return qb.addCondition(condition{
+		column: column,
+		operator: "IS NOT NULL",
+	})
+}
+
+/**
+	Put every condition added inside the function into parentheses
+	e.g Group(func(g) { g.Where(a).Or().Where(b) }) become (a OR b)
+*/
+func (qb *QueryBuilder) Group(compose func(group *QueryBuilder)) *QueryBuilder {
+	group := NewQueryBuilder()
+	compose(group)
+	if group.err != nil {
+		return qb.setError(group.err)
+	}
+	if len(group.conditions) == 0 {
+		return qb
+	}
+	return qb.addCondition(condition{
+		group: group,
+	})
+}
+
+func (qb *QueryBuilder) OrderBy(column, direction string) *QueryBuilder {
+	direction = strings.ToUpper(direction)
+	if direction != ORDER_ASC && direction != ORDER_DESC {
+		return qb.setError(fmt.Errorf("%w %q", ErrInvalidDirection, direction))
+	}
+	qb.orders = append(qb.orders, orderBy{column, direction})
+	return qb
+}
+
+func (qb *QueryBuilder) Limit(limit int) *QueryBuilder {
+	if limit < 0 {
+		return qb.setError(ErrInvalidLimit)
+	}
+	qb.limit = limit
+	return qb
+}
+
+func (qb *QueryBuilder) Offset(offset int) *QueryBuilder {
+	if offset < 0 {
+		return qb.setError(ErrInvalidLimit)
+	}
+	qb.offset = offset
+	return qb
+}
+
+func validateColumn(model IColumnMatcher, column string) error {
+	if model.ColumnMatcher(column) == nil {
+		return fmt.Errorf("%w %q", ErrInvalidColumn, column)
+	}
+	return nil
+}
+
+func (qb *QueryBuilder) buildCondition(model IColumnMatcher) (string, []interface{}, error) {
+	query := ""
+	args := []interface{}{}
+	for i, c := range qb.conditions {
+		if i > 0 {
+			query += " " + c.connector + " "
+		}
+		if c.group != nil {
+			groupQuery, groupArgs, err := c.group.buildCondition(model)
+			if err != nil {
+				return "", args, err
+			}
+			query += "(" + groupQuery + ")"
+			args = append(args, groupArgs...)
+			continue
+		}
+		if err := validateColumn(model, c.column); err != nil {
+			return "", args, err
+		}
+		switch c.operator {
+		case "IS NULL", "IS NOT NULL":
+			query += fmt.Sprintf("%s %s", c.column, c.operator)
+		case "IN":
+			query += fmt.Sprintf("%s IN %s", c.column, placeholderGroup(len(c.args)))
+		case "CONTAINS":
+			query += fmt.Sprintf("LOWER(%s) LIKE ? ESCAPE '%s'", c.column, LIKE_ESCAPE)
+		default:
+			query += fmt.Sprintf("%s %s ?", c.column, c.operator)
+		}
+		args = append(args, c.args...)
+	}
+	return query, args, nil
+}
+
+/**
+	Build return the select column and the clause after table name
+	along with its argument. Column that the model does not know
+	is rejected, so is offset without limit since MySQL cannot parse it
+*/
+func (qb *QueryBuilder) Build(model IColumnMatcher) (string, string, []interface{}, error) {
+	args := []interface{}{}
+	if qb.err != nil {
+		return "", "", args, qb.err
+	}
+	if qb.offset > 0 && qb.limit == 0 {
+		return "", "", args, ErrInvalidLimit
+	}
+	selectColumn := qb.SelectColumn()
+	if !(len(selectColumn) == 1 && selectColumn[0] == "*") {
+		for _, column := range selectColumn {
+			if err := validateColumn(model, column); err != nil {
+				return "", "", args, err
+			}
+		}
+	}
+	clause := ""
+	if len(qb.conditions) != 0 {
+		where, whereArgs, err := qb.buildCondition(model)
+		if err != nil {
+			return "", "", args, err
+		}
+		clause += "WHERE " + where
+		args = append(args, whereArgs...)
+	}
+	if len(qb.orders) != 0 {
+		orders := make([]string, len(qb.orders))
+		for i, order := range qb.orders {
+			if err := validateColumn(model, order.column); err != nil {
+				return "", "", args, err
+			}
+			orders[i] = order.column + " " + order.direction
+		}
+		clause += " ORDER BY " + strings.Join(orders, ", ")
+	}
+	if qb.limit > 0 {
+		clause += fmt.Sprintf(" LIMIT %d", qb.limit)
+	}
+	if qb.offset > 0 {
+		clause += fmt.Sprintf(" OFFSET %d", qb.offset)
+	}
+	return strings.Join(selectColumn, ","), strings.TrimSpace(clause), args, nil
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestQueryBuilderWhere(t *testing.T) {
+	qb := NewQueryBuilder().
+		Select("id", "message").
+		Where("user_id", "=", "user/1").
+		And().
+		Where("id", ">", 10).
+		OrderBy("id", "asc").
+		Limit(20).
+		Offset(40)
+	column, clause, args, err := qb.Build(&Notification{})
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if column != "id,message" {
+		t.Fatalf("want id,message get %v", column)
+	}
+	want := "WHERE user_id = ? AND id > ? ORDER BY id ASC LIMIT 20 OFFSET 40"
+	if clause != want {
+		t.Fatalf("want %v get %v", want, clause)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"user/1", 10}) {
+		t.Fatalf("want %v get %v", []interface{}{"user/1", 10}, args)
+	}
+}
+
+func TestQueryBuilderGroup(t *testing.T) {
+	qb := NewQueryBuilder().
+		Group(func(g *QueryBuilder) {
+			g.In("state", JOB_STATE_PENDING, JOB_STATE_FAILED).Where("available_at", "<=", 5)
+		}).
+		Or().
+		Group(func(g *QueryBuilder) {
+			g.Where("state", "=", JOB_STATE_IN_FLIGHT).Where("locked_until", "<=", 5)
+		}).
+		And().
+		IsNotNull("claim_token")
+	column, clause, args, err := qb.Build(&DeliveryJob{})
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if column != "*" {
+		t.Fatalf("want * get %v", column)
+	}
+	want := "WHERE (state IN (?,?) AND available_at <= ?) OR (state = ? AND locked_until <= ?) AND claim_token IS NOT NULL"
+	if clause != want {
+		t.Fatalf("want %v get %v", want, clause)
+	}
+	wantArgs := []interface{}{JOB_STATE_PENDING, JOB_STATE_FAILED, 5, JOB_STATE_IN_FLIGHT, 5}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("want %v get %v", wantArgs, args)
+	}
+}
+
+func TestQueryBuilderLike(t *testing.T) {
+	_, clause, args, err := NewQueryBuilder().Where("message", "like", "%it's%").Build(&Notification{})
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if clause != "WHERE message LIKE ?" {
+		t.Fatalf("want WHERE message LIKE ? get %v", clause)
+	}
+	if args[0] != "%it's%" {
+		t.Fatalf("want %%it's%% get %v", args[0])
+	}
+}
+
+func TestQueryBuilderContains(t *testing.T) {
+	_, clause, args, err := NewQueryBuilder().Contains("message", "50%_Off!").Build(&Notification{})
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if clause != "WHERE LOWER(message) LIKE ? ESCAPE '!'" {
+		t.Fatalf("want WHERE LOWER(message) LIKE ? ESCAPE '!' get %v", clause)
+	}
+	if args[0] != "%50!%!_off!!%" {
+		t.Fatalf("want %%50!%%!_off!!%% get %v", args[0])
+	}
+	notification := &Notification{Message: "Get 50%_OFF! today"}
+	if !(condition{column: "message", operator: "CONTAINS", args: args}).match(notification) {
+		t.Fatalf("memory store should match %v", notification.Message)
+	}
+	notification.Message = "Get 50 pct OFF today"
+	if (condition{column: "message", operator: "CONTAINS", args: args}).match(notification) {
+		t.Fatalf("memory store should not match %v", notification.Message)
+	}
+}
+
+func TestQueryBuilderError(t *testing.T) {
+	cases := []struct{
+		qb *QueryBuilder
+		err error
+	}{
+		{NewQueryBuilder().Where("unknown", "=", 1), ErrInvalidColumn},
+		{NewQueryBuilder().Select("id", "unknown"), ErrInvalidColumn},
+		{NewQueryBuilder().Where("id", "; DROP", 1), ErrInvalidOperator},
+		{NewQueryBuilder().In("id"), ErrEmptyIn},
+		{NewQueryBuilder().OrderBy("id", "sideways"), ErrInvalidDirection},
+		{NewQueryBuilder().Limit(-1), ErrInvalidLimit},
+		{NewQueryBuilder().Offset(10), ErrInvalidLimit},
+		{NewQueryBuilder().Group(func(g *QueryBuilder) { g.Where("id", "~", 1) }), ErrInvalidOperator},
+		{NewQueryBuilder().Group(func(g *QueryBuilder) { g.IsNull("unknown") }), ErrInvalidColumn},
+	}
+	for _, c := range cases {
+		_, _, _, err := c.qb.Build(&Notification{})
+		if !errors.Is(err, c.err) {
+			t.Fatalf("want %v get %v", c.err, err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"database/sql"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	SQLITE_MEMORY = ":memory:"
+	SQLITE_QUERY_MAP = "queryMap.sqlite.json"
+	MYSQL_QUERY_MAP = "queryMap.json"
+)
+
+/**
+	SqliteDatabaseAccess open a SQLite file, or an in-memory database
+	when Path is empty. Meant for local development and test so nobody
+	need a running MySQL
+*/
+type SqliteDatabaseAccess struct {
+	Path string
+}
+
+func (sda SqliteDatabaseAccess) ConnectDatabase() (ITransactionSQL, error) {
+	path := sda.Path
+	if len(path) == 0 {
+		path = SQLITE_MEMORY
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	// every connection to :memory: is a different database
+	// and SQLite only allow one writer anyway
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+func (sda SqliteDatabaseAccess) QueryMapName() string {
+	return SQLITE_QUERY_MAP
+}
+
+func (mda MysqlDatabaseAccess) QueryMapName() string {
+	return MYSQL_QUERY_MAP
+}
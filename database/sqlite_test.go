@@ -0,0 +1,380 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestSqliteInMemory(t *testing.T) {
+	if err := ConvertJsonToQueryMap(SQLITE_QUERY_MAP); err != nil {
+		t.Fatalf("Failed to read query map %v", err)
+	}
+	memoryDB, err := SqliteDatabaseAccess{}.ConnectDatabase()
+	if err != nil {
+		t.Fatalf("Cannot Connect to DB %v", err)
+	}
+	defer memoryDB.Close()
+	migrator, err := NewMigrator(memoryDB, MigrationDirectory("."))
+	if err != nil {
+		t.Fatalf("Failed to load migration %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Failed to migrate %v", err)
+	}
+
+	user := UserProfile{Id: "user/sqlite", Email: "o'brien@example.com"}
+	if _, err := user.Insert(memoryDB); err != nil {
+		t.Fatalf("Failed to insert user %v", err)
+	}
+	topic := Topic{UserId: user.Id, Title: "it's a topic"}
+	topicId, err := topic.Insert(memoryDB)
+	if err != nil {
+		t.Fatalf("Failed to insert topic %v", err)
+	}
+	message := "'); DROP TABLE notifications; --"
+	notifications := Notifications{
+		Notification{UserId: user.Id, TopicId: int(topicId), Message: message},
+	}
+	if _, err := notifications.Insert(memoryDB); err != nil {
+		t.Fatalf("Failed to insert notification %v", err)
+	}
+
+	stored := Notifications{}
+	qb := NewQueryBuilder().Where("user_id", "=", user.Id)
+	if err := stored.Get(memoryDB, qb); err != nil {
+		t.Fatalf("Failed to get notification %v", err)
+	}
+	if len(stored) != 1 || stored[0].Message != message || stored[0].IsRead {
+		t.Fatalf("want unread %v get %v", message, stored)
+	}
+	if _, err := stored.UpdateReadNotification(memoryDB); err != nil {
+		t.Fatalf("Failed to mark read %v", err)
+	}
+	read := Notification{Id: stored[0].Id}
+	if err := read.Get(memoryDB); err != nil {
+		t.Fatalf("Failed to get notification %v", err)
+	}
+	if !read.IsRead {
+		t.Fatalf("want true get %v", read.IsRead)
+	}
+}
+
+func TestSqliteRefreshToken(t *testing.T) {
+	if err := ConvertJsonToQueryMap(SQLITE_QUERY_MAP); err != nil {
+		t.Fatalf("Failed to read query map %v", err)
+	}
+	memoryDB, err := SqliteDatabaseAccess{}.ConnectDatabase()
+	if err != nil {
+		t.Fatalf("Cannot Connect to DB %v", err)
+	}
+	defer memoryDB.Close()
+	migrator, err := NewMigrator(memoryDB, MigrationDirectory("."))
+	if err != nil {
+		t.Fatalf("Failed to load migration %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Failed to migrate %v", err)
+	}
+	user := UserProfile{Id: "user/refresh", Email: "refresh@example.com"}
+	if _, err := user.Insert(memoryDB); err != nil {
+		t.Fatalf("Failed to insert user %v", err)
+	}
+	checkRefreshTokenRotation(t, NewSQLStore(memoryDB), user.Id)
+}
+
+// Subscriber with a notification whose delivery job is already a dead letter
+func sqliteStoreWithDeadLetter(t *testing.T) (*SQLStore, Subscriber, Notifications) {
+	if err := ConvertJsonToQueryMap(SQLITE_QUERY_MAP); err != nil {
+		t.Fatalf("Failed to read query map %v", err)
+	}
+	memoryDB, err := SqliteDatabaseAccess{}.ConnectDatabase()
+	if err != nil {
+		t.Fatalf("Cannot Connect to DB %v", err)
+	}
+	t.Cleanup(func() { memoryDB.Close() })
+	migrator, err := NewMigrator(memoryDB, MigrationDirectory("."))
+	if err != nil {
+		t.Fatalf("Failed to load migration %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Failed to migrate %v", err)
+	}
+	store := NewSQLStore(memoryDB)
+	user := UserProfile{Id: "user/subscriber", Email: "subscriber@example.com"}
+	if err := store.InsertUser(user); err != nil {
+		t.Fatalf("Failed to insert user %v", err)
+	}
+	topicId, err := store.InsertTopic(Topic{UserId: user.Id, Title: "topic"})
+	if err != nil {
+		t.Fatalf("Failed to insert topic %v", err)
+	}
+	subscriber := Subscriber{TopicId: int(topicId), UserId: user.Id, UnsubscribeToken: "token"}
+	subscriberId, err := store.InsertSubscriber(subscriber)
+	if err != nil {
+		t.Fatalf("Failed to insert subscriber %v", err)
+	}
+	subscriber.Id = int(subscriberId)
+	withJob := func(notification Notification) (*DeliveryJob, error) {
+		return &DeliveryJob{SubscriberId: subscriber.Id, NotificationId: notification.Id, State: JOB_STATE_DEAD}, nil
+	}
+	notifications := Notifications{Notification{UserId: user.Id, TopicId: int(topicId), Message: "hello", CreatedAt: 1700000000}}
+	if err := store.InsertNotifications(notifications, withJob); err != nil {
+		t.Fatalf("Failed to insert notification %v", err)
+	}
+	jobs := DeliveryJobs{}
+	if err := jobs.Get(memoryDB, NewQueryBuilder()); err != nil {
+		t.Fatalf("Failed to get job %v", err)
+	}
+	if _, err := NewDeadLetter(jobs[0], 1).Insert(memoryDB); err != nil {
+		t.Fatalf("Failed to insert dead letter %v", err)
+	}
+	return store, subscriber, notifications
+}
+
+func TestSqliteDeleteSubscriber(t *testing.T) {
+	store, subscriber, _ := sqliteStoreWithDeadLetter(t)
+	// job referenced by a dead letter should not block the delete
+	if err := store.DeleteSubscriber(subscriber); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if _, err := store.GetSubscribers(NewQueryBuilder()); err != sql.ErrNoRows {
+		t.Fatalf("want %v get %v", sql.ErrNoRows, err)
+	}
+}
+
+func TestSqliteDeleteNotifications(t *testing.T) {
+	store, _, notifications := sqliteStoreWithDeadLetter(t)
+	if err := store.DeleteNotifications(notifications); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if _, err := store.GetNotifications(NewQueryBuilder()); err != sql.ErrNoRows {
+		t.Fatalf("want %v get %v", sql.ErrNoRows, err)
+	}
+}
+
+// More row than sqlite allow as variable, so the id list cannot be used here
+func TestSqliteUserNotificationsManyRows(t *testing.T) {
+	store, subscriber, notifications := sqliteStoreWithDeadLetter(t)
+	many := make(Notifications, 40000)
+	for i := range many {
+		many[i] = Notification{UserId: subscriber.UserId, TopicId: subscriber.TopicId, Message: "many"}
+	}
+	noJob := func(notification Notification) (*DeliveryJob, error) {
+		return nil, nil
+	}
+	if err := store.InsertNotifications(many, noJob); err != nil {
+		t.Fatalf("Failed to insert notification %v", err)
+	}
+	before := UserNotifications{UserId: subscriber.UserId, BeforeId: many[20000].Id}
+	if updated, err := store.UpdateReadUserNotifications(before); err != nil || updated != 20001 {
+		t.Fatalf("want 20001 get %v %v", updated, err)
+	}
+	all := UserNotifications{UserId: subscriber.UserId}
+	if updated, err := store.UpdateReadUserNotifications(all); err != nil || updated != 20000 {
+		t.Fatalf("want 20000 get %v %v", updated, err)
+	}
+	if updated, err := store.UpdateReadUserNotifications(UserNotifications{UserId: "user/nobody"}); err != nil || updated != 0 {
+		t.Fatalf("want 0 get %v %v", updated, err)
+	}
+	// dead letter of the first notification should not block the delete
+	if deleted, err := store.DeleteUserNotifications(before); err != nil || deleted != 20001 {
+		t.Fatalf("want 20001 get %v %v", deleted, err)
+	}
+	if _, err := store.GetNotifications(NewQueryBuilder().Where("id", "=", notifications[0].Id)); err != sql.ErrNoRows {
+		t.Fatalf("want %v get %v", sql.ErrNoRows, err)
+	}
+	if deleted, err := store.DeleteUserNotifications(all); err != nil || deleted != 20000 {
+		t.Fatalf("want 20000 get %v %v", deleted, err)
+	}
+	if _, err := store.GetNotifications(NewQueryBuilder()); err != sql.ErrNoRows {
+		t.Fatalf("want %v get %v", sql.ErrNoRows, err)
+	}
+}
+
+func TestSqliteCountUnreadNotifications(t *testing.T) {
+	store, subscriber, notifications := sqliteStoreWithDeadLetter(t)
+	topicId, err := store.InsertTopic(Topic{UserId: subscriber.UserId, Title: "another topic"})
+	if err != nil {
+		t.Fatalf("Failed to insert topic %v", err)
+	}
+	others := Notifications{
+		Notification{UserId: subscriber.UserId, TopicId: int(topicId), Message: "one"},
+		Notification{UserId: subscriber.UserId, TopicId: int(topicId), Message: "two"},
+		Notification{UserId: subscriber.UserId, TopicId: int(topicId), Message: "three"},
+	}
+	noJob := func(notification Notification) (*DeliveryJob, error) {
+		return nil, nil
+	}
+	if err := store.InsertNotifications(others, noJob); err != nil {
+		t.Fatalf("Failed to insert notification %v", err)
+	}
+	if updated, err := store.UpdateReadNotification(others[:1]); err != nil || updated != 1 {
+		t.Fatalf("Failed to mark read %v %v", updated, err)
+	}
+	// read twice is only counted once
+	if updated, err := store.UpdateReadNotification(others[:1]); err != nil || updated != 0 {
+		t.Fatalf("want 0 get %v %v", updated, err)
+	}
+	unreadCounts, err := store.CountUnreadNotifications(subscriber.UserId)
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	want := UnreadCounts{{TopicId: notifications[0].TopicId, Count: 1}, {TopicId: int(topicId), Count: 2}}
+	if len(unreadCounts) != 2 || unreadCounts[0] != want[0] || unreadCounts[1] != want[1] {
+		t.Fatalf("want %v get %v", want, unreadCounts)
+	}
+	unreadCounts, err = store.CountUnreadNotifications("user/nobody")
+	if err != nil || len(unreadCounts) != 0 {
+		t.Fatalf("want empty get %v %v", unreadCounts, err)
+	}
+}
+
+func TestSqliteDeleteTopic(t *testing.T) {
+	store, subscriber, notifications := sqliteStoreWithDeadLetter(t)
+	if count, err := store.CountSubscribers(subscriber.TopicId); err != nil || count != 1 {
+		t.Fatalf("want 1 get %v %v", count, err)
+	}
+	topic := Topic{Id: subscriber.TopicId, Title: "renamed", Desc: "it's renamed"}
+	if err := store.UpdateTopic(topic, []string{"title", "user_id"}); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	topic.DeletedAt = 1700000000
+	// subscriber with a dead letter should not block the delete
+	if err := store.DeleteTopic(topic); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	topics, err := store.GetTopics(NewQueryBuilder().Where("id", "=", topic.Id))
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if topics[0].Title != "renamed" || topics[0].Desc != "" || topics[0].UserId != subscriber.UserId || topics[0].DeletedAt != topic.DeletedAt {
+		t.Fatalf("want renamed and deleted topic get %v", topics[0])
+	}
+	if count, err := store.CountSubscribers(topic.Id); err != nil || count != 0 {
+		t.Fatalf("want 0 get %v %v", count, err)
+	}
+	// notification already sent is kept
+	if stored, err := store.GetNotifications(NewQueryBuilder()); err != nil || stored[0].Id != notifications[0].Id {
+		t.Fatalf("want %v get %v %v", notifications, stored, err)
+	}
+}
+
+func TestSqliteDeleteUser(t *testing.T) {
+	store, subscriber, _ := sqliteStoreWithDeadLetter(t)
+	owner := UserProfile{Id: "user/owner", Email: "owner@example.com"}
+	if err := store.InsertUser(owner); err != nil {
+		t.Fatalf("Failed to insert user %v", err)
+	}
+	topicId, err := store.InsertTopic(Topic{UserId: owner.Id, Title: "kept", Tags: []string{"news"}})
+	if err != nil {
+		t.Fatalf("Failed to insert topic %v", err)
+	}
+	// subscription of the user elsewhere and of another user to the owned topic
+	if _, err := store.InsertSubscriber(Subscriber{TopicId: int(topicId), UserId: subscriber.UserId, UnsubscribeToken: "elsewhere"}); err != nil {
+		t.Fatalf("Failed to insert subscriber %v", err)
+	}
+	if _, err := store.InsertSubscriber(Subscriber{TopicId: subscriber.TopicId, UserId: owner.Id, UnsubscribeToken: "owned"}); err != nil {
+		t.Fatalf("Failed to insert subscriber %v", err)
+	}
+	withoutJob := func(notification Notification) (*DeliveryJob, error) {
+		return nil, nil
+	}
+	if _, err := store.InsertTopicMember(TopicMember{TopicId: int(topicId), UserId: subscriber.UserId, Role: TOPIC_ROLE_SUBSCRIBER}); err != nil {
+		t.Fatalf("Failed to insert member %v", err)
+	}
+	if err := store.InsertNotifications(Notifications{Notification{UserId: owner.Id, TopicId: subscriber.TopicId, Message: "owned"}}, withoutJob); err != nil {
+		t.Fatalf("Failed to insert notification %v", err)
+	}
+
+	if err := store.DeleteUser(UserProfile{Id: subscriber.UserId}); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if _, err := store.FindUser(NewQueryBuilder().Where("id", "=", subscriber.UserId)); err != sql.ErrNoRows {
+		t.Fatalf("want %v get %v", sql.ErrNoRows, err)
+	}
+	topics, err := store.GetTopics(NewQueryBuilder())
+	if err != nil || len(topics) != 1 || topics[0].Id != int(topicId) {
+		t.Fatalf("want only topic %v get %v %v", topicId, topics, err)
+	}
+	if _, err := store.GetSubscribers(NewQueryBuilder()); err != sql.ErrNoRows {
+		t.Fatalf("want %v get %v", sql.ErrNoRows, err)
+	}
+	if _, err := store.GetNotifications(NewQueryBuilder()); err != sql.ErrNoRows {
+		t.Fatalf("want %v get %v", sql.ErrNoRows, err)
+	}
+	deadLetters := DeadLetters{}
+	if err := deadLetters.Get(store.DB, NewQueryBuilder()); err != sql.ErrNoRows {
+		t.Fatalf("want %v get %v", sql.ErrNoRows, err)
+	}
+	members, err := store.GetTopicMembers(NewQueryBuilder())
+	if err != nil || len(members) != 1 || members[0].UserId != owner.Id {
+		t.Fatalf("want only the owner membership get %v %v", members, err)
+	}
+}
+
+func TestSqliteDecideSubscriptionRequest(t *testing.T) {
+	store, subscriber, _ := sqliteStoreWithDeadLetter(t)
+	user := UserProfile{Id: "user/requester", Email: "requester@example.com"}
+	if err := store.InsertUser(user); err != nil {
+		t.Fatalf("Failed to insert user %v", err)
+	}
+	pending := SubscriptionRequest{TopicId: subscriber.TopicId, UserId: user.Id, Status: SUBSCRIPTION_REQUEST_PENDING}
+	requestId, err := store.InsertSubscriptionRequest(pending)
+	if err != nil {
+		t.Fatalf("Failed to insert request %v", err)
+	}
+	rejected := SubscriptionRequest{Id: int(requestId), TopicId: subscriber.TopicId, UserId: user.Id, Status: SUBSCRIPTION_REQUEST_REJECTED, DecidedBy: subscriber.UserId, DecidedAt: 10}
+	if err := store.DecideSubscriptionRequest(rejected, pending.Subscriber()); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	// a second admin still holding the pending request
+	approved := rejected
+	approved.Status = SUBSCRIPTION_REQUEST_APPROVED
+	if err := store.DecideSubscriptionRequest(approved, Subscriber{TopicId: subscriber.TopicId, UserId: user.Id, UnsubscribeToken: "late"}); err != ErrAlreadyDecided {
+		t.Fatalf("want %v get %v", ErrAlreadyDecided, err)
+	}
+	if _, err := store.GetSubscribers(NewQueryBuilder().Where("user_id", "=", user.Id)); err != sql.ErrNoRows {
+		t.Fatalf("late approval should not subscribe get %v", err)
+	}
+	stored, err := store.GetSubscriptionRequests(NewQueryBuilder().Where("id", "=", requestId))
+	if err != nil || stored[0].Status != SUBSCRIPTION_REQUEST_REJECTED {
+		t.Fatalf("want rejected request get %v %v", stored, err)
+	}
+}
+
+func TestSqliteSearchTopics(t *testing.T) {
+	store, subscriber, notifications := sqliteStoreWithDeadLetter(t)
+	quietId, err := store.InsertTopic(Topic{UserId: subscriber.UserId, Title: "quiet", Desc: "nothing here", Visibility: TOPIC_VISIBILITY_PUBLIC, Tags: []string{"go", "news"}})
+	if err != nil {
+		t.Fatalf("Failed to insert topic %v", err)
+	}
+	topicTags, err := store.GetTopicTags(NewQueryBuilder().Where("topic_id", "=", quietId).OrderBy("tag", ORDER_ASC))
+	if err != nil || len(topicTags) != 2 || topicTags[0].Tag != "go" || topicTags[1].Tag != "news" {
+		t.Fatalf("want go and news get %v %v", topicTags, err)
+	}
+	if err := store.UpdateTopic(Topic{Id: int(quietId), Tags: []string{"sport"}}, []string{"tags"}); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	topicTags, err = store.GetTopicTags(NewQueryBuilder().Where("topic_id", "=", quietId))
+	if err != nil || len(topicTags) != 1 || topicTags[0].Tag != "sport" {
+		t.Fatalf("want sport get %v %v", topicTags, err)
+	}
+
+	qb := NewQueryBuilder().Where("deleted_at", "=", 0).OrderBy("subscriber_count", ORDER_DESC).OrderBy("id", ORDER_DESC)
+	topicStats, err := store.SearchTopics(qb)
+	if err != nil || len(topicStats) != 2 {
+		t.Fatalf("want 2 topic get %v %v", topicStats, err)
+	}
+	if topicStats[0].Id != subscriber.TopicId || topicStats[0].SubscriberCount != 1 || topicStats[1].SubscriberCount != 0 {
+		t.Fatalf("want busiest topic first get %v", topicStats)
+	}
+	if topicStats[0].LastActivityAt != notifications[0].CreatedAt || topicStats[1].LastActivityAt != 0 {
+		t.Fatalf("want last activity of the notification get %v", topicStats)
+	}
+	qb = NewQueryBuilder().Group(func(group *QueryBuilder) {
+		group.Where("title", "LIKE", "%HERE%").Or().Where("description", "LIKE", "%HERE%")
+	}).Limit(1)
+	if topicStats, err = store.SearchTopics(qb); err != nil || len(topicStats) != 1 || topicStats[0].Id != int(quietId) {
+		t.Fatalf("want quiet topic get %v %v", topicStats, err)
+	}
+}
@@ -0,0 +1,496 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+/**
+	Store is the model layer used by the handler. SQLStore go to the
+	database through the model, MemoryStore keep everything in memory
+	for test. Get return sql.ErrNoRows when nothing match, same as the model
+*/
+type Store interface {
+	InsertUser(user UserProfile) error
+	FindUser(qb *QueryBuilder) (UserProfile, error)
+	UpdateUser(user UserProfile, updateables []string) error
+	DeleteUser(user UserProfile) error
+
+	// The topic user become its owner member and its tags are written in the same write
+	InsertTopic(topic Topic) (int64, error)
+	GetTopics(qb *QueryBuilder) (Topics, error)
+	// "tags" in updateables replace every tag of the topic with topic.Tags
+	UpdateTopic(topic Topic, updateables []string) error
+	/**
+		Soft delete the topic with topic.DeletedAt. Every subscriber is
+		removed with its delivery so nothing is sent anymore, notification
+		already sent stay in the inbox of its user
+	*/
+	DeleteTopic(topic Topic) error
+	CountSubscribers(topicId int) (int, error)
+	GetTopicTags(qb *QueryBuilder) (TopicTags, error)
+	// Query on TopicStat column, deleted topic is included unless filtered
+	SearchTopics(qb *QueryBuilder) (TopicStats, error)
+
+	InsertSubscriber(subscriber Subscriber) (int64, error)
+	GetSubscribers(qb *QueryBuilder) (Subscribers, error)
+	// Remove the subscriber by id together with its delivery job and attempt
+	DeleteSubscriber(subscriber Subscriber) error
+
+	/**
+		Write every notification and set its id. Delivery job returned by
+		jobFor is written together with the notification, nil mean no job
+	*/
+	InsertNotifications(notifications Notifications, jobFor func(notification Notification) (*DeliveryJob, error)) error
+	GetNotifications(qb *QueryBuilder) (Notifications, error)
+	// Mark by id, return how many was unread before
+	UpdateReadNotification(notifications Notifications) (int64, error)
+	// Remove by id together with its delivery job, attempt and dead letter
+	DeleteNotifications(notifications Notifications) error
+	// Same as above but for every notification of the user, return how many is touched
+	UpdateReadUserNotifications(userNotifications UserNotifications) (int64, error)
+	DeleteUserNotifications(userNotifications UserNotifications) (int64, error)
+	// Unread notification of the user per topic, empty instead of sql.ErrNoRows
+	CountUnreadNotifications(userId string) (UnreadCounts, error)
+
+	InsertTopicMember(topicMember TopicMember) (int64, error)
+	GetTopicMembers(qb *QueryBuilder) (TopicMembers, error)
+	UpdateTopicMemberRole(topicMember TopicMember) error
+	DeleteTopicMember(topicMember TopicMember) error
+	/**
+		Move topics.user_id to the new owner, it must already be a member.
+		The new owner get the owner role and the previous owner become admin
+	*/
+	TransferTopicOwnership(topicId int, from string, to string) error
+
+	InsertSubscriptionRequest(subscriptionRequest SubscriptionRequest) (int64, error)
+	GetSubscriptionRequests(qb *QueryBuilder) (SubscriptionRequests, error)
+	/**
+		Write the decision. Approved request also write subscriber and
+		make the user a subscriber member when it is not a member yet.
+		ErrAlreadyDecided when the request is not pending anymore
+	*/
+	DecideSubscriptionRequest(subscriptionRequest SubscriptionRequest, subscriber Subscriber) error
+
+	InsertAuditLog(auditLog AuditLog) (int64, error)
+	GetAuditLogs(qb *QueryBuilder) (AuditLogs, error)
+
+	InsertRefreshToken(refreshToken RefreshToken) (int64, error)
+	GetRefreshTokens(qb *QueryBuilder) (RefreshTokens, error)
+	/**
+		Revoke current and insert next in its place. ErrRefreshTokenReused
+		when current was already revoked, nothing is written then
+	*/
+	RotateRefreshToken(current RefreshToken, next RefreshToken) error
+	RevokeRefreshTokenFamily(familyId string, revokedAt int64) error
+	RevokeUserRefreshTokens(userId string, revokedAt int64) error
+
+	// Write the key and a row in api_key_topics for every TopicIds
+	InsertApiKey(apiKey ApiKey) (int64, error)
+	GetApiKeys(qb *QueryBuilder) (ApiKeys, error)
+	UpdateApiKey(apiKey ApiKey, updateables []string) error
+	GetApiKeyTopics(qb *QueryBuilder) (ApiKeyTopics, error)
+}
+
+type SQLStore struct {
+	DB ITransactionSQL
+}
+
+func NewSQLStore(db ITransactionSQL) *SQLStore {
+	return &SQLStore{DB: db}
+}
+
+func (ss *SQLStore) InsertUser(user UserProfile) error {
+	_, err := user.Insert(ss.DB)
+	return err
+}
+
+func (ss *SQLStore) FindUser(qb *QueryBuilder) (UserProfile, error) {
+	user := UserProfile{}
+	err := user.Find(ss.DB, qb)
+	return user, err
+}
+
+func (ss *SQLStore) UpdateUser(user UserProfile, updateables []string) error {
+	_, err := user.Update(ss.DB, updateables)
+	return err
+}
+
+/**
+	Owned topics are purged with everything under them, then the
+	subscriptions and notifications of the user elsewhere. Tables with
+	ON DELETE CASCADE on user_id are left to the database
+*/
+func (ss *SQLStore) DeleteUser(user UserProfile) error {
+	return CreateSQLTransaction(ss.DB, func(tx *sql.Tx) error {
+		topics := Topics{}
+		qb := NewQueryBuilder().Select("id").Where("user_id", "=", user.Id)
+		if err := topics.Get(tx, qb); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		for _, topic := range topics {
+			if _, err := topic.Purge(tx); err != nil {
+				return err
+			}
+		}
+		subscribers := Subscribers{}
+		qb = NewQueryBuilder().Select("id").Where("user_id", "=", user.Id)
+		if err := subscribers.Get(tx, qb); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		for _, subscriber := range subscribers {
+			if _, err := subscriber.DeleteDeliveries(tx); err != nil {
+				return err
+			}
+			if _, err := subscriber.Delete(tx); err != nil {
+				return err
+			}
+		}
+		userNotifications := UserNotifications{UserId: user.Id}
+		if _, err := userNotifications.DeleteDeliveries(tx); err != nil {
+			return err
+		}
+		if _, err := userNotifications.Delete(tx); err != nil {
+			return err
+		}
+		_, err := user.Delete(tx)
+		return err
+	})
+}
+
+func (ss *SQLStore) InsertTopic(topic Topic) (int64, error) {
+	var topicId int64
+	err := CreateSQLTransaction(ss.DB, func(tx *sql.Tx) error {
+		lastInsertId, err := topic.Insert(tx)
+		if err != nil {
+			return err
+		}
+		topicId = lastInsertId
+		owner := TopicMember{
+			TopicId: int(topicId),
+			UserId: topic.UserId,
+			Role: TOPIC_ROLE_OWNER,
+			InvitedBy: topic.UserId,
+			CreatedAt: time.Now().Unix(),
+		}
+		if _, err := owner.Insert(tx); err != nil {
+			return err
+		}
+		_, err = NewTopicTags(topic.Tags).Replace(tx, int(topicId))
+		return err
+	})
+	return topicId, err
+}
+
+func (ss *SQLStore) GetTopics(qb *QueryBuilder) (Topics, error) {
+	topics := Topics{}
+	err := topics.Get(ss.DB, qb)
+	return topics, err
+}
+
+func (ss *SQLStore) UpdateTopic(topic Topic, updateables []string) error {
+	return CreateSQLTransaction(ss.DB, func(tx *sql.Tx) error {
+		if len(topic.UpdateColumns(updateables)) != 0 {
+			if _, err := topic.Update(tx, updateables); err != nil {
+				return err
+			}
+		}
+		for _, column := range updateables {
+			if column == "tags" {
+				_, err := NewTopicTags(topic.Tags).Replace(tx, topic.Id)
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (ss *SQLStore) DeleteTopic(topic Topic) error {
+	return CreateSQLTransaction(ss.DB, func(tx *sql.Tx) error {
+		subscribers := Subscribers{}
+		qb := NewQueryBuilder().Select("id").Where("topic_id", "=", topic.Id)
+		if err := subscribers.Get(tx, qb); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		for _, subscriber := range subscribers {
+			if _, err := subscriber.DeleteDeliveries(tx); err != nil {
+				return err
+			}
+			if _, err := subscriber.Delete(tx); err != nil {
+				return err
+			}
+		}
+		_, err := topic.Delete(tx)
+		return err
+	})
+}
+
+func (ss *SQLStore) CountSubscribers(topicId int) (int, error) {
+	return Topic{Id: topicId}.CountSubscribers(ss.DB)
+}
+
+func (ss *SQLStore) GetTopicTags(qb *QueryBuilder) (TopicTags, error) {
+	topicTags := TopicTags{}
+	err := topicTags.Get(ss.DB, qb)
+	return topicTags, err
+}
+
+func (ss *SQLStore) SearchTopics(qb *QueryBuilder) (TopicStats, error) {
+	topicStats := TopicStats{}
+	err := topicStats.Get(ss.DB, qb)
+	return topicStats, err
+}
+
+func (ss *SQLStore) InsertSubscriber(subscriber Subscriber) (int64, error) {
+	return subscriber.Insert(ss.DB)
+}
+
+func (ss *SQLStore) GetSubscribers(qb *QueryBuilder) (Subscribers, error) {
+	subscribers := Subscribers{}
+	err := subscribers.Get(ss.DB, qb)
+	return subscribers, err
+}
+
+func (ss *SQLStore) DeleteSubscriber(subscriber Subscriber) error {
+	return CreateSQLTransaction(ss.DB, func(tx *sql.Tx) error {
+		if _, err := subscriber.DeleteDeliveries(tx); err != nil {
+			return err
+		}
+		_, err := subscriber.Delete(tx)
+		return err
+	})
+}
+
+func (ss *SQLStore) InsertNotifications(notifications Notifications, jobFor func(notification Notification) (*DeliveryJob, error)) error {
+	return CreateSQLTransaction(ss.DB, func(tx *sql.Tx) error {
+		for i := 0; i < len(notifications); i++ {
+			lastInsertId, err := notifications[i].Insert(tx)
+			if err != nil {
+				return err
+			}
+			notifications[i].Id = int(lastInsertId)
+			job, err := jobFor(notifications[i])
+			if err != nil {
+				return err
+			}
+			if job == nil {
+				continue
+			}
+			if _, err := job.Insert(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (ss *SQLStore) GetNotifications(qb *QueryBuilder) (Notifications, error) {
+	notifications := Notifications{}
+	err := notifications.Get(ss.DB, qb)
+	return notifications, err
+}
+
+func (ss *SQLStore) UpdateReadNotification(notifications Notifications) (int64, error) {
+	return notifications.UpdateReadNotification(ss.DB)
+}
+
+func (ss *SQLStore) DeleteNotifications(notifications Notifications) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	return CreateSQLTransaction(ss.DB, func(tx *sql.Tx) error {
+		if _, err := notifications.DeleteDeliveries(tx); err != nil {
+			return err
+		}
+		_, err := notifications.Delete(tx)
+		return err
+	})
+}
+
+func (ss *SQLStore) UpdateReadUserNotifications(userNotifications UserNotifications) (int64, error) {
+	return userNotifications.UpdateReadNotification(ss.DB)
+}
+
+func (ss *SQLStore) DeleteUserNotifications(userNotifications UserNotifications) (int64, error) {
+	var deleted int64
+	err := CreateSQLTransaction(ss.DB, func(tx *sql.Tx) error {
+		if _, err := userNotifications.DeleteDeliveries(tx); err != nil {
+			return err
+		}
+		var err error
+		deleted, err = userNotifications.Delete(tx)
+		return err
+	})
+	return deleted, err
+}
+
+func (ss *SQLStore) CountUnreadNotifications(userId string) (UnreadCounts, error) {
+	unreadCounts := UnreadCounts{}
+	err := unreadCounts.Get(ss.DB, userId)
+	return unreadCounts, err
+}
+
+func (ss *SQLStore) InsertTopicMember(topicMember TopicMember) (int64, error) {
+	return topicMember.Insert(ss.DB)
+}
+
+func (ss *SQLStore) GetTopicMembers(qb *QueryBuilder) (TopicMembers, error) {
+	topicMembers := TopicMembers{}
+	err := topicMembers.Get(ss.DB, qb)
+	return topicMembers, err
+}
+
+func (ss *SQLStore) UpdateTopicMemberRole(topicMember TopicMember) error {
+	_, err := topicMember.UpdateRole(ss.DB)
+	return err
+}
+
+func (ss *SQLStore) DeleteTopicMember(topicMember TopicMember) error {
+	_, err := topicMember.Delete(ss.DB)
+	return err
+}
+
+func (ss *SQLStore) TransferTopicOwnership(topicId int, from string, to string) error {
+	return CreateSQLTransaction(ss.DB, func(tx *sql.Tx) error {
+		if _, err := (Topic{Id: topicId, UserId: to}).Transfer(tx); err != nil {
+			return err
+		}
+		if _, err := (TopicMember{TopicId: topicId, UserId: to, Role: TOPIC_ROLE_OWNER}).UpdateRole(tx); err != nil {
+			return err
+		}
+		_, err := (TopicMember{TopicId: topicId, UserId: from, Role: TOPIC_ROLE_ADMIN}).UpdateRole(tx)
+		return err
+	})
+}
+
+func (ss *SQLStore) InsertSubscriptionRequest(subscriptionRequest SubscriptionRequest) (int64, error) {
+	return subscriptionRequest.Insert(ss.DB)
+}
+
+func (ss *SQLStore) GetSubscriptionRequests(qb *QueryBuilder) (SubscriptionRequests, error) {
+	subscriptionRequests := SubscriptionRequests{}
+	err := subscriptionRequests.Get(ss.DB, qb)
+	return subscriptionRequests, err
+}
+
+func (ss *SQLStore) DecideSubscriptionRequest(subscriptionRequest SubscriptionRequest, subscriber Subscriber) error {
+	return CreateSQLTransaction(ss.DB, func(tx *sql.Tx) error {
+		decided, err := subscriptionRequest.Decide(tx)
+		if err != nil {
+			return err
+		}
+		// another admin decided it after the caller read it
+		if decided == 0 {
+			return ErrAlreadyDecided
+		}
+		if subscriptionRequest.Status != SUBSCRIPTION_REQUEST_APPROVED {
+			return nil
+		}
+		if _, err := subscriber.Insert(tx); err != nil {
+			return err
+		}
+		qb := NewQueryBuilder().
+			Select("id").
+			Where("topic_id", "=", subscriptionRequest.TopicId).
+			Where("user_id", "=", subscriptionRequest.UserId)
+		err = (&TopicMembers{}).Get(tx, qb)
+		if err != sql.ErrNoRows {
+			return err
+		}
+		member := TopicMember{
+			TopicId: subscriptionRequest.TopicId,
+			UserId: subscriptionRequest.UserId,
+			Role: TOPIC_ROLE_SUBSCRIBER,
+			InvitedBy: subscriptionRequest.DecidedBy,
+			CreatedAt: subscriptionRequest.DecidedAt,
+		}
+		_, err = member.Insert(tx)
+		return err
+	})
+}
+
+func (ss *SQLStore) InsertAuditLog(auditLog AuditLog) (int64, error) {
+	return auditLog.Insert(ss.DB)
+}
+
+func (ss *SQLStore) GetAuditLogs(qb *QueryBuilder) (AuditLogs, error) {
+	auditLogs := AuditLogs{}
+	err := auditLogs.Get(ss.DB, qb)
+	return auditLogs, err
+}
+
+func (ss *SQLStore) InsertRefreshToken(refreshToken RefreshToken) (int64, error) {
+	return refreshToken.Insert(ss.DB)
+}
+
+func (ss *SQLStore) GetRefreshTokens(qb *QueryBuilder) (RefreshTokens, error) {
+	refreshTokens := RefreshTokens{}
+	err := refreshTokens.Get(ss.DB, qb)
+	return refreshTokens, err
+}
+
+func (ss *SQLStore) RotateRefreshToken(current RefreshToken, next RefreshToken) error {
+	return CreateSQLTransaction(ss.DB, func(tx *sql.Tx) error {
+		current.RevokedAt = next.CreatedAt
+		current.ReplacedBy = next.TokenHash
+		if _, err := current.Rotate(tx); err != nil {
+			return err
+		}
+		rotated := RefreshTokens{}
+		qb := NewQueryBuilder().Select("replaced_by").Where("id", "=", current.Id)
+		if err := rotated.Get(tx, qb); err != nil {
+			return err
+		}
+		if rotated[0].ReplacedBy != next.TokenHash {
+			return ErrRefreshTokenReused
+		}
+		_, err := next.Insert(tx)
+		return err
+	})
+}
+
+func (ss *SQLStore) RevokeRefreshTokenFamily(familyId string, revokedAt int64) error {
+	_, err := RefreshToken{FamilyId: familyId, RevokedAt: revokedAt}.RevokeFamily(ss.DB)
+	return err
+}
+
+func (ss *SQLStore) RevokeUserRefreshTokens(userId string, revokedAt int64) error {
+	_, err := RefreshToken{UserId: userId, RevokedAt: revokedAt}.RevokeUser(ss.DB)
+	return err
+}
+
+func (ss *SQLStore) InsertApiKey(apiKey ApiKey) (int64, error) {
+	var apiKeyId int64
+	err := CreateSQLTransaction(ss.DB, func(tx *sql.Tx) error {
+		lastInsertId, err := apiKey.Insert(tx)
+		if err != nil {
+			return err
+		}
+		for _, topicId := range apiKey.TopicIds {
+			apiKeyTopic := ApiKeyTopic{ApiKeyId: int(lastInsertId), TopicId: topicId}
+			if _, err := apiKeyTopic.Insert(tx); err != nil {
+				return err
+			}
+		}
+		apiKeyId = lastInsertId
+		return nil
+	})
+	return apiKeyId, err
+}
+
+func (ss *SQLStore) GetApiKeys(qb *QueryBuilder) (ApiKeys, error) {
+	apiKeys := ApiKeys{}
+	err := apiKeys.Get(ss.DB, qb)
+	return apiKeys, err
+}
+
+func (ss *SQLStore) UpdateApiKey(apiKey ApiKey, updateables []string) error {
+	_, err := apiKey.Update(ss.DB, updateables)
+	return err
+}
+
+func (ss *SQLStore) GetApiKeyTopics(qb *QueryBuilder) (ApiKeyTopics, error) {
+	apiKeyTopics := ApiKeyTopics{}
+	err := apiKeyTopics.Get(ss.DB, qb)
+	return apiKeyTopics, err
+}
@@ -1,6 +1,9 @@
 package main
 
-import "os"
+import (
+	"os"
+	"strings"
+)
 
 type Environement string
 
@@ -10,3 +13,46 @@ func (env Environement) getCurrentEnv() string {
 func (env Environement) IsTest() bool {
 	return env.getCurrentEnv() == "test"
 }
+
+// mysql when not set, other option is postgres and sqlite
+func (env Environement) DatabaseDialect() string {
+	return os.Getenv("DATABASE_DIALECT")
+}
+
+/**
+	JWT is signed with the shared HS256 secret unless a key is set,
+	either inline PEM in JWT_SIGNING_KEY or a path in JWT_SIGNING_KEY_FILE.
+	JWT_SIGNING_KEY_ID become the kid header
+*/
+func (env Environement) JWTSigningKeyId() string {
+	return os.Getenv("JWT_SIGNING_KEY_ID")
+}
+
+func (env Environement) JWTSigningKey() string {
+	return os.Getenv("JWT_SIGNING_KEY")
+}
+
+func (env Environement) JWTSigningKeyFile() string {
+	return os.Getenv("JWT_SIGNING_KEY_FILE")
+}
+
+/**
+	Token signed with the HS256 secret is still accepted after switching
+	to a signing key until this is "true", set it once they all expire
+*/
+func (env Environement) JWTRetireSecret() bool {
+	return os.Getenv("JWT_RETIRE_SECRET") == "true"
+}
+
+// Previous keys still accepted during rotation, e.g "2021-01=old.pem,2021-02=older.pem"
+func (env Environement) JWTVerifyKeyFiles() map[string]string {
+	files := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv("JWT_VERIFY_KEY_FILES"), ",") {
+		kidPath := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kidPath) != 2 {
+			continue
+		}
+		files[kidPath[0]] = kidPath[1]
+	}
+	return files
+}
@@ -4,6 +4,16 @@ go 1.15
 
 require (
 	github.com/gorilla/mux v1.8.0
+	github.com/humamfauzi/go-notification/auth v0.0.0-20210220090529-375e01726b51
 	github.com/humamfauzi/go-notification/database v0.0.0-20210307035209-99afa394fe46
 	github.com/humamfauzi/go-notification/handler v0.0.0-20210307035209-99afa394fe46
 )
+
+replace (
+	github.com/humamfauzi/go-notification/auth => ./auth
+	github.com/humamfauzi/go-notification/broker => ./broker
+	github.com/humamfauzi/go-notification/database => ./database
+	github.com/humamfauzi/go-notification/handler => ./handler
+	github.com/humamfauzi/go-notification/queue => ./queue
+	github.com/humamfauzi/go-notification/webhook => ./webhook
+)
@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/humamfauzi/go-notification/auth"
+	dba "github.com/humamfauzi/go-notification/database"
+)
+
+var (
+	errInvalidApiKey = errors.New("Invalid Api Key")
+)
+
+func apiKeyTarget(apiKeyId int) string {
+	return "api_key/" + strconv.Itoa(apiKeyId)
+}
+
+// Api key is put in the request context by ApiKeyMiddleware
+func getRequesterApiKey(r *http.Request) (dba.ApiKey, bool) {
+	apiKey, ok := r.Context().Value(apiKeyKey).(dba.ApiKey)
+	return apiKey, ok
+}
+
+func apiKeyHasTopic(apiKey dba.ApiKey, topicId int) bool {
+	for _, id := range apiKey.TopicIds {
+		if id == topicId {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+	Find the key by its prefix and compare the hash of the whole key.
+	A revoked key is the same as an unknown key. Last used is updated
+	on every success
+*/
+func (s *Server) authenticateApiKey(key string) (dba.ApiKey, error) {
+	prefix := auth.ApiKeyPrefix(key)
+	if len(prefix) == 0 {
+		return dba.ApiKey{}, errInvalidApiKey
+	}
+	apiKeys, err := s.Store.GetApiKeys(dba.NewQueryBuilder().Where("prefix", "=", prefix).Limit(1))
+	if err != nil {
+		return dba.ApiKey{}, errInvalidApiKey
+	}
+	apiKey := apiKeys[0]
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(auth.HashToken(key))) != 1 {
+		return dba.ApiKey{}, errInvalidApiKey
+	}
+	if apiKey.RevokedAt != 0 {
+		return dba.ApiKey{}, errInvalidApiKey
+	}
+	apiKeyTopics, err := s.Store.GetApiKeyTopics(dba.NewQueryBuilder().Where("api_key_id", "=", apiKey.Id))
+	if err != nil && err != sql.ErrNoRows {
+		return dba.ApiKey{}, err
+	}
+	for _, apiKeyTopic := range apiKeyTopics {
+		apiKey.TopicIds = append(apiKey.TopicIds, apiKeyTopic.TopicId)
+	}
+	apiKey.LastUsedAt = time.Now().Unix()
+	if err := s.Store.UpdateApiKey(apiKey, []string{"last_used_at"}); err != nil {
+		s.Logger.Println("API KEY LAST USED NOT RECORDED", apiKey.Prefix, err)
+	}
+	return apiKey, nil
+}
+
+/**
+	Request with "Authorization: ApiKey <key>" go to next with the key
+	in the context, anything else go to otherwise, usually RoleMiddleware
+*/
+func (s *Server) ApiKeyMiddleware(next http.Handler, otherwise http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := auth.ParseApiKey(r.Header.Get("Authorization"))
+		if len(key) == 0 {
+			otherwise.ServeHTTP(w, r)
+			return
+		}
+		apiKey, err := s.authenticateApiKey(key)
+		if err != nil {
+			WriteReply(int(http.StatusUnauthorized), false, "Invalid Api Key", w)
+			return
+		}
+		ctx := context.WithValue(r.Context(), apiKeyKey, apiKey)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+/**
+	Requester can only scope the key to topics it can publish to. The
+	key is only shown once in the reply
+*/
+func (s *Server) CreateApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	requester, err := getRequesterProfile(r)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Read Payload", w)
+		return
+	}
+	apiKey := dba.ApiKey{}
+	if err := json.Unmarshal(body, &apiKey); err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Parse Payload", w)
+		return
+	}
+	if len(apiKey.TopicIds) == 0 {
+		WriteReply(int(http.StatusBadRequest), false, "Topic is Needed", w)
+		return
+	}
+	createNotification := CreateNotification{s}
+	for _, topicId := range apiKey.TopicIds {
+		if !createNotification.CanPublish(requester.Id, topicId) {
+			s.audit(requester.Id, dba.AUDIT_PUBLISH_DENIED, topicTarget(topicId), "api_key")
+			WriteReply(int(http.StatusForbidden), false, "Not Allowed to Publish", w)
+			return
+		}
+	}
+	prefix, key, err := auth.GenerateApiKey()
+	if err != nil {
+		WriteReply(int(http.StatusInternalServerError), false, "Cannot Generate Api Key", w)
+		return
+	}
+	apiKey.UserId = requester.Id
+	apiKey.Prefix = prefix
+	apiKey.KeyHash = auth.HashToken(key)
+	apiKey.LastUsedAt = 0
+	apiKey.RevokedAt = 0
+	apiKey.CreatedAt = time.Now().Unix()
+	apiKeyId, err := s.Store.InsertApiKey(apiKey)
+	if err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	s.audit(requester.Id, dba.AUDIT_API_KEY_CREATED, apiKeyTarget(int(apiKeyId)), prefix)
+	reply := struct {
+		Id int64 `json:"id"`
+		Prefix string `json:"prefix"`
+		Key string `json:"key"`
+	}{ apiKeyId, prefix, key }
+	WriteReply(int(http.StatusOK), true, reply, w)
+	return
+}
+
+// Every key of the requester together with its topics, revoked key included
+func (s *Server) GetApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	requester, err := getRequesterProfile(r)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
+	}
+	qb := dba.NewQueryBuilder().
+		Select("id", "user_id", "name", "prefix", "last_used_at", "revoked_at", "created_at").
+		Where("user_id", "=", requester.Id).
+		OrderBy("id", dba.ORDER_ASC)
+	apiKeys, err := s.Store.GetApiKeys(qb)
+	if err == sql.ErrNoRows {
+		WriteReply(int(http.StatusOK), true, dba.ApiKeys{}, w)
+		return
+	}
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	apiKeyIds := []interface{}{}
+	for _, apiKey := range apiKeys {
+		apiKeyIds = append(apiKeyIds, apiKey.Id)
+	}
+	apiKeyTopics, err := s.Store.GetApiKeyTopics(dba.NewQueryBuilder().In("api_key_id", apiKeyIds...))
+	if err != nil && err != sql.ErrNoRows {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	for i := range apiKeys {
+		apiKeys[i].TopicIds = []int{}
+		for _, apiKeyTopic := range apiKeyTopics {
+			if apiKeyTopic.ApiKeyId == apiKeys[i].Id {
+				apiKeys[i].TopicIds = append(apiKeys[i].TopicIds, apiKeyTopic.TopicId)
+			}
+		}
+	}
+	WriteReply(int(http.StatusOK), true, apiKeys, w)
+	return
+}
+
+// Only the owner of the key or an admin can revoke it
+func (s *Server) RevokeApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	requester, err := getRequesterProfile(r)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
+	}
+	apiKeyId, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Invalid Api Key Id", w)
+		return
+	}
+	qb := dba.NewQueryBuilder().
+		Select("id", "user_id", "prefix", "revoked_at").
+		Where("id", "=", apiKeyId)
+	apiKeys, err := s.Store.GetApiKeys(qb)
+	if err != nil {
+		WriteReply(int(http.StatusNotFound), false, "Api Key Not Found", w)
+		return
+	}
+	apiKey := apiKeys[0]
+	if apiKey.UserId != requester.Id && requester.Role != dba.USER_ROLE_ADMIN {
+		WriteReply(int(http.StatusForbidden), false, "Not Api Key Owner", w)
+		return
+	}
+	if apiKey.RevokedAt == 0 {
+		apiKey.RevokedAt = time.Now().Unix()
+		if err := s.Store.UpdateApiKey(apiKey, []string{"revoked_at"}); err != nil {
+			WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+			return
+		}
+		s.audit(requester.Id, dba.AUDIT_API_KEY_REVOKED, apiKeyTarget(apiKey.Id), apiKey.Prefix)
+	}
+	WriteReply(int(http.StatusOK), true, nil, w)
+	return
+}
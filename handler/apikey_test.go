@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"fmt"
+	"testing"
+	"strings"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/humamfauzi/go-notification/utils"
+)
+
+func serveApiKey(server *Server, method, path, body, key string) HandlerReply {
+	req := httptest.NewRequest(method, baseUrl + path, strings.NewReader(body))
+	req.Header["Authorization"] = []string{"ApiKey " + key}
+	w := httptest.NewRecorder()
+	server.Routes().ServeHTTP(w, req)
+	return extractReply(w)
+}
+
+func TestApiKeyPublish(t *testing.T) {
+	randName := utils.RandomStringId("", 10)
+	owner, ownerToken := createUserOn(t, testServer, fmt.Sprintf("apiowner%v@asd.asd", randName), "rahasia")
+	_, strangerToken := createUserOn(t, testServer, fmt.Sprintf("apistranger%v@asd.asd", randName), "rahasia")
+	topicId := createTopicOn(t, testServer, owner, ownerToken)
+	subscribe := fmt.Sprintf(`{"topic_id": %d}`, topicId)
+	if reply := serveRoute(testServer, http.MethodPost, "/subscribe", subscribe, strangerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+
+	request := fmt.Sprintf(`{"name": "billing", "topic_ids": [%d]}`, topicId)
+	if reply := serveRoute(testServer, http.MethodPost, "/apikeys", request, strangerToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("want %v get %v", http.StatusForbidden, reply)
+	}
+	reply := serveRoute(testServer, http.MethodPost, "/apikeys", request, ownerToken)
+	if reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	created := reply.Message.(map[string]interface{})
+	key := created["key"].(string)
+	revoke := fmt.Sprintf("/apikeys/%v", created["id"])
+
+	notification := fmt.Sprintf(`{"topic_id": %d, "message": "from service"}`, topicId)
+	if reply := serveApiKey(testServer, http.MethodPost, "/notification", notification, key); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	outOfScope := fmt.Sprintf(`{"topic_id": %d, "message": "from service"}`, topicId + 1000)
+	if reply := serveApiKey(testServer, http.MethodPost, "/notification", outOfScope, key); reply.Code != http.StatusForbidden {
+		t.Fatalf("want %v get %v", http.StatusForbidden, reply)
+	}
+	if reply := serveApiKey(testServer, http.MethodPost, "/notification", notification, key + "x"); reply.Code != http.StatusUnauthorized {
+		t.Fatalf("want %v get %v", http.StatusUnauthorized, reply)
+	}
+	// api key is only accepted on the publish route
+	if reply := serveApiKey(testServer, http.MethodGet, "/notification", "", key); reply.Code != http.StatusUnauthorized {
+		t.Fatalf("want %v get %v", http.StatusUnauthorized, reply)
+	}
+
+	reply = serveRoute(testServer, http.MethodGet, "/apikeys", "", ownerToken)
+	if reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	listed := reply.Message.([]interface{})[0].(map[string]interface{})
+	if listed["prefix"] != created["prefix"] || listed["last_used_at"].(float64) == 0 || len(listed["topic_ids"].([]interface{})) != 1 {
+		t.Fatalf("want used key with one topic get %v", listed)
+	}
+	if _, ok := listed["key"]; ok {
+		t.Fatalf("key should only be shown once get %v", listed)
+	}
+
+	if reply := serveRoute(testServer, http.MethodDelete, revoke, "", strangerToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("want %v get %v", http.StatusForbidden, reply)
+	}
+	if reply := serveRoute(testServer, http.MethodDelete, revoke, "", ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if reply := serveApiKey(testServer, http.MethodPost, "/notification", notification, key); reply.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked key should be rejected get %v", reply)
+	}
+}
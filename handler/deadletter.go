@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	DEFAULT_DEAD_LETTER_LIMIT = 50
+	MAX_DEAD_LETTER_LIMIT = 500
+)
+
+func queryInt(r *http.Request, name string, defaultValue, maxValue int) int {
+	value, err := strconv.Atoi(r.URL.Query().Get(name))
+	// zero limit would mean no limit at all
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	if maxValue > 0 && value > maxValue {
+		return maxValue
+	}
+	return value
+}
+
+func (s *Server) GetDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	if s.deliveryQueue == nil {
+		WriteReply(int(http.StatusServiceUnavailable), false, "Delivery Queue Not Started", w)
+		return
+	}
+	limit := queryInt(r, "limit", s.Config.DeadLetterLimit, s.Config.MaxDeadLetterLimit)
+	offset := queryInt(r, "offset", 0, 0)
+	deadLetters, err := s.deliveryQueue.DeadLetters(limit, offset)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	WriteReply(int(http.StatusOK), true, deadLetters, w)
+	return
+}
+
+func (s *Server) RequeueDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	if s.deliveryQueue == nil {
+		WriteReply(int(http.StatusServiceUnavailable), false, "Delivery Queue Not Started", w)
+		return
+	}
+	vars := mux.Vars(r)
+	deadLetterId, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Invalid Dead Letter Id", w)
+		return
+	}
+	err = s.deliveryQueue.Requeue(deadLetterId)
+	if err == sql.ErrNoRows {
+		WriteReply(int(http.StatusNotFound), false, "Dead Letter Not Found", w)
+		return
+	}
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	WriteReply(int(http.StatusOK), true, nil, w)
+	return
+}
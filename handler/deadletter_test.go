@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+)
+
+func TestQueryInt(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, baseUrl + "/deadletters?limit=20&offset=-1&big=9000&zero=0", nil)
+	if result := queryInt(req, "limit", 50, 500); result != 20 {
+		t.Fatalf("want 20 get %v", result)
+	}
+	if result := queryInt(req, "offset", 0, 0); result != 0 {
+		t.Fatalf("want 0 get %v", result)
+	}
+	if result := queryInt(req, "big", 50, 500); result != 500 {
+		t.Fatalf("want 500 get %v", result)
+	}
+	if result := queryInt(req, "missing", 50, 500); result != 50 {
+		t.Fatalf("want 50 get %v", result)
+	}
+	if result := queryInt(req, "zero", 50, 500); result != 50 {
+		t.Fatalf("want 50 get %v", result)
+	}
+}
+
+func TestDeadLetterHandlerWithoutQueue(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, baseUrl + "/deadletters", nil)
+	w := httptest.NewRecorder()
+	testServer.GetDeadLetterHandler(w, req)
+	reply := extractReply(w)
+	if reply.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want %v get %v", http.StatusServiceUnavailable, reply.Code)
+	}
+}
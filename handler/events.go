@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/humamfauzi/go-notification/broker"
+	dba "github.com/humamfauzi/go-notification/database"
+)
+
+const (
+	eventKeepAlivePeriod = 30 * time.Second
+	eventRetryMillisecond = 3000
+	// Missed notification is read this many at a time until caught up
+	eventReplayPage = 100
+)
+
+/**
+	Last-Event-ID is sent by EventSource automatically on reconnect.
+	The query parameter is there for client that open the stream manually.
+	Without either one, or with one that is not a number, the stream
+	start from live notification and nothing is replayed
+*/
+func lastEventId(r *http.Request) (int, bool) {
+	lastId := r.Header.Get("Last-Event-ID")
+	if len(lastId) == 0 {
+		lastId = r.URL.Query().Get("last_event_id")
+	}
+	id, err := strconv.Atoi(lastId)
+	if err != nil || id < 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// One page of missed notification after lastId, oldest first
+func (s *Server) missedNotifications(userId string, lastId int) (dba.Notifications, error) {
+	qb := dba.NewQueryBuilder().
+		Where("user_id", "=", userId).
+		Where("id", ">", lastId).
+		OrderBy("id", dba.ORDER_ASC).
+		Limit(eventReplayPage)
+	notifications, err := s.Store.GetNotifications(qb)
+	if err == sql.ErrNoRows {
+		return dba.Notifications{}, nil
+	}
+	return notifications, err
+}
+
+func writeEvent(w io.Writer, notification dba.Notification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: notification\ndata: %s\n\n", notification.Id, data)
+	return err
+}
+
+/**
+	Stream notification as text/event-stream. Subscription is made before
+	reading the missed notification so nothing written in between is lost,
+	live notification already sent from the backlog is skipped. The backlog
+	is replayed page by page until a short page. A slow client is
+	disconnected since it can resume with Last-Event-ID
+*/
+func (s *Server) NotificationEventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		WriteReply(int(http.StatusInternalServerError), false, "Streaming Unsupported", w)
+		return
+	}
+	userProfile, err := getRequesterProfile(r)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
+	}
+	subscription := s.broker.Subscribe(userTopic(userProfile.Id), s.Config.StreamBufferSize, broker.Disconnect)
+	defer s.broker.Unsubscribe(subscription)
+
+	missed := dba.Notifications{}
+	lastId, replay := lastEventId(r)
+	if replay {
+		missed, err = s.missedNotifications(userProfile.Id, lastId)
+		if err != nil {
+			s.Logger.Println("EVENTS BACKLOG FAILED", userProfile.Id, err)
+			WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetryMillisecond)
+	sent := make(map[int]struct{}, len(missed))
+	for replay {
+		for _, notification := range missed {
+			if err := writeEvent(w, notification); err != nil {
+				return
+			}
+			sent[notification.Id] = struct{}{}
+		}
+		flusher.Flush()
+		if len(missed) < eventReplayPage {
+			break
+		}
+		missed, err = s.missedNotifications(userProfile.Id, missed[len(missed)-1].Id)
+		if err != nil {
+			// client resume from the last written id on reconnect
+			s.Logger.Println("EVENTS BACKLOG FAILED", userProfile.Id, err)
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(eventKeepAlivePeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case message, ok := <-subscription.Messages():
+			if !ok {
+				return
+			}
+			notification := message.Payload.(dba.Notification)
+			if _, ok := sent[notification.Id]; ok {
+				continue
+			}
+			if err := writeEvent(w, notification); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"testing"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"net/http"
+	"net/http/httptest"
+
+	dba "github.com/humamfauzi/go-notification/database"
+	"github.com/humamfauzi/go-notification/utils"
+)
+
+func TestLastEventId(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, baseUrl + "/notification/events", nil)
+	if result, ok := lastEventId(req); ok {
+		t.Fatalf("want none get %v", result)
+	}
+	req = httptest.NewRequest(http.MethodGet, baseUrl + "/notification/events?last_event_id=12", nil)
+	if result, ok := lastEventId(req); !ok || result != 12 {
+		t.Fatalf("want 12 get %v", result)
+	}
+	req.Header["Last-Event-Id"] = []string{"42"}
+	if result, ok := lastEventId(req); !ok || result != 42 {
+		t.Fatalf("want 42 get %v", result)
+	}
+	req.Header["Last-Event-Id"] = []string{"not a number"}
+	if result, ok := lastEventId(req); ok {
+		t.Fatalf("want none get %v", result)
+	}
+}
+
+// Handler return once the context is done, what is written until then is replayed backlog
+func streamEvents(server *Server, path, token string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, baseUrl + path, nil).WithContext(ctx)
+	req.Header["Authentication"] = []string{"Bearer " + token}
+	w := httptest.NewRecorder()
+	server.Routes().ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestNotificationEventsReplay(t *testing.T) {
+	randName := utils.RandomStringId("", 10)
+	user, token := createUserOn(t, testServer, fmt.Sprintf("events%v@asd.asd", randName), "rahasia")
+	topicId := createTopicOn(t, testServer, user, token)
+	// more than one page so the replay has to continue until caught up
+	notifications := make(dba.Notifications, 2*eventReplayPage+5)
+	for i := range notifications {
+		notifications[i] = dba.Notification{UserId: user.Id, TopicId: topicId, Message: "missed"}
+	}
+	noJob := func(notification dba.Notification) (*dba.DeliveryJob, error) {
+		return nil, nil
+	}
+	if err := testServer.Store.InsertNotifications(notifications, noJob); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+
+	// fresh connection start live
+	if body := streamEvents(testServer, "/notification/events", token); strings.Contains(body, "event: notification") {
+		t.Fatalf("want no replay get %q", body)
+	}
+
+	body := streamEvents(testServer, "/notification/events?last_event_id=0", token)
+	if count := strings.Count(body, "event: notification"); count != len(notifications) {
+		t.Fatalf("want %v get %v", len(notifications), count)
+	}
+	// nothing is dropped and the oldest is written first
+	written := -1
+	for _, notification := range notifications {
+		index := strings.Index(body, fmt.Sprintf("id: %d\n", notification.Id))
+		if index <= written {
+			t.Fatalf("want %v after the previous event get %v", notification.Id, index)
+		}
+		written = index
+	}
+
+	lastId := fmt.Sprintf("/notification/events?last_event_id=%d", notifications[len(notifications)-3].Id)
+	if count := strings.Count(streamEvents(testServer, lastId, token), "event: notification"); count != 2 {
+		t.Fatalf("want 2 get %v", count)
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	notification := dba.Notification{
+		Id: 7,
+		UserId: "user/1",
+		TopicId: 2,
+		Message: "hello",
+		CreatedAt: 1700000000,
+	}
+	if err := writeEvent(buffer, notification); err != nil {
+		t.Fatalf("should write event %v", err)
+	}
+	want := "id: 7\nevent: notification\ndata: {\"id\":7,\"user_id\":\"user/1\",\"topic_id\":2,\"message\":\"hello\",\"is_read\":false,\"created_at\":1700000000}\n\n"
+	if buffer.String() != want {
+		t.Fatalf("\nwant %q\nget  %q", want, buffer.String())
+	}
+}
+
+func TestNotificationEventsHandlerWithoutToken(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, baseUrl + "/notification/events", nil)
+	w := httptest.NewRecorder()
+	testServer.Routes().ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("want %v get %v", http.StatusUnauthorized, w.Code)
+	}
+}
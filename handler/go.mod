@@ -4,8 +4,19 @@ go 1.15
 
 require (
 	github.com/gorilla/mux v1.8.0
-	github.com/humamfauzi/go-notification v0.0.7-0.20210228094707-01e202ee10b8 // indirect
+	github.com/gorilla/websocket v1.4.2
 	github.com/humamfauzi/go-notification/auth v0.0.0-20210220090529-375e01726b51
+	github.com/humamfauzi/go-notification/broker v0.0.0-00010101000000-000000000000
 	github.com/humamfauzi/go-notification/database v0.0.0-20210307032418-2ca3d3971ebc
+	github.com/humamfauzi/go-notification/queue v0.0.0-00010101000000-000000000000
 	github.com/humamfauzi/go-notification/utils v0.0.0-20210213132805-d214952f3fa7
+	github.com/humamfauzi/go-notification/webhook v0.0.0-00010101000000-000000000000
+)
+
+replace (
+	github.com/humamfauzi/go-notification/auth => ../auth
+	github.com/humamfauzi/go-notification/broker => ../broker
+	github.com/humamfauzi/go-notification/database => ../database
+	github.com/humamfauzi/go-notification/queue => ../queue
+	github.com/humamfauzi/go-notification/webhook => ../webhook
 )
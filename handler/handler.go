@@ -1,28 +1,22 @@
 package handler
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 	"io/ioutil"
-	"log"
 	"net/http"
-	"strconv"
 	
 	"github.com/gorilla/mux"
 
 	dba "github.com/humamfauzi/go-notification/database"
 	"github.com/humamfauzi/go-notification/utils"
 	"github.com/humamfauzi/go-notification/auth"
-)
-
-const (
-	QUERY_MAP_RELATIVE_LOCATION = "../database/queryMap.json"
-)
-
-var (
-	dbConn dba.ITransactionSQL
+	"github.com/humamfauzi/go-notification/queue"
+	"github.com/humamfauzi/go-notification/webhook"
 )
 
 /**
@@ -34,20 +28,13 @@ var (
 	MySQL when needed arises.
 
 	This also implicitly tells that handler does not care what database it impelemented
-	as long as capability to excute a query
+	as long as capability to excute a query. Each database tell which
+	query map it use since the SQL dialect differ
 
 */
 type DbConnection interface {
 	ConnectDatabase() (dba.ITransactionSQL, error)
-}
-
-func ConnectToDatabase(dbProfile DbConnection) {
-	connDB, err := dbProfile.ConnectDatabase()
-	dba.ConvertJsonToQueryMap(QUERY_MAP_RELATIVE_LOCATION)
-	if err != nil {
-		panic(err)
-	}
-	dbConn = connDB
+	QueryMapName() string
 }
 
 func HomeHandler(w http.ResponseWriter, r *http.Request) {
@@ -56,61 +43,78 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func LoggerMiddleware(next http.Handler) http.Handler {
+func (s *Server) LoggerMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Println("ACCESSED", r.Header.Get("User-Agent"))
+		s.Logger.Println("ACCESSED", r.Header.Get("User-Agent"))
 		next.ServeHTTP(w, r)
 	})
 }
 
-func getUserProfileFromAuth(accessToken string) (dba.UserProfile, error) {
-	userProfile := dba.UserProfile{}
-	wherePairs := [][]string{
-		[]string{
-			"token", "=", accessToken,
-		},
-	}
-	if err := userProfile.Find(dbConn, []string{"id"}, wherePairs); err != nil {
-		return userProfile, err
-	}
-	return userProfile, nil
+func (s *Server) getUserProfileFromAuth(accessToken string) (dba.UserProfile, error) {
+	qb := dba.NewQueryBuilder().Select("id", "role").Where("token", "=", accessToken)
+	return s.Store.FindUser(qb)
 }
 
+type contextKey string
+
+const (
+	requesterKey contextKey = "requester"
+	apiKeyKey contextKey = "apiKey"
+)
+
+// Requester is put in the request context by RoleMiddleware, client cannot forge it
 func getRequesterProfile(r *http.Request) (dba.UserProfile, error) {
-	requester := r.Header.Get("requesterProfile")
-	userProfile := dba.UserProfile{}
-	if len(requester) == 0 {
-		return userProfile, errors.New("Unknown Requester")
-	}
-	identity := []byte(requester)	
-	if err := json.Unmarshal(identity, &userProfile); err != nil {
-		return userProfile, errors.New("Unknown Requester")
+	userProfile, ok := r.Context().Value(requesterKey).(dba.UserProfile)
+	if !ok || len(userProfile.Id) == 0 {
+		return dba.UserProfile{}, errors.New("Unknown Requester")
 	}
 	return userProfile, nil
 }
 
-func TokenCheckMiddleware(next http.Handler) http.Handler {
+// Admin satisfy every role
+func roleAllowed(userRole, requiredRole string) bool {
+	return userRole == requiredRole || userRole == dba.USER_ROLE_ADMIN
+}
+
+/**
+	Only let a requester with the role through. Missing, expired or
+	unknown token get 401, a known user without the role get 403.
+	queryToken also accept the token query parameter, see streamAuthentication
+*/
+func (s *Server) RoleMiddleware(role string, queryToken bool, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authenticationToken := r.Header.Get("Authentication")
+		if queryToken {
+			authenticationToken = streamAuthentication(r)
+		}
 		if len(authenticationToken) == 0 {
-			w.WriteHeader(http.StatusForbidden)
+			WriteReply(int(http.StatusUnauthorized), false, "Missing Token", w)
 			return
 		}
-		accessToken, ok := auth.VerifyToken(authenticationToken, auth.KeyFunction);
-		if !ok {
-			w.WriteHeader(http.StatusForbidden)
+		accessToken, ok := auth.VerifyToken(authenticationToken, s.Keys.KeyFunction)
+		// revoked access token is stored as empty, never match it
+		if !ok || len(accessToken) == 0 {
+			WriteReply(int(http.StatusUnauthorized), false, "Invalid Token", w)
 			return
 		}
-		userProfile, err := getUserProfileFromAuth(accessToken)
+		userProfile, err := s.getUserProfileFromAuth(accessToken)
 		if err != nil {
-			WriteReply(int(http.StatusBadRequest), false, "Cannot find matched Token", w)
+			WriteReply(int(http.StatusUnauthorized), false, "Cannot find matched Token", w)
 			return
 		}
-		r.Header.Add("requesterProfile", userProfile.ToStringJSON())
-		next.ServeHTTP(w, r)
+		if !roleAllowed(userProfile.Role, role) {
+			WriteReply(int(http.StatusForbidden), false, "Not Allowed", w)
+			return
+		}
+		ctx := context.WithValue(r.Context(), requesterKey, userProfile)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+func (s *Server) TokenCheckMiddleware(next http.Handler) http.Handler {
+	return s.RoleMiddleware(dba.USER_ROLE_USER, false, next)
+}
+
 type HandlerReply struct {
 	Code int `json:"code"`
 	Success bool `json:"sucess"`
@@ -129,7 +133,7 @@ func WriteReply(code int, success bool, message interface{}, w http.ResponseWrit
 }
 
 
-func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		WriteReply(int(http.StatusBadRequest), false, "Cannot Read Payload", w)
@@ -149,7 +153,7 @@ func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 
 	userProfile.Id = utils.RandomStringId("user", 10)
 	userProfile.Password = storedPassword
-	if _, err := userProfile.Insert(dbConn); err != nil {
+	if err := s.Store.InsertUser(userProfile); err != nil {
 		WriteReply(int(http.StatusBadRequest), false, fmt.Sprintf("Cannot Write Payload %v", err), w)
 		return
 	}
@@ -157,17 +161,16 @@ func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-type LoginOps struct {}
+type LoginOps struct {
+	*Server
+}
 
 func (lo LoginOps) searchUserByEmailAndCheckPassword(email, password string) (dba.UserProfile, error) {
-	profileFromDB := dba.UserProfile{}
-	selectCols := []string{"id", "email", "password"}
-	wherePairs := [][]string{
-		[]string{
-			"email", "=", email,
-		},
-	}
-	if err := profileFromDB.Find(dbConn, selectCols, wherePairs); err != nil {
+	qb := dba.NewQueryBuilder().
+		Select("id", "email", "password").
+		Where("email", "=", email)
+	profileFromDB, err := lo.Store.FindUser(qb)
+	if err != nil {
 		return profileFromDB, err
 	}
 	storedPassword := []byte(profileFromDB.Password)
@@ -181,9 +184,9 @@ func (lo LoginOps) searchUserByEmailAndCheckPassword(email, password string) (db
 
 func (lo LoginOps) generateJWT(token string) (string, error) {
 	mapClaims := make(map[string]interface{})
-	mapClaims["exp"] = time.Now().Add(time.Minute * 15).Unix()
+	mapClaims["exp"] = time.Now().Add(lo.Config.TokenExpiry).Unix()
 	mapClaims["access_token"] = token
-	return auth.CreateToken(mapClaims, auth.GetAuthSecret())
+	return lo.Keys.CreateToken(mapClaims)
 }
 
 func (lo LoginOps) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -204,48 +207,88 @@ func (lo LoginOps) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken := utils.RandomStringId("accessToken", 64)
-	token, err := lo.generateJWT(accessToken)
+	token, err := lo.issueAccessToken(storedUserProfile)
 	if err != nil {
 		WriteReply(int(http.StatusBadRequest), false, "Token Generation Error", w)
 		return
 	}
-	storedUserProfile.Token = accessToken
-	storedUserProfile.Update(dbConn, []string{"token"})
-	reply := struct {
-		Token string `json:"token"`
-	}{ token }
-	WriteReply(int(http.StatusOK), true, reply, w)
+	// every login start a new refresh token family
+	refreshToken, storedRefreshToken, err := lo.newRefreshToken(storedUserProfile.Id, utils.RandomStringId("family", 32))
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Token Generation Error", w)
+		return
+	}
+	if _, err := lo.Store.InsertRefreshToken(storedRefreshToken); err != nil {
+		lo.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Token Generation Error", w)
+		return
+	}
+	WriteReply(int(http.StatusOK), true, TokenReply{token, refreshToken}, w)
 	return
 }
 
 type CheckLogin struct {}
 
 func (cl CheckLogin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	requester := r.Header.Get("requesterProfile")
-	if len(requester) == 0 {
+	if _, err := getRequesterProfile(r); err != nil {
 		WriteReply(int(http.StatusBadRequest), false, "Unknown Requester", w)
 		return
 	}
 	WriteReply(int(http.StatusOK), true, "Login Verfied", w)
 }
 
-func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
+/**
+	User can only update itself, admin can update anyone. Only email and
+	password can be changed. Password is hashed together with the email so
+	changing the email need the password as well
+*/
+func (s *Server) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	requester, err := getRequesterProfile(r)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
+	}
+	userId := mux.Vars(r)["id"]
+	if userId != requester.Id && requester.Role != dba.USER_ROLE_ADMIN {
+		WriteReply(int(http.StatusForbidden), false, "Cannot Update Other User", w)
+		return
+	}
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		WriteReply(int(http.StatusBadRequest), false, "Cannot Read Payload", w)
 		return
 	}
-	userProfile := dba.UserProfile{
-		Id: vars["id"],
-	}
-	if err := json.Unmarshal(body, &userProfile); err != nil {
+	request := dba.UserProfile{}
+	if err := json.Unmarshal(body, &request); err != nil {
 		WriteReply(int(http.StatusBadRequest), false, "Cannot Parse Payload", w)
 		return
 	}
-	updateables := userProfile.GetFilledKey()
-	if _, err := userProfile.Update(dbConn, updateables); err != nil {
+	if len(request.Password) == 0 {
+		WriteReply(int(http.StatusBadRequest), false, "Password is Needed", w)
+		return
+	}
+	qb := dba.NewQueryBuilder().Select("id", "email").Where("id", "=", userId)
+	userProfile, err := s.Store.FindUser(qb)
+	if err == sql.ErrNoRows {
+		WriteReply(int(http.StatusNotFound), false, "User Not Found", w)
+		return
+	}
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	updateables := []string{"password"}
+	if len(request.Email) != 0 {
+		userProfile.Email = request.Email
+		updateables = append(updateables, "email")
+	}
+	storedPassword, err := auth.BcryptConvertTo(userProfile.Email, request.Password)
+	if err != nil {
+		WriteReply(int(http.StatusInternalServerError), false, "Cannot use auth conversion", w)
+		return
+	}
+	userProfile.Password = storedPassword
+	if err := s.Store.UpdateUser(userProfile, updateables); err != nil {
 		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
 		return
 	}
@@ -253,12 +296,13 @@ func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	userProfile, err := getRequesterProfile(r)
 	if err != nil {
 		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
 	}
-	if _, err := userProfile.Delete(dbConn); err != nil {
+	if err := s.Store.DeleteUser(userProfile); err != nil {
 		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
 		return
 	}
@@ -266,10 +310,11 @@ func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func CreateTopicHandler(w http.ResponseWriter,r *http.Request) {
+func (s *Server) CreateTopicHandler(w http.ResponseWriter,r *http.Request) {
 	userProfile, err := getRequesterProfile(r)
 	if err != nil {
 		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
 	}
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -281,8 +326,19 @@ func CreateTopicHandler(w http.ResponseWriter,r *http.Request) {
 		WriteReply(int(http.StatusBadRequest), false, "Cannot Parse Payload", w)
 		return
 	}
+	if len(topicProfile.Visibility) == 0 {
+		topicProfile.Visibility = dba.TOPIC_VISIBILITY_PUBLIC
+	}
+	if !dba.IsTopicVisibility(topicProfile.Visibility) {
+		WriteReply(int(http.StatusBadRequest), false, "Unknown Visibility", w)
+		return
+	}
+	if topicProfile.Tags, err = normalizeTags(topicProfile.Tags); err != nil {
+		WriteReply(int(http.StatusBadRequest), false, err.Error(), w)
+		return
+	}
 	topicProfile.UserId = userProfile.Id
-	if _, err := topicProfile.Insert(dbConn); err != nil {
+	if _, err := s.Store.InsertTopic(topicProfile); err != nil {
 		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
 		return
 	}
@@ -290,21 +346,44 @@ func CreateTopicHandler(w http.ResponseWriter,r *http.Request) {
 	return
 }
 
-func GetTopicHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetTopicHandler(w http.ResponseWriter, r *http.Request) {
 	userProfile, err := getRequesterProfile(r)
 	if err != nil {
 		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
+	}
+	// Every topic the requester has a role on, owned or invited
+	qb := dba.NewQueryBuilder().Select("topic_id").Where("user_id", "=", userProfile.Id)
+	topicMembers, err := s.Store.GetTopicMembers(qb)
+	// member of nothing yet
+	if err == sql.ErrNoRows {
+		WriteReply(int(http.StatusOK), true, dba.Topics{}, w)
+		return
+	}
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
 	}
-	selectColumn := []string{"*"}
-	wherePairs := [][]string{
-		[]string {
-			"user_id", "=", userProfile.Id,
-		},
+	topicIds := make([]interface{}, len(topicMembers))
+	for i := range topicMembers {
+		topicIds[i] = topicMembers[i].TopicId
 	}
+	qb = dba.NewQueryBuilder().
+		In("id", topicIds...).
+		Where("deleted_at", "=", 0).
+		OrderBy("id", dba.ORDER_ASC)
 
-	topicProfiles := dba.Topics{}
-	if err := topicProfiles.Get(dbConn, selectColumn, wherePairs, [][]string{}); err != nil {
-		fmt.Println(err)
+	topicProfiles, err := s.Store.GetTopics(qb)
+	// every topic of the requester is deleted
+	if err == sql.ErrNoRows {
+		WriteReply(int(http.StatusOK), true, dba.Topics{}, w)
+		return
+	}
+	if err == nil {
+		topicProfiles, err = s.withTags(topicProfiles)
+	}
+	if err != nil {
+		s.Logger.Println(err)
 		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
 		return
 	}
@@ -312,10 +391,11 @@ func GetTopicHandler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func CreateSubscribeHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) CreateSubscribeHandler(w http.ResponseWriter, r *http.Request) {
 	userProfile, err := getRequesterProfile(r)
 	if err != nil {
 		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
 	}
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -327,72 +407,166 @@ func CreateSubscribeHandler(w http.ResponseWriter, r *http.Request) {
 		WriteReply(int(http.StatusBadRequest), false, "Cannot Parse Payload", w)
 		return
 	}
+	role, err := s.TopicRole(userProfile.Id, subscriberProfile.TopicId)
+	if err != nil {
+		WriteReply(int(http.StatusNotFound), false, "Topic Not Found", w)
+		return
+	}
+	// private topic without a role, the owner decide
+	requested := len(role) == 0
+	if !requested && !dba.TopicRoleAtLeast(role, dba.TOPIC_ROLE_SUBSCRIBER) {
+		s.audit(userProfile.Id, dba.AUDIT_MEMBER_DENIED, topicTarget(subscriberProfile.TopicId), "subscribe as " + role)
+		WriteReply(int(http.StatusForbidden), false, "Not Allowed to Subscribe", w)
+		return
+	}
 	subscriberProfile.UserId = userProfile.Id
-	if _, err := subscriberProfile.Insert(dbConn); err != nil {
-		fmt.Println(err)
+	subscriberProfile.Secret = ""
+	if len(subscriberProfile.CallbackUrl) != 0 {
+		if err := s.validateCallbackUrl(subscriberProfile.CallbackUrl); err != nil {
+			WriteReply(int(http.StatusBadRequest), false, err.Error(), w)
+			return
+		}
+		secret, err := webhook.GenerateSecret()
+		if err != nil {
+			WriteReply(int(http.StatusInternalServerError), false, "Cannot Generate Secret", w)
+			return
+		}
+		subscriberProfile.Secret = secret
+	}
+	qb := dba.NewQueryBuilder().
+		Select("id").
+		Where("topic_id", "=", subscriberProfile.TopicId).
+		Where("user_id", "=", userProfile.Id)
+	if _, err := s.Store.GetSubscribers(qb); err == nil {
+		WriteReply(int(http.StatusConflict), false, "Already Subscribed", w)
+		return
+	}
+	if requested {
+		s.requestSubscription(subscriberProfile, w)
+		return
+	}
+	subscriberProfile.UnsubscribeToken, err = auth.GenerateUnsubscribeToken()
+	if err != nil {
+		WriteReply(int(http.StatusInternalServerError), false, "Cannot Generate Token", w)
+		return
+	}
+	if _, err := s.Store.InsertSubscriber(subscriberProfile); err != nil {
+		s.Logger.Println(err)
 		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
 		return
 	}
-	WriteReply(int(http.StatusOK), true, nil, w)
+	if len(subscriberProfile.Secret) == 0 {
+		WriteReply(int(http.StatusOK), true, nil, w)
+		return
+	}
+	// Secret is only shown once, receiver need it to verify the signature
+	reply := struct {
+		Secret string `json:"secret"`
+	}{ subscriberProfile.Secret }
+	WriteReply(int(http.StatusOK), true, reply, w)
 	return
 }
 
-type CreateNotification struct {}
+type CreateNotification struct {
+	*Server
+}
 
-func (cn CreateNotification) GetAllSubscribers(topicId int) ([]string, error) {
-	users := dba.Subscribers{}
-	selectColumn := []string{"user_id"}
-	wherePairs := [][]string{
-		[]string{
-			"topic_id", "=", strconv.Itoa(topicId),
-		},
-	}
-	if err := users.Get(dbConn, selectColumn, wherePairs); err != nil {
-		return []string{}, err
-	}
-	userId := make([]string, len(users))
-	for i:=0; i < len(users); i++ {
-		userId[i] = users[i].UserId
-	}
-	return userId, nil
+func (cn CreateNotification) GetAllSubscribers(topicId int) (dba.Subscribers, error) {
+	qb := dba.NewQueryBuilder().Select("user_id", "unsubscribe_token").Where("topic_id", "=", topicId)
+	return cn.Store.GetSubscribers(qb)
 }
 
-func (cn CreateNotification) ComposeNotification(users []string, topicId int, message string) dba.Notifications {
+// Every notification carry the unsubscribe token of its subscriber
+func (cn CreateNotification) ComposeNotification(users dba.Subscribers, topicId int, message string) dba.Notifications {
 	notificationList := make([]dba.Notification, len(users))
+	createdAt := time.Now().Unix()
 	for i := 0; i < len(users); i++ {
-		notificationList[i].UserId = users[i]
+		notificationList[i].UserId = users[i].UserId
 		notificationList[i].Message = message
 		notificationList[i].TopicId = topicId
+		notificationList[i].CreatedAt = createdAt
+		notificationList[i].UnsubscribeToken = users[i].UnsubscribeToken
 	}
 	return dba.Notifications(notificationList)
 }
 
-func (cn CreateNotification) IsTopicBelongToUser(userId string, topicId int) bool {
-	selectColumn := []string{"user_id"}
-	wherePairs := [][]string{
-		[]string{
-			"user_id", "=", userId,
-		},
-		[]string{
-			"topic_id", "=", strconv.Itoa(topicId),
-		},
-	}
-	afterWhere := [][]string{
-		[]string{
-			"order by", "id", "desc",
-		},
-		[]string{
-			"limit", "1",
-		},
-	}
-	topics := dba.Topics{}
-	if err := topics.Get(dbConn, selectColumn, wherePairs, afterWhere); err != nil {
+// Publisher, admin and owner of the topic can publish to it
+func (cn CreateNotification) CanPublish(userId string, topicId int) bool {
+	role, err := cn.TopicRole(userId, topicId)
+	if err != nil {
 		return false
 	}
-	if len(topics) < 1 {
-		return false
+	return dba.TopicRoleAtLeast(role, dba.TOPIC_ROLE_PUBLISHER)
+}
+
+/**
+	Publisher is either the requester or an api key. Api key can only
+	publish to its own topics and only while its owner still can.
+	Denied attempt is written to the audit trail
+*/
+func (cn CreateNotification) authorizePublish(r *http.Request, topicId int) (bool, error) {
+	if apiKey, ok := getRequesterApiKey(r); ok {
+		if !apiKeyHasTopic(apiKey, topicId) || !cn.CanPublish(apiKey.UserId, topicId) {
+			cn.audit(apiKey.UserId, dba.AUDIT_PUBLISH_DENIED, topicTarget(topicId), "api_key " + apiKey.Prefix)
+			return false, nil
+		}
+		return true, nil
 	}
-	return true
+	requester, err := getRequesterProfile(r)
+	if err != nil {
+		return false, err
+	}
+	if !cn.CanPublish(requester.Id, topicId) {
+		cn.audit(requester.Id, dba.AUDIT_PUBLISH_DENIED, topicTarget(topicId), "")
+		return false, nil
+	}
+	return true, nil
+}
+
+// Subscriber of the topic that registered a callback URL, keyed by user id
+func (cn CreateNotification) GetWebhookSubscribers(topicId int) (map[string]dba.Subscriber, error) {
+	qb := dba.NewQueryBuilder().
+		Select("id", "user_id").
+		Where("topic_id", "=", topicId).
+		Where("callback_url", "!=", "")
+	webhookSubscribers := make(map[string]dba.Subscriber)
+	subscribers, err := cn.Store.GetSubscribers(qb)
+	if err == sql.ErrNoRows {
+		return webhookSubscribers, nil
+	}
+	if err != nil {
+		return webhookSubscribers, err
+	}
+	for _, subscriber := range subscribers {
+		webhookSubscribers[subscriber.UserId] = subscriber
+	}
+	return webhookSubscribers, nil
+}
+
+/**
+	Insert notification one by one inside a transaction so every
+	notification hold its own id before being pushed to live stream.
+	Webhook delivery job is written in the same transaction so a
+	restart never lose a notification that should be delivered
+*/
+func (cn CreateNotification) InsertNotifications(notifications dba.Notifications, webhookSubscribers map[string]dba.Subscriber) error {
+	err := cn.Store.InsertNotifications(notifications, func(notification dba.Notification) (*dba.DeliveryJob, error) {
+		subscriber, ok := webhookSubscribers[notification.UserId]
+		if !ok {
+			return nil, nil
+		}
+		payload, err := json.Marshal(notification)
+		if err != nil {
+			return nil, err
+		}
+		job := queue.NewJob(WEBHOOK_CHANNEL, subscriber.Id, notification.Id, payload)
+		return &job, nil
+	})
+	if err != nil {
+		return err
+	}
+	cn.unread.inserted(notifications)
+	return nil
 }
 
 func (cn CreateNotification) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -406,44 +580,73 @@ func (cn CreateNotification) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		WriteReply(int(http.StatusBadRequest), false, "Cannot Parse Payload", w)
 		return
 	}
+	allowed, err := cn.authorizePublish(r, request.TopicId)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
+	}
+	if !allowed {
+		WriteReply(int(http.StatusForbidden), false, "Not Allowed to Publish", w)
+		return
+	}
 	
 	users, err := cn.GetAllSubscribers(request.TopicId)
 	if err != nil {
-		fmt.Println(err)
+		cn.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get All Subscriber", w)
+		return
+	}
+
+	webhookSubscribers, err := cn.GetWebhookSubscribers(request.TopicId)
+	if err != nil {
+		cn.Logger.Println(err)
 		WriteReply(int(http.StatusBadRequest), false, "Cannot Get All Subscriber", w)
 		return
 	}
 
 	notifications := cn.ComposeNotification(users, request.TopicId, request.Message)
-	if _, err := notifications.Insert(dbConn); err != nil {
+	if err := cn.InsertNotifications(notifications, webhookSubscribers); err != nil {
 		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
 		return
 	}
+	cn.publishNotifications(notifications)
 	WriteReply(int(http.StatusOK), true, nil, w)
 	return
 }
 
-func GetNotificationHandler(w http.ResponseWriter, r *http.Request) {
+/**
+	Newest first, one page at a time. The next page is asked with the
+	next_cursor of the previous one, it stay correct while new
+	notification keep coming unlike an offset
+*/
+func (s *Server) GetNotificationHandler(w http.ResponseWriter, r *http.Request) {
 	userProfile, err := getRequesterProfile(r)
 	if err != nil {
 		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
 		return
 	}
-	notifications := dba.Notifications{}
-	selectColumn := []string{"*"}
-	wherePairs := [][]string{
-		[]string{"user_id", "=", userProfile.Id},
-	}
-	if err := notifications.Get(dbConn, selectColumn, wherePairs); err != nil {
-		fmt.Println(err)
-		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+	qb, err := notificationFilter(r, userProfile.Id)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, err.Error(), w)
 		return
 	}
-	reply, err := json.Marshal(notifications)
+	limit := queryInt(r, "limit", s.Config.NotificationLimit, s.Config.MaxNotificationLimit)
+	if limit == 0 {
+		limit = s.Config.NotificationLimit
+	}
+	// One more row tell whether there is another page
+	notifications, err := s.ownedNotifications(qb.OrderBy("id", dba.ORDER_DESC).Limit(limit + 1))
 	if err != nil {
-		WriteReply(int(http.StatusInternalServerError), false, "Cannot Wrap Result", w)
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
 		return
 	}
-	WriteReply(int(http.StatusOK), true, reply, w)
+	page := notificationPage{Notifications: notifications}
+	if len(notifications) > limit {
+		page.Notifications = notifications[:limit]
+		page.NextCursor = page.Notifications[limit-1].Id
+		page.HasMore = true
+	}
+	WriteReply(int(http.StatusOK), true, page, w)
 	return
 }
@@ -4,17 +4,23 @@ import (
 	"testing"
 	"strings"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"net/http"
 	"net/http/httptest"
 	"encoding/json"
 	dba "github.com/humamfauzi/go-notification/database"
 	"github.com/humamfauzi/go-notification/utils"
 	"fmt"
-	b64 "encoding/base64"
 )
 
 const (
 	baseUrl = "http://example.com"
+	QUERY_MAP_RELATIVE_DIRECTORY = "../database/"
+)
+
+var (
+	testServer *Server
 )
 
 type handlerBuffer struct {
@@ -51,12 +57,12 @@ func createUserAndLogin(t *testing.T) string {
 	jsonReader := strings.NewReader(exampleJson)
 	req := httptest.NewRequest(http.MethodPost, baseUrl + "/users", jsonReader)
 	w := httptest.NewRecorder()
-	CreateUserHandler(w, req)
+	testServer.CreateUserHandler(w, req)
 
 	jsonReader = strings.NewReader(exampleJson)
 	req = httptest.NewRequest(http.MethodPost, baseUrl + "/users/login", jsonReader) 
 	w = httptest.NewRecorder()
-	loginOps := LoginOps{}
+	loginOps := LoginOps{testServer}
 	loginOps.ServeHTTP(w, req)
 	
 	resp := w.Result()
@@ -68,15 +74,50 @@ func createUserAndLogin(t *testing.T) string {
 	return token
 }
 
-func TestConnectToDatabase(t *testing.T) {
-	connProp := dba.MysqlDatabaseAccess{
-		Username: "root",
-		Password: "",
-		Protocol: "tcp",
-		Address: "localhost",
-		DBName: "try1",
+/**
+	Every test run against a fresh SQLite file so the suite
+	does not need a running MySQL. With GO_ENV=test the handler
+	use the in-memory store and no database is opened at all
+*/
+func TestMain(m *testing.M) {
+	if os.Getenv("GO_ENV") == "test" {
+		testServer = NewServer(dba.NewMemoryStore())
+		testServer.webhookSender.LookupIPAddr = fakeLookupIPAddr
+		os.Exit(m.Run())
+	}
+	dir, err := ioutil.TempDir("", "notification-handler")
+	if err != nil {
+		panic(err)
+	}
+	connDB, err := ConnectDatabase(dba.SqliteDatabaseAccess{
+		Path: filepath.Join(dir, "test.db"),
+	}, QUERY_MAP_RELATIVE_DIRECTORY)
+	if err != nil {
+		panic(err)
+	}
+	migrator, err := dba.NewMigrator(connDB, dba.MigrationDirectory(QUERY_MAP_RELATIVE_DIRECTORY))
+	if err != nil {
+		panic(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		panic(err)
+	}
+	testServer = NewServer(dba.NewSQLStore(connDB))
+	testServer.DB = connDB
+	testServer.webhookSender.LookupIPAddr = fakeLookupIPAddr
+	code := m.Run()
+	connDB.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestConnectDatabase(t *testing.T) {
+	if testServer.DB == nil {
+		t.Skip("in-memory store, no database connected")
+	}
+	if err := testServer.DB.Ping(); err != nil {
+		t.Fatalf("want nil get %v", err)
 	}
-	ConnectToDatabase(connProp)
 }
 
 func TestCreateUserHandler(t *testing.T) {
@@ -85,7 +126,7 @@ func TestCreateUserHandler(t *testing.T) {
 		"password": "rahasia"
 	}`
 	jsonReader := strings.NewReader(exampleJson)
-	handler := CreateUserHandler
+	handler := testServer.CreateUserHandler
 	req := httptest.NewRequest(http.MethodPost, baseUrl + "/users", jsonReader)
 	w := httptest.NewRecorder()
 	handler(w, req)
@@ -112,12 +153,12 @@ func TestLogin(t *testing.T) {
 	jsonReader := strings.NewReader(exampleJson)
 	req := httptest.NewRequest(http.MethodPost, baseUrl + "/users", jsonReader)
 	w := httptest.NewRecorder()
-	CreateUserHandler(w, req)
+	testServer.CreateUserHandler(w, req)
 
 	jsonReader = strings.NewReader(exampleJson)
 	req = httptest.NewRequest(http.MethodPost, baseUrl + "/users/login", jsonReader) 
 	w = httptest.NewRecorder()
-	loginOps := LoginOps{}
+	loginOps := LoginOps{testServer}
 	loginOps.ServeHTTP(w, req)
 	
 	resp := w.Result()
@@ -146,7 +187,7 @@ func TestCheckLogin(t *testing.T) {
 	req.Header["Content-Type"] = []string{"application/json",}
 	w := httptest.NewRecorder()
 	checkLogin := CheckLogin{}
-	wrappedFunc := TokenCheckMiddleware(checkLogin)
+	wrappedFunc := testServer.TokenCheckMiddleware(checkLogin)
 	wrappedFunc.ServeHTTP(w, req)
 
 	resp := w.Result()
@@ -166,8 +207,8 @@ func TestDeleteUserHandler(t *testing.T) {
 	req.Header["Authentication"] = []string{"Bearer " + token,}
 	req.Header["Content-Type"] = []string{"application/json"}
 	w := httptest.NewRecorder()
-	fw := functionWrapper(DeleteUserHandler)
-	wrappedFunc := TokenCheckMiddleware(fw)
+	fw := functionWrapper(testServer.DeleteUserHandler)
+	wrappedFunc := testServer.TokenCheckMiddleware(fw)
 	wrappedFunc.ServeHTTP(w, req)
 
 	resp := w.Result()
@@ -190,8 +231,8 @@ func TestCreateTopicHandler(t *testing.T) {
 	req.Header["Authentication"] = []string{"Bearer " + token,}
 	req.Header["Content-Type"] = []string{"application/json"}
 	w := httptest.NewRecorder()
-	fw := functionWrapper(CreateTopicHandler)
-	wrappedFunc := TokenCheckMiddleware(fw)
+	fw := functionWrapper(testServer.CreateTopicHandler)
+	wrappedFunc := testServer.TokenCheckMiddleware(fw)
 	wrappedFunc.ServeHTTP(w, req)
 	resp := w.Result()
 	body, _ := ioutil.ReadAll(resp.Body)
@@ -213,8 +254,8 @@ func TestGetTopicHandler(t *testing.T) {
 	req.Header["Authentication"] = []string{"Bearer " + token,}
 	req.Header["Content-Type"] = []string{"application/json"}
 	w := httptest.NewRecorder()
-	fw := functionWrapper(CreateTopicHandler)
-	wrappedFunc := TokenCheckMiddleware(fw)
+	fw := functionWrapper(testServer.CreateTopicHandler)
+	wrappedFunc := testServer.TokenCheckMiddleware(fw)
 	wrappedFunc.ServeHTTP(w, req)
 	resp := w.Result()
 	body, _ := ioutil.ReadAll(resp.Body)
@@ -230,8 +271,8 @@ func TestGetTopicHandler(t *testing.T) {
 	req.Header["Authentication"] = []string{"Bearer " + token,}
 	req.Header["Content-Type"] = []string{"application/json"}
 	w = httptest.NewRecorder()
-	fw = functionWrapper(GetTopicHandler)
-	wrappedFunc = TokenCheckMiddleware(fw)
+	fw = functionWrapper(testServer.GetTopicHandler)
+	wrappedFunc = testServer.TokenCheckMiddleware(fw)
 	wrappedFunc.ServeHTTP(w, req)
 	resp = w.Result()
 	body, _ = ioutil.ReadAll(resp.Body)
@@ -258,8 +299,8 @@ func TestCreateSubscribeHandler(t *testing.T) {
 	req.Header["Authentication"] = []string{"Bearer " + token,}
 	req.Header["Content-Type"] = []string{"application/json"}
 	w := httptest.NewRecorder()
-	fw := functionWrapper(CreateTopicHandler)
-	wrappedFunc := TokenCheckMiddleware(fw)
+	fw := functionWrapper(testServer.CreateTopicHandler)
+	wrappedFunc := testServer.TokenCheckMiddleware(fw)
 	wrappedFunc.ServeHTTP(w, req)
 	resp := w.Result()
 	body, _ := ioutil.ReadAll(resp.Body)
@@ -278,8 +319,8 @@ func TestCreateSubscribeHandler(t *testing.T) {
 	req.Header["Authentication"] = []string{"Bearer " + token,}
 	req.Header["Content-Type"] = []string{"application/json",}
 	w = httptest.NewRecorder()
-	fw = functionWrapper(GetTopicHandler)
-	wrappedFunc = TokenCheckMiddleware(fw)
+	fw = functionWrapper(testServer.GetTopicHandler)
+	wrappedFunc = testServer.TokenCheckMiddleware(fw)
 	wrappedFunc.ServeHTTP(w, req)
 	reply = extractReply(w)
 	if reply.Code != http.StatusOK {
@@ -305,8 +346,8 @@ func TestCreateSubscribeHandler(t *testing.T) {
 	req.Header["Authentication"] = []string{"Bearer " + tokenSubcriber,}
 	req.Header["Content-Type"] = []string{"application/json",}
 	w = httptest.NewRecorder()
-	fw = functionWrapper(CreateSubscribeHandler)
-	wrappedFunc = TokenCheckMiddleware(fw)
+	fw = functionWrapper(testServer.CreateSubscribeHandler)
+	wrappedFunc = testServer.TokenCheckMiddleware(fw)
 	wrappedFunc.ServeHTTP(w, req)
 	reply = extractReply(w)
 	if reply.Code != http.StatusOK {
@@ -324,8 +365,8 @@ func TestCreateNotificationHandler(t *testing.T) {
 	req.Header["Authentication"] = []string{"Bearer " + token,}
 	req.Header["Content-Type"] = []string{"application/json"}
 	w := httptest.NewRecorder()
-	fw := functionWrapper(CreateTopicHandler)
-	wrappedFunc := TokenCheckMiddleware(fw)
+	fw := functionWrapper(testServer.CreateTopicHandler)
+	wrappedFunc := testServer.TokenCheckMiddleware(fw)
 	wrappedFunc.ServeHTTP(w, req)
 	resp := w.Result()
 	body, _ := ioutil.ReadAll(resp.Body)
@@ -344,8 +385,8 @@ func TestCreateNotificationHandler(t *testing.T) {
 	req.Header["Authentication"] = []string{"Bearer " + token,}
 	req.Header["Content-Type"] = []string{"application/json",}
 	w = httptest.NewRecorder()
-	fw = functionWrapper(GetTopicHandler)
-	wrappedFunc = TokenCheckMiddleware(fw)
+	fw = functionWrapper(testServer.GetTopicHandler)
+	wrappedFunc = testServer.TokenCheckMiddleware(fw)
 	wrappedFunc.ServeHTTP(w, req)
 	reply = extractReply(w)
 	if reply.Code != http.StatusOK {
@@ -371,8 +412,8 @@ func TestCreateNotificationHandler(t *testing.T) {
 	req.Header["Authentication"] = []string{"Bearer " + subscriberToken,}
 	req.Header["Content-Type"] = []string{"application/json",}
 	w = httptest.NewRecorder()
-	fw = functionWrapper(CreateSubscribeHandler)
-	wrappedFunc = TokenCheckMiddleware(fw)
+	fw = functionWrapper(testServer.CreateSubscribeHandler)
+	wrappedFunc = testServer.TokenCheckMiddleware(fw)
 	wrappedFunc.ServeHTTP(w, req)
 	reply = extractReply(w)
 	if reply.Code != http.StatusOK {
@@ -387,8 +428,8 @@ func TestCreateNotificationHandler(t *testing.T) {
 	req.Header["Authentication"] = []string{"Bearer " + token,}
 	req.Header["Content-Type"] = []string{"application/json",}
 	w = httptest.NewRecorder()
-	createNotification := CreateNotification{}
-	wrappedFunc = TokenCheckMiddleware(createNotification)
+	createNotification := CreateNotification{testServer}
+	wrappedFunc = testServer.TokenCheckMiddleware(createNotification)
 	wrappedFunc.ServeHTTP(w, req)
 	reply = extractReply(w)
 	if reply.Code != http.StatusOK {
@@ -414,8 +455,8 @@ func TestGetNotificationHandler(t *testing.T) {
 	req.Header["Authentication"] = []string{"Bearer " + token,}
 	req.Header["Content-Type"] = []string{"application/json"}
 	w := httptest.NewRecorder()
-	fw := functionWrapper(CreateTopicHandler)
-	wrappedFunc := TokenCheckMiddleware(fw)
+	fw := functionWrapper(testServer.CreateTopicHandler)
+	wrappedFunc := testServer.TokenCheckMiddleware(fw)
 	wrappedFunc.ServeHTTP(w, req)
 	resp := w.Result()
 	body, _ := ioutil.ReadAll(resp.Body)
@@ -431,8 +472,8 @@ func TestGetNotificationHandler(t *testing.T) {
 	req.Header["Authentication"] = []string{"Bearer " + token,}
 	req.Header["Content-Type"] = []string{"application/json",}
 	w = httptest.NewRecorder()
-	fw = functionWrapper(GetTopicHandler)
-	wrappedFunc = TokenCheckMiddleware(fw)
+	fw = functionWrapper(testServer.GetTopicHandler)
+	wrappedFunc = testServer.TokenCheckMiddleware(fw)
 	wrappedFunc.ServeHTTP(w, req)
 	reply = extractReply(w)
 	if reply.Code != http.StatusOK {
@@ -460,8 +501,8 @@ func TestGetNotificationHandler(t *testing.T) {
 	req.Header["Authentication"] = []string{"Bearer " + subscriberToken,}
 	req.Header["Content-Type"] = []string{"application/json",}
 	w = httptest.NewRecorder()
-	fw = functionWrapper(CreateSubscribeHandler)
-	wrappedFunc = TokenCheckMiddleware(fw)
+	fw = functionWrapper(testServer.CreateSubscribeHandler)
+	wrappedFunc = testServer.TokenCheckMiddleware(fw)
 	wrappedFunc.ServeHTTP(w, req)
 	reply = extractReply(w)
 	if reply.Code != http.StatusOK {
@@ -477,8 +518,8 @@ func TestGetNotificationHandler(t *testing.T) {
 	req.Header["Authentication"] = []string{"Bearer " + token,}
 	req.Header["Content-Type"] = []string{"application/json",}
 	w = httptest.NewRecorder()
-	createNotification := CreateNotification{}
-	wrappedFunc = TokenCheckMiddleware(createNotification)
+	createNotification := CreateNotification{testServer}
+	wrappedFunc = testServer.TokenCheckMiddleware(createNotification)
 	wrappedFunc.ServeHTTP(w, req)
 	reply = extractReply(w)
 	if reply.Code != http.StatusOK {
@@ -490,27 +531,23 @@ func TestGetNotificationHandler(t *testing.T) {
 	req.Header["Authentication"] = []string{"Bearer " + subscriberToken,}
 	req.Header["Content-Type"] = []string{"application/json",}
 	w = httptest.NewRecorder()
-	fw = functionWrapper(GetNotificationHandler)
-	wrappedFunc = TokenCheckMiddleware(fw)
+	fw = functionWrapper(testServer.GetNotificationHandler)
+	wrappedFunc = testServer.TokenCheckMiddleware(fw)
 	wrappedFunc.ServeHTTP(w, req)
 	reply = extractReply(w)
 	if reply.Code != http.StatusOK {
 		t.Fatalf("Want 200 but return %v", reply.Message)
 	}
-	infer := reply.Message.(string)
-	message, err := b64.StdEncoding.DecodeString(infer)
-	if err != nil {
-		t.Fatalf("Should succeed read base64 reply")
-	}
-	messageStruct := dba.Notifications{}
-	if err := json.Unmarshal(message, &messageStruct); err != nil {
+	message, _ := json.Marshal(reply.Message)
+	page := notificationPage{}
+	if err := json.Unmarshal(message, &page); err != nil {
 		t.Fatalf("Should be able to read message")
 	}
-	if (len(messageStruct) == 0) {
+	if (len(page.Notifications) == 0) {
 		t.Fatalf("Message should have member")
 	}
 
-	actualNotification := messageStruct[0].Message 
+	actualNotification := page.Notifications[0].Message 
 	if (actualNotification != "test 1") {
 		t.Fatalf("Message not equal to test 1")
 	}
@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	dba "github.com/humamfauzi/go-notification/database"
+)
+
+const (
+	MAX_NOTIFICATION_IDS = 500
+	DEFAULT_NOTIFICATION_LIMIT = 50
+	MAX_NOTIFICATION_LIMIT = 200
+)
+
+var errInvalidSelector = errors.New("Need exactly one of ids, before_id or all")
+
+/**
+	Which notification of the requester to touch. Exactly one is set,
+	ids list, every notification with id below before_id, or all
+*/
+type notificationSelector struct {
+	Ids []int `json:"ids"`
+	BeforeId int `json:"before_id"`
+	All bool `json:"all"`
+}
+
+func (ns notificationSelector) validate() error {
+	set := 0
+	if len(ns.Ids) != 0 {
+		set++
+	}
+	if ns.BeforeId > 0 {
+		set++
+	}
+	if ns.All {
+		set++
+	}
+	if set != 1 || len(ns.Ids) > MAX_NOTIFICATION_IDS {
+		return errInvalidSelector
+	}
+	return nil
+}
+
+// Always narrowed to the requester so other user notification is never touched
+func (ns notificationSelector) query(userId string) *dba.QueryBuilder {
+	values := make([]interface{}, len(ns.Ids))
+	for i, id := range ns.Ids {
+		values[i] = id
+	}
+	return dba.NewQueryBuilder().
+		Select(ownedNotificationColumns...).
+		Where("user_id", "=", userId).
+		In("id", values...)
+}
+
+/**
+	before_id and all can cover any number of notification so it is
+	written as one statement instead of loading every id first
+*/
+func (ns notificationSelector) userNotifications(userId string) dba.UserNotifications {
+	return dba.UserNotifications{UserId: userId, BeforeId: ns.BeforeId}
+}
+
+// Reply is already written when the selector cannot be read
+func readNotificationSelector(w http.ResponseWriter, r *http.Request) (notificationSelector, bool) {
+	selector := notificationSelector{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Read Payload", w)
+		return selector, false
+	}
+	if err := json.Unmarshal(body, &selector); err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Parse Payload", w)
+		return selector, false
+	}
+	return selector, true
+}
+
+// What the unread cache need to adjust itself
+var ownedNotificationColumns = []string{"id", "user_id", "topic_id", "is_read"}
+
+func (s *Server) ownedNotifications(qb *dba.QueryBuilder) (dba.Notifications, error) {
+	owned, err := s.Store.GetNotifications(qb)
+	if err == sql.ErrNoRows {
+		return dba.Notifications{}, nil
+	}
+	return owned, err
+}
+
+/**
+	Mark the owned unread notification as read. Another request can read
+	some of them first, then which topic lost the count is unknown so the
+	user is dropped from the unread cache instead of adjusted
+*/
+func (s *Server) readNotifications(userId string, owned dba.Notifications) (int64, error) {
+	if len(owned) == 0 {
+		return 0, nil
+	}
+	updated, err := s.Store.UpdateReadNotification(owned)
+	if err != nil {
+		return 0, err
+	}
+	if int(updated) == len(owned) {
+		s.unread.read(owned)
+	} else {
+		s.unread.forget(userId)
+	}
+	return updated, nil
+}
+
+type notificationPage struct {
+	Notifications dba.Notifications `json:"notifications"`
+	// Zero when there is no more page
+	NextCursor int `json:"next_cursor"`
+	HasMore bool `json:"has_more"`
+}
+
+/**
+	Filter of GET /notification, every one is optional. cursor is the
+	next_cursor of the previous page, created_after and created_before
+	are unix second. A filter that cannot be parsed is rejected instead
+	of ignored so a typo does not return everything
+*/
+func notificationFilter(r *http.Request, userId string) (*dba.QueryBuilder, error) {
+	query := r.URL.Query()
+	qb := dba.NewQueryBuilder().Where("user_id", "=", userId)
+	intFilters := []struct {
+		name string
+		column string
+		operator string
+	}{
+		{"cursor", "id", "<"},
+		{"topic_id", "topic_id", "="},
+		{"created_after", "created_at", ">="},
+		{"created_before", "created_at", "<"},
+	}
+	for _, filter := range intFilters {
+		value := query.Get(filter.name)
+		if len(value) == 0 {
+			continue
+		}
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || number < 0 {
+			return nil, fmt.Errorf("Invalid %v", filter.name)
+		}
+		qb.Where(filter.column, filter.operator, number)
+	}
+	if value := query.Get("is_read"); len(value) != 0 {
+		isRead, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("Invalid is_read")
+		}
+		qb.Where("is_read", "=", isRead)
+	}
+	return qb, nil
+}
+
+type notificationCountReply struct {
+	Count int `json:"count"`
+}
+
+// Reply with how many notification of the requester is marked
+func (s *Server) ReadNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	requester, err := getRequesterProfile(r)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
+	}
+	selector, ok := readNotificationSelector(w, r)
+	if !ok {
+		return
+	}
+	if err := selector.validate(); err != nil {
+		WriteReply(int(http.StatusBadRequest), false, err.Error(), w)
+		return
+	}
+	if len(selector.Ids) == 0 {
+		updated, err := s.Store.UpdateReadUserNotifications(selector.userNotifications(requester.Id))
+		if err != nil {
+			s.Logger.Println(err)
+			WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+			return
+		}
+		if updated != 0 {
+			s.unread.forget(requester.Id)
+		}
+		WriteReply(int(http.StatusOK), true, notificationCountReply{int(updated)}, w)
+		return
+	}
+	owned, err := s.ownedNotifications(selector.query(requester.Id).Where("is_read", "=", false))
+	if err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	updated, err := s.readNotifications(requester.Id, owned)
+	if err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	WriteReply(int(http.StatusOK), true, notificationCountReply{int(updated)}, w)
+	return
+}
+
+// Bulk delete, same selector as read
+func (s *Server) DeleteNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	requester, err := getRequesterProfile(r)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
+	}
+	selector, ok := readNotificationSelector(w, r)
+	if !ok {
+		return
+	}
+	if err := selector.validate(); err != nil {
+		WriteReply(int(http.StatusBadRequest), false, err.Error(), w)
+		return
+	}
+	if len(selector.Ids) == 0 {
+		deleted, err := s.Store.DeleteUserNotifications(selector.userNotifications(requester.Id))
+		if err != nil {
+			s.Logger.Println(err)
+			WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+			return
+		}
+		if deleted != 0 {
+			s.unread.forget(requester.Id)
+		}
+		WriteReply(int(http.StatusOK), true, notificationCountReply{int(deleted)}, w)
+		return
+	}
+	owned, err := s.ownedNotifications(selector.query(requester.Id))
+	if err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	if err := s.Store.DeleteNotifications(owned); err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	s.unread.deleted(owned)
+	WriteReply(int(http.StatusOK), true, notificationCountReply{len(owned)}, w)
+	return
+}
+
+// Notification of another user look the same as a missing one
+func (s *Server) DeleteNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	requester, err := getRequesterProfile(r)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
+	}
+	notificationId, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Invalid Notification Id", w)
+		return
+	}
+	qb := dba.NewQueryBuilder().
+		Select(ownedNotificationColumns...).
+		Where("user_id", "=", requester.Id).
+		Where("id", "=", notificationId)
+	owned, err := s.ownedNotifications(qb)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	if len(owned) == 0 {
+		WriteReply(int(http.StatusNotFound), false, "Notification Not Found", w)
+		return
+	}
+	if err := s.Store.DeleteNotifications(owned); err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	s.unread.deleted(owned)
+	WriteReply(int(http.StatusOK), true, nil, w)
+	return
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"net/http"
+
+	dba "github.com/humamfauzi/go-notification/database"
+	"github.com/humamfauzi/go-notification/utils"
+)
+
+func countNotification(server *Server, qb *dba.QueryBuilder) int {
+	notifications, err := server.Store.GetNotifications(qb)
+	if err != nil {
+		return 0
+	}
+	return len(notifications)
+}
+
+func TestInbox(t *testing.T) {
+	randName := utils.RandomStringId("", 10)
+	owner, ownerToken := createUserOn(t, testServer, fmt.Sprintf("owner%v@asd.asd", randName), "rahasia")
+	user, userToken := createUserOn(t, testServer, fmt.Sprintf("inbox%v@asd.asd", randName), "rahasia")
+	topicId := createTopicOn(t, testServer, owner, ownerToken)
+	for _, token := range []string{ownerToken, userToken} {
+		if reply := serveRoute(testServer, http.MethodPost, "/subscribe", fmt.Sprintf(`{"topic_id": %d}`, topicId), token); reply.Code != http.StatusOK {
+			t.Fatalf("want 200 get %v", reply)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		notification := fmt.Sprintf(`{"topic_id": %d, "message": "hello %d"}`, topicId, i)
+		if reply := serveRoute(testServer, http.MethodPost, "/notification", notification, ownerToken); reply.Code != http.StatusOK {
+			t.Fatalf("want 200 get %v", reply)
+		}
+	}
+	qb := dba.NewQueryBuilder().Where("user_id", "=", user.Id).OrderBy("id", dba.ORDER_ASC)
+	inbox, err := testServer.Store.GetNotifications(qb)
+	if err != nil || len(inbox) != 4 {
+		t.Fatalf("want 4 notification get %v %v", inbox, err)
+	}
+	others, _ := testServer.Store.GetNotifications(dba.NewQueryBuilder().Where("user_id", "=", owner.Id))
+	unread := func(userId string) int {
+		return countNotification(testServer, dba.NewQueryBuilder().Where("user_id", "=", userId).Where("is_read", "=", false))
+	}
+
+	if reply := serveRoute(testServer, http.MethodPost, "/notification/read", `{"ids": [1], "all": true}`, userToken); reply.Code != http.StatusBadRequest {
+		t.Fatalf("want %v get %v", http.StatusBadRequest, reply)
+	}
+	// id of another user is ignored
+	read := fmt.Sprintf(`{"ids": [%d, %d]}`, inbox[0].Id, others[0].Id)
+	reply := serveRoute(testServer, http.MethodPost, "/notification/read", read, userToken)
+	if reply.Code != http.StatusOK || reply.Message.(map[string]interface{})["count"].(float64) != 1 {
+		t.Fatalf("want one marked get %v", reply)
+	}
+	if unread(owner.Id) != 4 || unread(user.Id) != 3 {
+		t.Fatalf("want 4 and 3 unread get %v and %v", unread(owner.Id), unread(user.Id))
+	}
+	read = fmt.Sprintf(`{"before_id": %d}`, inbox[2].Id)
+	if reply := serveRoute(testServer, http.MethodPost, "/notification/read", read, userToken); reply.Message.(map[string]interface{})["count"].(float64) != 1 {
+		t.Fatalf("want one marked get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, "/notification/read", `{"all": true}`, userToken); reply.Message.(map[string]interface{})["count"].(float64) != 2 {
+		t.Fatalf("want two marked get %v", reply)
+	}
+	if unread(owner.Id) != 4 || unread(user.Id) != 0 {
+		t.Fatalf("want 4 and 0 unread get %v and %v", unread(owner.Id), unread(user.Id))
+	}
+
+	if reply := serveRoute(testServer, http.MethodDelete, fmt.Sprintf("/notification/%d", others[0].Id), "", userToken); reply.Code != http.StatusNotFound {
+		t.Fatalf("want %v get %v", http.StatusNotFound, reply)
+	}
+	if reply := serveRoute(testServer, http.MethodDelete, fmt.Sprintf("/notification/%d", inbox[0].Id), "", userToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	remove := fmt.Sprintf(`{"ids": [%d, %d, %d]}`, inbox[0].Id, inbox[1].Id, others[1].Id)
+	if reply := serveRoute(testServer, http.MethodDelete, "/notification", remove, userToken); reply.Message.(map[string]interface{})["count"].(float64) != 1 {
+		t.Fatalf("want one deleted get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodDelete, "/notification", `{"all": true}`, userToken); reply.Message.(map[string]interface{})["count"].(float64) != 2 {
+		t.Fatalf("want two deleted get %v", reply)
+	}
+	userInbox := dba.NewQueryBuilder().Where("user_id", "=", user.Id)
+	ownerInbox := dba.NewQueryBuilder().Where("user_id", "=", owner.Id)
+	if countNotification(testServer, userInbox) != 0 || countNotification(testServer, ownerInbox) != 4 {
+		t.Fatalf("only the requester inbox should be cleared")
+	}
+}
+
+// createTopicOn always return the first topic of the owner
+func createTopicsOn(t *testing.T, server *Server, owner dba.UserProfile, token string, count int) []int {
+	for i := 0; i < count; i++ {
+		createTopicOn(t, server, owner, token)
+	}
+	topics, err := server.Store.GetTopics(dba.NewQueryBuilder().Where("user_id", "=", owner.Id).OrderBy("id", dba.ORDER_ASC))
+	if err != nil || len(topics) != count {
+		t.Fatalf("want %d topic get %v %v", count, topics, err)
+	}
+	topicIds := make([]int, count)
+	for i, topic := range topics {
+		topicIds[i] = topic.Id
+	}
+	return topicIds
+}
+
+func getNotificationPage(t *testing.T, path, token string) notificationPage {
+	reply := serveRoute(testServer, http.MethodGet, path, "", token)
+	if reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	message, _ := json.Marshal(reply.Message)
+	page := notificationPage{}
+	if err := json.Unmarshal(message, &page); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	return page
+}
+
+func TestNotificationPage(t *testing.T) {
+	randName := utils.RandomStringId("", 10)
+	owner, ownerToken := createUserOn(t, testServer, fmt.Sprintf("owner%v@asd.asd", randName), "rahasia")
+	user, userToken := createUserOn(t, testServer, fmt.Sprintf("page%v@asd.asd", randName), "rahasia")
+	topicIds := createTopicsOn(t, testServer, owner, ownerToken, 2)
+	for i, topicId := range topicIds {
+		if reply := serveRoute(testServer, http.MethodPost, "/subscribe", fmt.Sprintf(`{"topic_id": %d}`, topicId), userToken); reply.Code != http.StatusOK {
+			t.Fatalf("want 200 get %v", reply)
+		}
+		for j := 0; j < 3-i; j++ {
+			notification := fmt.Sprintf(`{"topic_id": %d, "message": "hello %d"}`, topicId, j)
+			if reply := serveRoute(testServer, http.MethodPost, "/notification", notification, ownerToken); reply.Code != http.StatusOK {
+				t.Fatalf("want 200 get %v", reply)
+			}
+		}
+	}
+
+	// Follow the cursor until the last page, newest come first
+	collected := dba.Notifications{}
+	path := "/notification?limit=2"
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("want 3 pages get more")
+		}
+		page := getNotificationPage(t, path, userToken)
+		collected = append(collected, page.Notifications...)
+		if !page.HasMore {
+			if page.NextCursor != 0 || len(page.Notifications) != 1 {
+				t.Fatalf("want last page with one notification get %v", page)
+			}
+			break
+		}
+		if len(page.Notifications) != 2 || page.NextCursor != page.Notifications[1].Id {
+			t.Fatalf("want 2 notification and cursor of the last get %v", page)
+		}
+		path = fmt.Sprintf("/notification?limit=2&cursor=%d", page.NextCursor)
+	}
+	if len(collected) != 5 {
+		t.Fatalf("want 5 get %v", len(collected))
+	}
+	for i := 1; i < len(collected); i++ {
+		if collected[i].Id >= collected[i-1].Id || collected[i].UserId != user.Id {
+			t.Fatalf("want newest first of the requester get %v", collected)
+		}
+	}
+	if collected[0].CreatedAt == 0 {
+		t.Fatalf("created_at should be set")
+	}
+
+	page := getNotificationPage(t, fmt.Sprintf("/notification?topic_id=%d", topicIds[1]), userToken)
+	if len(page.Notifications) != 2 || page.HasMore {
+		t.Fatalf("want 2 notification of the topic get %v", page)
+	}
+	read := fmt.Sprintf(`{"ids": [%d]}`, collected[0].Id)
+	if reply := serveRoute(testServer, http.MethodPost, "/notification/read", read, userToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if page := getNotificationPage(t, "/notification?is_read=false", userToken); len(page.Notifications) != 4 {
+		t.Fatalf("want 4 unread get %v", page)
+	}
+	if page := getNotificationPage(t, "/notification?is_read=true", userToken); len(page.Notifications) != 1 || page.Notifications[0].Id != collected[0].Id {
+		t.Fatalf("want 1 read get %v", page)
+	}
+	createdAt := collected[0].CreatedAt
+	if page := getNotificationPage(t, fmt.Sprintf("/notification?created_after=%d", createdAt+3600), userToken); page.Notifications == nil || len(page.Notifications) != 0 {
+		t.Fatalf("want empty list get %v", page)
+	}
+	if page := getNotificationPage(t, fmt.Sprintf("/notification?created_after=%d&created_before=%d", createdAt-3600, createdAt+3600), userToken); len(page.Notifications) != 5 {
+		t.Fatalf("want 5 get %v", page)
+	}
+	for _, path := range []string{"/notification?cursor=abc", "/notification?is_read=maybe", "/notification?created_after=-1"} {
+		if reply := serveRoute(testServer, http.MethodGet, path, "", userToken); reply.Code != http.StatusBadRequest {
+			t.Fatalf("want %v get %v for %v", http.StatusBadRequest, reply, path)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	dba "github.com/humamfauzi/go-notification/database"
+)
+
+const (
+	DEFAULT_AUDIT_LOG_LIMIT = 50
+	MAX_AUDIT_LOG_LIMIT = 500
+)
+
+func topicTarget(topicId int) string {
+	return "topic/" + strconv.Itoa(topicId)
+}
+
+/**
+	Append to the audit trail. Failing to write it should not fail
+	the request that is being audited so it is only logged
+*/
+func (s *Server) audit(userId, action, target, detail string) {
+	auditLog := dba.AuditLog{
+		UserId: userId,
+		Action: action,
+		Target: target,
+		Detail: detail,
+		CreatedAt: time.Now().Unix(),
+	}
+	if _, err := s.Store.InsertAuditLog(auditLog); err != nil {
+		s.Logger.Println("AUDIT NOT RECORDED", userId, action, target, err)
+	}
+}
+
+/**
+	A user that is not a member can subscribe to a public or unlisted
+	topic. Private topic give it no role, it need to request first
+*/
+func nonMemberTopicRole(topic dba.Topic) string {
+	if topic.Visibility == dba.TOPIC_VISIBILITY_PRIVATE {
+		return ""
+	}
+	return dba.TOPIC_ROLE_SUBSCRIBER
+}
+
+func (s *Server) findTopicMember(topicId int, userId string) (dba.TopicMember, error) {
+	qb := dba.NewQueryBuilder().
+		Where("topic_id", "=", topicId).
+		Where("user_id", "=", userId)
+	topicMembers, err := s.Store.GetTopicMembers(qb)
+	if err != nil {
+		return dba.TopicMember{}, err
+	}
+	return topicMembers[0], nil
+}
+
+/**
+	Role of the user on the topic, empty when it has none. sql.ErrNoRows
+	when the topic does not exist or is deleted
+*/
+func (s *Server) TopicRole(userId string, topicId int) (string, error) {
+	qb := dba.NewQueryBuilder().
+		Select("id", "visibility").
+		Where("id", "=", topicId).
+		Where("deleted_at", "=", 0)
+	topics, err := s.Store.GetTopics(qb)
+	if err != nil {
+		return "", err
+	}
+	topicMember, err := s.findTopicMember(topicId, userId)
+	if err == sql.ErrNoRows {
+		return nonMemberTopicRole(topics[0]), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return topicMember.Role, nil
+}
+
+/**
+	Role is only checked when the subscription is made. After a member is
+	removed or demoted, or the topic turn private, subscriber whose role
+	is now below subscriber is removed so it stop receiving the topic.
+	Empty userId check every subscriber of the topic
+*/
+func (s *Server) revalidateSubscriptions(topicId int, userId string) error {
+	qb := dba.NewQueryBuilder().Select("id", "user_id").Where("topic_id", "=", topicId)
+	if len(userId) != 0 {
+		qb.Where("user_id", "=", userId)
+	}
+	subscribers, err := s.Store.GetSubscribers(qb)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	topics, err := s.Store.GetTopics(dba.NewQueryBuilder().Select("id", "visibility").Where("id", "=", topicId))
+	if err != nil {
+		return err
+	}
+	topicMembers, err := s.Store.GetTopicMembers(dba.NewQueryBuilder().Where("topic_id", "=", topicId))
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	roles := make(map[string]string, len(topicMembers))
+	for _, topicMember := range topicMembers {
+		roles[topicMember.UserId] = topicMember.Role
+	}
+	for _, subscriber := range subscribers {
+		role, ok := roles[subscriber.UserId]
+		if !ok {
+			role = nonMemberTopicRole(topics[0])
+		}
+		if dba.TopicRoleAtLeast(role, dba.TOPIC_ROLE_SUBSCRIBER) {
+			continue
+		}
+		if err := s.Store.DeleteSubscriber(subscriber); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+	Resolve the topic in the path and the requester role on it. Site admin
+	manage every topic as if it is the owner. Reply is already written
+	when the role is below required
+*/
+func (s *Server) topicRequester(w http.ResponseWriter, r *http.Request, required string) (dba.UserProfile, int, string, bool) {
+	requester, err := getRequesterProfile(r)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return requester, 0, "", false
+	}
+	topicId, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Invalid Topic Id", w)
+		return requester, 0, "", false
+	}
+	role, err := s.TopicRole(requester.Id, topicId)
+	if err != nil {
+		WriteReply(int(http.StatusNotFound), false, "Topic Not Found", w)
+		return requester, topicId, "", false
+	}
+	if requester.Role == dba.USER_ROLE_ADMIN {
+		role = dba.TOPIC_ROLE_OWNER
+	}
+	if !dba.TopicRoleAtLeast(role, required) {
+		s.deniedMember(requester.Id, topicId, r.Method + " as " + role, w)
+		return requester, topicId, role, false
+	}
+	return requester, topicId, role, true
+}
+
+func (s *Server) deniedMember(userId string, topicId int, detail string, w http.ResponseWriter) {
+	s.audit(userId, dba.AUDIT_MEMBER_DENIED, topicTarget(topicId), detail)
+	WriteReply(int(http.StatusForbidden), false, "Not Allowed on Topic", w)
+}
+
+// Member can only hand out, or take away, a role below its own
+func roleBelow(role, requesterRole string) bool {
+	return !dba.TopicRoleAtLeast(role, requesterRole)
+}
+
+/**
+	Only real member see who else is in the topic. Non member of a public
+	topic count as subscriber on TopicRole so it is checked separately,
+	site admin is already owner there
+*/
+func (s *Server) GetMemberHandler(w http.ResponseWriter, r *http.Request) {
+	requester, topicId, role, ok := s.topicRequester(w, r, dba.TOPIC_ROLE_VIEWER)
+	if !ok {
+		return
+	}
+	if !dba.TopicRoleAtLeast(role, dba.TOPIC_ROLE_ADMIN) {
+		if _, err := s.findTopicMember(topicId, requester.Id); err != nil {
+			s.deniedMember(requester.Id, topicId, "list members as non member", w)
+			return
+		}
+	}
+	qb := dba.NewQueryBuilder().
+		Where("topic_id", "=", topicId).
+		OrderBy("id", dba.ORDER_ASC)
+	topicMembers, err := s.Store.GetTopicMembers(qb)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	WriteReply(int(http.StatusOK), true, topicMembers, w)
+	return
+}
+
+func (s *Server) AddMemberHandler(w http.ResponseWriter, r *http.Request) {
+	requester, topicId, requesterRole, ok := s.topicRequester(w, r, dba.TOPIC_ROLE_ADMIN)
+	if !ok {
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Read Payload", w)
+		return
+	}
+	topicMember := dba.TopicMember{}
+	if err := json.Unmarshal(body, &topicMember); err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Parse Payload", w)
+		return
+	}
+	if !dba.IsTopicRole(topicMember.Role) {
+		WriteReply(int(http.StatusBadRequest), false, "Unknown Role", w)
+		return
+	}
+	if !roleBelow(topicMember.Role, requesterRole) {
+		s.deniedMember(requester.Id, topicId, "add " + topicMember.Role, w)
+		return
+	}
+	qb := dba.NewQueryBuilder().Select("id").Where("id", "=", topicMember.UserId)
+	if _, err := s.Store.FindUser(qb); err != nil {
+		WriteReply(int(http.StatusNotFound), false, "User Not Found", w)
+		return
+	}
+	if _, err := s.findTopicMember(topicId, topicMember.UserId); err == nil {
+		WriteReply(int(http.StatusConflict), false, "Already Member", w)
+		return
+	}
+	topicMember.TopicId = topicId
+	topicMember.InvitedBy = requester.Id
+	topicMember.CreatedAt = time.Now().Unix()
+	if _, err := s.Store.InsertTopicMember(topicMember); err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	s.audit(requester.Id, dba.AUDIT_MEMBER_ADDED, topicTarget(topicId), topicMember.UserId + " " + topicMember.Role)
+	WriteReply(int(http.StatusOK), true, nil, w)
+	return
+}
+
+func (s *Server) UpdateMemberHandler(w http.ResponseWriter, r *http.Request) {
+	requester, topicId, requesterRole, ok := s.topicRequester(w, r, dba.TOPIC_ROLE_ADMIN)
+	if !ok {
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Read Payload", w)
+		return
+	}
+	changed := dba.TopicMember{}
+	if err := json.Unmarshal(body, &changed); err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Parse Payload", w)
+		return
+	}
+	if !dba.IsTopicRole(changed.Role) {
+		WriteReply(int(http.StatusBadRequest), false, "Unknown Role", w)
+		return
+	}
+	topicMember, err := s.findTopicMember(topicId, mux.Vars(r)["userId"])
+	if err != nil {
+		WriteReply(int(http.StatusNotFound), false, "Member Not Found", w)
+		return
+	}
+	// owner is only changed through transfer
+	if !roleBelow(topicMember.Role, requesterRole) || !roleBelow(changed.Role, requesterRole) {
+		s.deniedMember(requester.Id, topicId, topicMember.Role + " to " + changed.Role, w)
+		return
+	}
+	detail := topicMember.UserId + " " + topicMember.Role + " to " + changed.Role
+	topicMember.Role = changed.Role
+	if err := s.Store.UpdateTopicMemberRole(topicMember); err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	if err := s.revalidateSubscriptions(topicId, topicMember.UserId); err != nil {
+		s.Logger.Println("SUBSCRIPTION NOT REVALIDATED", topicId, topicMember.UserId, err)
+	}
+	s.audit(requester.Id, dba.AUDIT_MEMBER_ROLE_CHANGED, topicTarget(topicId), detail)
+	WriteReply(int(http.StatusOK), true, nil, w)
+	return
+}
+
+// Member can always leave, except the owner which need to transfer first
+func (s *Server) RemoveMemberHandler(w http.ResponseWriter, r *http.Request) {
+	requester, topicId, requesterRole, ok := s.topicRequester(w, r, dba.TOPIC_ROLE_VIEWER)
+	if !ok {
+		return
+	}
+	topicMember, err := s.findTopicMember(topicId, mux.Vars(r)["userId"])
+	if err != nil {
+		WriteReply(int(http.StatusNotFound), false, "Member Not Found", w)
+		return
+	}
+	leaving := topicMember.UserId == requester.Id && topicMember.Role != dba.TOPIC_ROLE_OWNER
+	managing := dba.TopicRoleAtLeast(requesterRole, dba.TOPIC_ROLE_ADMIN) && roleBelow(topicMember.Role, requesterRole)
+	if !leaving && !managing {
+		s.deniedMember(requester.Id, topicId, "remove " + topicMember.Role, w)
+		return
+	}
+	if err := s.Store.DeleteTopicMember(topicMember); err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	if err := s.revalidateSubscriptions(topicId, topicMember.UserId); err != nil {
+		s.Logger.Println("SUBSCRIPTION NOT REVALIDATED", topicId, topicMember.UserId, err)
+	}
+	s.audit(requester.Id, dba.AUDIT_MEMBER_REMOVED, topicTarget(topicId), topicMember.UserId + " " + topicMember.Role)
+	WriteReply(int(http.StatusOK), true, nil, w)
+	return
+}
+
+// Only the owner itself can give the topic away, to an existing member
+func (s *Server) TransferTopicHandler(w http.ResponseWriter, r *http.Request) {
+	requester, topicId, _, ok := s.topicRequester(w, r, dba.TOPIC_ROLE_VIEWER)
+	if !ok {
+		return
+	}
+	owner, err := s.findTopicMember(topicId, requester.Id)
+	if err != nil || owner.Role != dba.TOPIC_ROLE_OWNER {
+		s.deniedMember(requester.Id, topicId, "transfer", w)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Read Payload", w)
+		return
+	}
+	target := dba.TopicMember{}
+	if err := json.Unmarshal(body, &target); err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Parse Payload", w)
+		return
+	}
+	if target.UserId == requester.Id {
+		WriteReply(int(http.StatusBadRequest), false, "Already Owner", w)
+		return
+	}
+	if _, err := s.findTopicMember(topicId, target.UserId); err != nil {
+		WriteReply(int(http.StatusNotFound), false, "Member Not Found", w)
+		return
+	}
+	if err := s.Store.TransferTopicOwnership(topicId, requester.Id, target.UserId); err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	s.audit(requester.Id, dba.AUDIT_OWNERSHIP_TRANSFERRED, topicTarget(topicId), target.UserId)
+	WriteReply(int(http.StatusOK), true, nil, w)
+	return
+}
+
+// Newest first, can be narrowed with user_id and action
+func (s *Server) GetAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	limit := queryInt(r, "limit", DEFAULT_AUDIT_LOG_LIMIT, MAX_AUDIT_LOG_LIMIT)
+	offset := queryInt(r, "offset", 0, 0)
+	qb := dba.NewQueryBuilder()
+	if userId := r.URL.Query().Get("user_id"); len(userId) != 0 {
+		qb.Where("user_id", "=", userId)
+	}
+	if action := r.URL.Query().Get("action"); len(action) != 0 {
+		qb.Where("action", "=", action)
+	}
+	qb.OrderBy("id", dba.ORDER_DESC).Limit(limit).Offset(offset)
+	auditLogs, err := s.Store.GetAuditLogs(qb)
+	if err == sql.ErrNoRows {
+		WriteReply(int(http.StatusOK), true, dba.AuditLogs{}, w)
+		return
+	}
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	WriteReply(int(http.StatusOK), true, auditLogs, w)
+	return
+}
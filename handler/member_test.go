@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"fmt"
+	"testing"
+	"net/http"
+
+	dba "github.com/humamfauzi/go-notification/database"
+	"github.com/humamfauzi/go-notification/utils"
+)
+
+func createTopicOn(t *testing.T, server *Server, owner dba.UserProfile, token string) int {
+	if reply := serveRoute(server, http.MethodPost, "/topics", `{"title": "member topic"}`, token); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	topics, err := server.Store.GetTopics(dba.NewQueryBuilder().Where("user_id", "=", owner.Id))
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	return topics[0].Id
+}
+
+func TestTopicMember(t *testing.T) {
+	randName := utils.RandomStringId("", 10)
+	owner, ownerToken := createUserOn(t, testServer, fmt.Sprintf("owner%v@asd.asd", randName), "rahasia")
+	member, memberToken := createUserOn(t, testServer, fmt.Sprintf("member%v@asd.asd", randName), "rahasia")
+	topicId := createTopicOn(t, testServer, owner, ownerToken)
+
+	notification := fmt.Sprintf(`{"topic_id": %d, "message": "hello"}`, topicId)
+	members := fmt.Sprintf("/topics/%d/members", topicId)
+	memberPath := members + "/" + member.Id
+	invite := func(role string) string {
+		return fmt.Sprintf(`{"user_id": "%v", "role": "%v"}`, member.Id, role)
+	}
+
+	// publishing need at least one subscriber
+	subscribe := fmt.Sprintf(`{"topic_id": %d}`, topicId)
+	if reply := serveRoute(testServer, http.MethodPost, "/subscribe", subscribe, memberToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, "/notification", notification, memberToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("want %v get %v", http.StatusForbidden, reply)
+	}
+	qb := dba.NewQueryBuilder().
+		Where("user_id", "=", member.Id).
+		Where("action", "=", dba.AUDIT_PUBLISH_DENIED)
+	auditLogs, err := testServer.Store.GetAuditLogs(qb)
+	if err != nil {
+		t.Fatalf("denied publish should be audited get %v", err)
+	}
+	if auditLogs[0].Target != topicTarget(topicId) {
+		t.Fatalf("want %v get %v", topicTarget(topicId), auditLogs[0].Target)
+	}
+
+	// subscriber of a public topic is not a member, it cannot list them
+	if reply := serveRoute(testServer, http.MethodGet, members, "", memberToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("want %v get %v", http.StatusForbidden, reply)
+	}
+
+	// non member cannot invite and nobody can invite a second owner
+	if reply := serveRoute(testServer, http.MethodPost, members, invite(dba.TOPIC_ROLE_VIEWER), memberToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("want %v get %v", http.StatusForbidden, reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, members, invite(dba.TOPIC_ROLE_OWNER), ownerToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("want %v get %v", http.StatusForbidden, reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, members, invite("superuser"), ownerToken); reply.Code != http.StatusBadRequest {
+		t.Fatalf("want %v get %v", http.StatusBadRequest, reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, members, invite(dba.TOPIC_ROLE_PUBLISHER), ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, members, invite(dba.TOPIC_ROLE_PUBLISHER), ownerToken); reply.Code != http.StatusConflict {
+		t.Fatalf("want %v get %v", http.StatusConflict, reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, members, `{"user_id": "user/unknown", "role": "viewer"}`, ownerToken); reply.Code != http.StatusNotFound {
+		t.Fatalf("want %v get %v", http.StatusNotFound, reply)
+	}
+	reply := serveRoute(testServer, http.MethodGet, members, "", memberToken)
+	if reply.Code != http.StatusOK || len(reply.Message.([]interface{})) != 2 {
+		t.Fatalf("want owner and member get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, "/notification", notification, memberToken); reply.Code != http.StatusOK {
+		t.Fatalf("publisher should publish get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodGet, "/topics", "", memberToken); reply.Code != http.StatusOK {
+		t.Fatalf("member should list the topic get %v", reply)
+	}
+
+	// viewer can neither publish nor subscribe
+	if reply := serveRoute(testServer, http.MethodPatch, memberPath, `{"role": "viewer"}`, ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, "/notification", notification, memberToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("viewer should not publish get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, "/subscribe", subscribe, memberToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("viewer should not subscribe get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPatch, memberPath, `{"role": "admin"}`, memberToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("viewer should not promote itself get %v", reply)
+	}
+
+	// owner become admin after transfer and cannot touch the new owner
+	transfer := fmt.Sprintf("/topics/%d/transfer", topicId)
+	if reply := serveRoute(testServer, http.MethodPost, transfer, fmt.Sprintf(`{"user_id": "%v"}`, owner.Id), memberToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("want %v get %v", http.StatusForbidden, reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, transfer, fmt.Sprintf(`{"user_id": "%v"}`, member.Id), ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	topics, _ := testServer.Store.GetTopics(dba.NewQueryBuilder().Where("id", "=", topicId))
+	if topics[0].UserId != member.Id {
+		t.Fatalf("want %v get %v", member.Id, topics[0].UserId)
+	}
+	if reply := serveRoute(testServer, http.MethodDelete, memberPath, "", ownerToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("admin should not remove the owner get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodDelete, memberPath, "", memberToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("owner should not leave get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodDelete, members + "/" + owner.Id, "", ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("admin should leave get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodDelete, members + "/" + owner.Id, "", memberToken); reply.Code != http.StatusNotFound {
+		t.Fatalf("want %v get %v", http.StatusNotFound, reply)
+	}
+	qb = dba.NewQueryBuilder().
+		Where("action", "=", dba.AUDIT_OWNERSHIP_TRANSFERRED).
+		Where("target", "=", topicTarget(topicId))
+	if _, err := testServer.Store.GetAuditLogs(qb); err != nil {
+		t.Fatalf("transfer should be audited get %v", err)
+	}
+}
+
+func TestAuditLogRoute(t *testing.T) {
+	server := NewServer(dba.NewMemoryStore())
+	user, token := createUserOn(t, server, "auditor@asd.asd", "rahasia")
+	server.audit(user.Id, dba.AUDIT_PUBLISH_DENIED, topicTarget(1), "")
+	if reply := serveRoute(server, http.MethodGet, "/audit", "", token); reply.Code != http.StatusForbidden {
+		t.Fatalf("want %v get %v", http.StatusForbidden, reply)
+	}
+	user.Role = dba.USER_ROLE_ADMIN
+	if err := server.Store.UpdateUser(user, []string{"role"}); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	reply := serveRoute(server, http.MethodGet, "/audit?action=" + dba.AUDIT_PUBLISH_DENIED, "", token)
+	if reply.Code != http.StatusOK || len(reply.Message.([]interface{})) != 1 {
+		t.Fatalf("want one audit log get %v", reply)
+	}
+}
+
+func TestSubscriptionRevalidated(t *testing.T) {
+	randName := utils.RandomStringId("", 10)
+	owner, ownerToken := createUserOn(t, testServer, fmt.Sprintf("owner%v@asd.asd", randName), "rahasia")
+	member, memberToken := createUserOn(t, testServer, fmt.Sprintf("member%v@asd.asd", randName), "rahasia")
+	outsider, outsiderToken := createUserOn(t, testServer, fmt.Sprintf("outsider%v@asd.asd", randName), "rahasia")
+	topicId := createTopicOn(t, testServer, owner, ownerToken)
+	memberPath := fmt.Sprintf("/topics/%d/members/%v", topicId, member.Id)
+	subscribe := func(token string) {
+		if reply := serveRoute(testServer, http.MethodPost, "/subscribe", fmt.Sprintf(`{"topic_id": %d}`, topicId), token); reply.Code != http.StatusOK {
+			t.Fatalf("want 200 get %v", reply)
+		}
+	}
+	subscribed := func(userId string) bool {
+		qb := dba.NewQueryBuilder().Where("topic_id", "=", topicId).Where("user_id", "=", userId)
+		_, err := testServer.Store.GetSubscribers(qb)
+		return err == nil
+	}
+	changeRole := func(role string) {
+		if reply := serveRoute(testServer, http.MethodPatch, memberPath, fmt.Sprintf(`{"role": "%v"}`, role), ownerToken); reply.Code != http.StatusOK {
+			t.Fatalf("want 200 get %v", reply)
+		}
+	}
+
+	invite := fmt.Sprintf(`{"user_id": "%v", "role": "%v"}`, member.Id, dba.TOPIC_ROLE_SUBSCRIBER)
+	if reply := serveRoute(testServer, http.MethodPost, fmt.Sprintf("/topics/%d/members", topicId), invite, ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	subscribe(memberToken)
+	subscribe(outsiderToken)
+
+	// demoted to viewer cannot subscribe so it lose the subscription
+	changeRole(dba.TOPIC_ROLE_VIEWER)
+	if subscribed(member.Id) || !subscribed(outsider.Id) {
+		t.Fatalf("want only the viewer unsubscribed get %v %v", subscribed(member.Id), subscribed(outsider.Id))
+	}
+	changeRole(dba.TOPIC_ROLE_SUBSCRIBER)
+	subscribe(memberToken)
+
+	// non member subscribed while the topic was public
+	if reply := serveRoute(testServer, http.MethodPatch, fmt.Sprintf("/topics/%d", topicId), `{"visibility": "private"}`, ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if subscribed(outsider.Id) || !subscribed(member.Id) {
+		t.Fatalf("want only the outsider unsubscribed get %v %v", subscribed(outsider.Id), subscribed(member.Id))
+	}
+
+	// removed member of a private topic has no role left
+	if reply := serveRoute(testServer, http.MethodDelete, memberPath, "", ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if subscribed(member.Id) {
+		t.Fatalf("removed member should be unsubscribed")
+	}
+}
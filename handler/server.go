@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/humamfauzi/go-notification/auth"
+	"github.com/humamfauzi/go-notification/broker"
+	dba "github.com/humamfauzi/go-notification/database"
+	"github.com/humamfauzi/go-notification/queue"
+	"github.com/humamfauzi/go-notification/webhook"
+)
+
+const (
+	DEFAULT_TOKEN_EXPIRY = 15 * time.Minute
+	DEFAULT_REFRESH_TOKEN_EXPIRY = 30 * 24 * time.Hour
+)
+
+type Config struct {
+	// How long a login JWT is valid
+	TokenExpiry time.Duration
+	// How long a refresh token is valid, each rotation start it again
+	RefreshTokenExpiry time.Duration
+	// Buffer of every live stream subscription
+	StreamBufferSize int
+	DeadLetterLimit int
+	MaxDeadLetterLimit int
+	// Page size of GET /notification
+	NotificationLimit int
+	MaxNotificationLimit int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		TokenExpiry: DEFAULT_TOKEN_EXPIRY,
+		RefreshTokenExpiry: DEFAULT_REFRESH_TOKEN_EXPIRY,
+		StreamBufferSize: streamBufferSize,
+		DeadLetterLimit: DEFAULT_DEAD_LETTER_LIMIT,
+		MaxDeadLetterLimit: MAX_DEAD_LETTER_LIMIT,
+		NotificationLimit: DEFAULT_NOTIFICATION_LIMIT,
+		MaxNotificationLimit: MAX_NOTIFICATION_LIMIT,
+	}
+}
+
+/**
+	Server hold everything a handler need, nothing is shared through
+	package variable so several Server can run in one process, e.g one per
+	tenant or one per test. The only thing shared is the query map since
+	it is loaded once per process by the database package
+
+	DB is only needed by the delivery queue, a Server without DB still
+	serve every route but webhook job is never delivered
+*/
+type Server struct {
+	Store dba.Store
+	DB dba.ITransactionSQL
+	// Sign every JWT, the public keys are served as JWKS
+	Keys *auth.KeySet
+	Config Config
+	Logger *log.Logger
+
+	broker *broker.Broker
+	deliveryQueue *queue.Queue
+	webhookSender *webhook.Sender
+	unread *unreadCache
+}
+
+func NewServer(store dba.Store) *Server {
+	return &Server{
+		Store: store,
+		Keys: auth.NewSecretKeySet(auth.GetAuthSecret()),
+		Config: DefaultConfig(),
+		Logger: log.New(os.Stderr, "", log.LstdFlags),
+		broker: broker.NewBroker(),
+		webhookSender: webhook.NewSender(),
+		unread: newUnreadCache(UNREAD_CACHE_SIZE, UNREAD_CACHE_TTL),
+	}
+}
+
+/**
+	Connect the database and load the query map of its dialect from
+	queryMapDirectory. The connection is not wrapped in a store so the
+	caller can still run migration on it first
+*/
+func ConnectDatabase(dbProfile DbConnection, queryMapDirectory string) (dba.ITransactionSQL, error) {
+	connDB, err := dbProfile.ConnectDatabase()
+	if err != nil {
+		return nil, err
+	}
+	if err := dba.ConvertJsonToQueryMap(queryMapDirectory + dbProfile.QueryMapName()); err != nil {
+		connDB.Close()
+		return nil, err
+	}
+	return connDB, nil
+}
+
+/**
+	Route declare who can reach a handler. Empty Role mean the route
+	is public, otherwise the requester need that role or admin
+*/
+type Route struct {
+	Method string
+	Path string
+	Handler http.Handler
+	Role string
+	// Also accept the token query parameter, for WebSocket and EventSource
+	QueryToken bool
+	// Also accept "Authorization: ApiKey <key>", see ApiKeyMiddleware
+	ApiKey bool
+}
+
+func (s *Server) RouteTable() []Route {
+	return []Route{
+		{Method: http.MethodGet, Path: "/.well-known/jwks.json", Handler: http.HandlerFunc(s.JWKSHandler)},
+		{Method: http.MethodPost, Path: "/user", Handler: http.HandlerFunc(s.CreateUserHandler)},
+		{Method: http.MethodPost, Path: "/user/login", Handler: LoginOps{s}},
+		{Method: http.MethodPost, Path: "/user/token/refresh", Handler: http.HandlerFunc(s.RefreshTokenHandler)},
+		{Method: http.MethodPost, Path: "/user/logout", Handler: http.HandlerFunc(s.LogoutHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodPost, Path: "/user/check", Handler: CheckLogin{}, Role: dba.USER_ROLE_USER},
+		{Method: http.MethodPut, Path: "/user/{id:.+}", Handler: http.HandlerFunc(s.UpdateUserHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodDelete, Path: "/user", Handler: http.HandlerFunc(s.DeleteUserHandler), Role: dba.USER_ROLE_USER},
+
+		{Method: http.MethodPost, Path: "/topics", Handler: http.HandlerFunc(s.CreateTopicHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodGet, Path: "/topics", Handler: http.HandlerFunc(s.GetTopicHandler), Role: dba.USER_ROLE_USER},
+		// before /topics/{id} so search is not taken as an id
+		{Method: http.MethodGet, Path: "/topics/search", Handler: http.HandlerFunc(s.SearchTopicHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodGet, Path: "/topics/{id}", Handler: http.HandlerFunc(s.GetTopicDetailHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodPatch, Path: "/topics/{id}", Handler: http.HandlerFunc(s.UpdateTopicHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodDelete, Path: "/topics/{id}", Handler: http.HandlerFunc(s.DeleteTopicHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodPost, Path: "/topics/{id}/members", Handler: http.HandlerFunc(s.AddMemberHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodGet, Path: "/topics/{id}/members", Handler: http.HandlerFunc(s.GetMemberHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodPatch, Path: "/topics/{id}/members/{userId:.+}", Handler: http.HandlerFunc(s.UpdateMemberHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodDelete, Path: "/topics/{id}/members/{userId:.+}", Handler: http.HandlerFunc(s.RemoveMemberHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodPost, Path: "/topics/{id}/transfer", Handler: http.HandlerFunc(s.TransferTopicHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodGet, Path: "/topics/{id}/requests", Handler: http.HandlerFunc(s.GetSubscriptionRequestHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodPost, Path: "/topics/{id}/requests/{requestId}/approve", Handler: http.HandlerFunc(s.ApproveSubscriptionRequestHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodPost, Path: "/topics/{id}/requests/{requestId}/reject", Handler: http.HandlerFunc(s.RejectSubscriptionRequestHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodPost, Path: "/apikeys", Handler: http.HandlerFunc(s.CreateApiKeyHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodGet, Path: "/apikeys", Handler: http.HandlerFunc(s.GetApiKeyHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodDelete, Path: "/apikeys/{id}", Handler: http.HandlerFunc(s.RevokeApiKeyHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodPost, Path: "/subscribe", Handler: http.HandlerFunc(s.CreateSubscribeHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodGet, Path: "/subscriptions", Handler: http.HandlerFunc(s.GetSubscriptionHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodDelete, Path: "/subscriptions/{id}", Handler: http.HandlerFunc(s.DeleteSubscriptionHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodGet, Path: "/subscriptions/unsubscribe", Handler: http.HandlerFunc(s.UnsubscribeConfirmationHandler)},
+		{Method: http.MethodPost, Path: "/subscriptions/unsubscribe", Handler: http.HandlerFunc(s.UnsubscribeHandler)},
+
+		{Method: http.MethodPost, Path: "/notification", Handler: CreateNotification{s}, Role: dba.USER_ROLE_USER, ApiKey: true},
+		{Method: http.MethodGet, Path: "/notification", Handler: http.HandlerFunc(s.GetNotificationHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodDelete, Path: "/notification", Handler: http.HandlerFunc(s.DeleteNotificationsHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodGet, Path: "/notification/summary", Handler: http.HandlerFunc(s.GetNotificationSummaryHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodPost, Path: "/notification/read", Handler: http.HandlerFunc(s.ReadNotificationHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodDelete, Path: "/notification/{id}", Handler: http.HandlerFunc(s.DeleteNotificationHandler), Role: dba.USER_ROLE_USER},
+		{Method: http.MethodGet, Path: "/notification/stream", Handler: http.HandlerFunc(s.NotificationStreamHandler), Role: dba.USER_ROLE_USER, QueryToken: true},
+		{Method: http.MethodGet, Path: "/notification/events", Handler: http.HandlerFunc(s.NotificationEventsHandler), Role: dba.USER_ROLE_USER, QueryToken: true},
+
+		{Method: http.MethodGet, Path: "/deadletters", Handler: http.HandlerFunc(s.GetDeadLetterHandler), Role: dba.USER_ROLE_ADMIN},
+		{Method: http.MethodPost, Path: "/deadletters/{id}/requeue", Handler: http.HandlerFunc(s.RequeueDeadLetterHandler), Role: dba.USER_ROLE_ADMIN},
+		{Method: http.MethodGet, Path: "/audit", Handler: http.HandlerFunc(s.GetAuditLogHandler), Role: dba.USER_ROLE_ADMIN},
+	}
+}
+
+func (s *Server) Routes() http.Handler {
+	router := mux.NewRouter()
+	router.Use(s.LoggerMiddleware)
+	for _, route := range s.RouteTable() {
+		handler := route.Handler
+		if len(route.Role) != 0 {
+			handler = s.RoleMiddleware(route.Role, route.QueryToken, handler)
+		}
+		if route.ApiKey {
+			handler = s.ApiKeyMiddleware(route.Handler, handler)
+		}
+		router.Handle(route.Path, handler).Methods(route.Method)
+	}
+	return router
+}
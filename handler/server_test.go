@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"fmt"
+	"database/sql"
+	"testing"
+	"strings"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/humamfauzi/go-notification/auth"
+	dba "github.com/humamfauzi/go-notification/database"
+	"github.com/humamfauzi/go-notification/utils"
+)
+
+func serveRoute(server *Server, method, path, body, token string) HandlerReply {
+	req := httptest.NewRequest(method, baseUrl + path, strings.NewReader(body))
+	if len(token) != 0 {
+		req.Header["Authentication"] = []string{"Bearer " + token}
+	}
+	w := httptest.NewRecorder()
+	server.Routes().ServeHTTP(w, req)
+	return extractReply(w)
+}
+
+func TestServerIsolation(t *testing.T) {
+	first := NewServer(dba.NewMemoryStore())
+	second := NewServer(dba.NewMemoryStore())
+	second.Keys = auth.NewSecretKeySet([]byte("another tenant secret"))
+
+	credential := `{"email": "tenant@asd.asd", "password": "rahasia"}`
+	if reply := serveRoute(first, http.MethodPost, "/user", credential, ""); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	reply := serveRoute(first, http.MethodPost, "/user/login", credential, "")
+	if reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	token := reply.Message.(map[string]interface{})["token"].(string)
+
+	// user only exist in the first store
+	if reply := serveRoute(second, http.MethodPost, "/user/login", credential, ""); reply.Code != http.StatusBadRequest {
+		t.Fatalf("want %v get %v", http.StatusBadRequest, reply)
+	}
+	// token signed by the first server is not accepted by the second
+	if reply := serveRoute(second, http.MethodGet, "/topics", "", token); reply.Code != http.StatusUnauthorized {
+		t.Fatalf("want %v get %v", http.StatusUnauthorized, reply)
+	}
+	reply = serveRoute(first, http.MethodGet, "/topics", "", token)
+	if reply.Code != http.StatusOK || len(reply.Message.([]interface{})) != 0 {
+		t.Fatalf("want 200 with no topic get %v", reply)
+	}
+}
+
+func TestProtectedRouteWithoutToken(t *testing.T) {
+	server := NewServer(dba.NewMemoryStore())
+	for _, route := range server.RouteTable() {
+		if len(route.Role) == 0 {
+			continue
+		}
+		path := strings.NewReplacer("{id}", "1", "{requestId}", "1", "{id:.+}", "user/1", "{userId:.+}", "user/1").Replace(route.Path)
+		for _, token := range []string{"", "Bearer not-a-jwt", "not-a-bearer"} {
+			req := httptest.NewRequest(route.Method, baseUrl + path, strings.NewReader(""))
+			if len(token) != 0 {
+				req.Header["Authentication"] = []string{token}
+			}
+			w := httptest.NewRecorder()
+			server.Routes().ServeHTTP(w, req)
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("%v %v with token %q want %v get %v", route.Method, path, token, http.StatusUnauthorized, w.Code)
+			}
+		}
+	}
+}
+
+func createUserOn(t *testing.T, server *Server, email, password string) (dba.UserProfile, string) {
+	credential := fmt.Sprintf(`{"email": "%v", "password": "%v"}`, email, password)
+	if reply := serveRoute(server, http.MethodPost, "/user", credential, ""); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	reply := serveRoute(server, http.MethodPost, "/user/login", credential, "")
+	if reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	user, err := server.Store.FindUser(dba.NewQueryBuilder().Where("email", "=", email))
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	return user, reply.Message.(map[string]interface{})["token"].(string)
+}
+
+func TestAdminRoute(t *testing.T) {
+	server := NewServer(dba.NewMemoryStore())
+	user, token := createUserOn(t, server, "operator@asd.asd", "rahasia")
+	if reply := serveRoute(server, http.MethodGet, "/deadletters", "", token); reply.Code != http.StatusForbidden {
+		t.Fatalf("want %v get %v", http.StatusForbidden, reply)
+	}
+	user.Role = dba.USER_ROLE_ADMIN
+	if err := server.Store.UpdateUser(user, []string{"role"}); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if reply := serveRoute(server, http.MethodGet, "/deadletters", "", token); reply.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want %v get %v", http.StatusServiceUnavailable, reply)
+	}
+}
+
+func TestUpdateUserRoute(t *testing.T) {
+	randName := utils.RandomStringId("", 10)
+	email := fmt.Sprintf("update%v@asd.asd", randName)
+	user, token := createUserOn(t, testServer, email, "rahasia")
+	other, _ := createUserOn(t, testServer, "other" + email, "rahasia")
+
+	if reply := serveRoute(testServer, http.MethodPut, "/user/" + other.Id, `{"password": "baru"}`, token); reply.Code != http.StatusForbidden {
+		t.Fatalf("want %v get %v", http.StatusForbidden, reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPut, "/user/" + user.Id, `{"email": "a@a.a"}`, token); reply.Code != http.StatusBadRequest {
+		t.Fatalf("want %v get %v", http.StatusBadRequest, reply)
+	}
+	changed := fmt.Sprintf(`{"email": "new%v", "password": "baru"}`, email)
+	if reply := serveRoute(testServer, http.MethodPut, "/user/" + user.Id, changed, token); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, "/user/login", changed, ""); reply.Code != http.StatusOK {
+		t.Fatalf("should login with the new credential get %v", reply)
+	}
+}
+
+func TestDeleteUserRoute(t *testing.T) {
+	randName := utils.RandomStringId("", 10)
+	user, token := createUserOn(t, testServer, fmt.Sprintf("delete%v@asd.asd", randName), "rahasia")
+	other, otherToken := createUserOn(t, testServer, fmt.Sprintf("deleteother%v@asd.asd", randName), "rahasia")
+	// update is not shadowed by delete anymore
+	if reply := serveRoute(testServer, http.MethodPut, "/user/" + user.Id, `{"password": "baru"}`, token); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	// owned topic with subscribers and notifications, and a subscription elsewhere
+	topicId := createTopicOn(t, testServer, user, token)
+	otherTopicId := createTopicOn(t, testServer, other, otherToken)
+	for _, subscribe := range []struct{ topicId int; token string }{{topicId, token}, {topicId, otherToken}, {otherTopicId, token}, {otherTopicId, otherToken}} {
+		if reply := serveRoute(testServer, http.MethodPost, "/subscribe", fmt.Sprintf(`{"topic_id": %d}`, subscribe.topicId), subscribe.token); reply.Code != http.StatusOK {
+			t.Fatalf("want 200 get %v", reply)
+		}
+	}
+	for _, publish := range []struct{ topicId int; token string }{{topicId, token}, {otherTopicId, otherToken}} {
+		notification := fmt.Sprintf(`{"topic_id": %d, "message": "hello"}`, publish.topicId)
+		if reply := serveRoute(testServer, http.MethodPost, "/notification", notification, publish.token); reply.Code != http.StatusOK {
+			t.Fatalf("want 200 get %v", reply)
+		}
+	}
+	if reply := serveRoute(testServer, http.MethodDelete, "/user", "", token); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	// token of a deleted user is not accepted
+	if reply := serveRoute(testServer, http.MethodPost, "/user/check", "", token); reply.Code != http.StatusUnauthorized {
+		t.Fatalf("want %v get %v", http.StatusUnauthorized, reply)
+	}
+	if _, err := testServer.Store.GetTopics(dba.NewQueryBuilder().Where("id", "=", topicId)); err != sql.ErrNoRows {
+		t.Fatalf("owned topic should be removed get %v", err)
+	}
+	subscribers, err := testServer.Store.GetSubscribers(dba.NewQueryBuilder().In("topic_id", topicId, otherTopicId))
+	if err != nil || len(subscribers) != 1 || subscribers[0].UserId != other.Id {
+		t.Fatalf("want only the owner of the other topic get %v %v", subscribers, err)
+	}
+	if _, err := testServer.Store.GetNotifications(dba.NewQueryBuilder().Where("user_id", "=", user.Id)); err != sql.ErrNoRows {
+		t.Fatalf("notification of the user should be removed get %v", err)
+	}
+}
+
+func TestStartDeliveryQueueWithoutDatabase(t *testing.T) {
+	server := NewServer(dba.NewMemoryStore())
+	stop := server.StartDeliveryQueue()
+	defer stop()
+	if server.deliveryQueue != nil {
+		t.Fatalf("delivery queue should not start without database")
+	}
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/humamfauzi/go-notification/broker"
+	dba "github.com/humamfauzi/go-notification/database"
+)
+
+const (
+	streamWriteWait = 10 * time.Second
+	streamPongWait = 60 * time.Second
+	streamPingPeriod = (streamPongWait * 9) / 10
+	streamMaxMessageSize = 4096
+	streamBufferSize = 64
+)
+
+var (
+	upgrader = websocket.Upgrader{
+		ReadBufferSize: 1024,
+		WriteBufferSize: 1024,
+	}
+)
+
+func userTopic(userId string) string {
+	return "notification/" + userId
+}
+
+/**
+	Publish every written notification to the broker under its user topic.
+	Any live transport subscribed to that user receive it right away
+*/
+func (s *Server) publishNotifications(notifications dba.Notifications) {
+	for _, notification := range notifications {
+		s.broker.Publish(userTopic(notification.UserId), notification)
+	}
+}
+
+/**
+	socketClient drain a broker subscription into a WebSocket. A slow
+	socket lose the oldest notification, the client can still fetch it
+	through GET /notification
+*/
+type socketClient struct {
+	server *Server
+	userId string
+	subscription *broker.Subscription
+	conn *websocket.Conn
+}
+
+/**
+	Message that client send back through the stream. Ack contain
+	notification ids that already shown to user so it can be marked as read
+*/
+type streamAck struct {
+	Ack []int `json:"ack"`
+}
+
+func (sc *socketClient) readPump() {
+	defer func() {
+		sc.server.broker.Unsubscribe(sc.subscription)
+		sc.conn.Close()
+	}()
+	sc.conn.SetReadLimit(streamMaxMessageSize)
+	sc.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	sc.conn.SetPongHandler(func(string) error {
+		sc.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+		return nil
+	})
+	for {
+		_, message, err := sc.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		ack := streamAck{}
+		if err := json.Unmarshal(message, &ack); err != nil {
+			sc.server.Logger.Println("STREAM INVALID ACK", sc.userId, err)
+			continue
+		}
+		if err := sc.server.markNotificationRead(sc.userId, ack.Ack); err != nil {
+			sc.server.Logger.Println("STREAM ACK FAILED", sc.userId, err)
+		}
+	}
+}
+
+func (sc *socketClient) writePump() {
+	ticker := time.NewTicker(streamPingPeriod)
+	defer func() {
+		ticker.Stop()
+		sc.conn.Close()
+	}()
+	for {
+		select {
+		case message, ok := <-sc.subscription.Messages():
+			sc.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if !ok {
+				sc.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := sc.conn.WriteJSON(message.Payload); err != nil {
+				return
+			}
+		case <-ticker.C:
+			sc.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := sc.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+/**
+	Only mark notification that belong to the user. Any id that
+	does not exist or owned by other user silently ignored
+*/
+func (s *Server) markNotificationRead(userId string, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	selector := notificationSelector{Ids: ids}
+	if err := selector.validate(); err != nil {
+		return err
+	}
+	owned, err := s.ownedNotifications(selector.query(userId).Where("is_read", "=", false))
+	if err != nil || len(owned) == 0 {
+		return err
+	}
+	_, err = s.readNotifications(userId, owned)
+	return err
+}
+
+/**
+	Browser cannot set custom header when opening a WebSocket or an
+	EventSource so the token can also be passed as query parameter
+*/
+func streamAuthentication(r *http.Request) string {
+	if authenticationToken := r.Header.Get("Authentication"); len(authenticationToken) != 0 {
+		return authenticationToken
+	}
+	if token := r.URL.Query().Get("token"); len(token) != 0 {
+		return "Bearer " + token
+	}
+	return ""
+}
+
+func (s *Server) NotificationStreamHandler(w http.ResponseWriter, r *http.Request) {
+	userProfile, err := getRequesterProfile(r)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.Logger.Println("STREAM UPGRADE FAILED", err)
+		return
+	}
+	client := &socketClient{
+		server: s,
+		userId: userProfile.Id,
+		subscription: s.broker.Subscribe(userTopic(userProfile.Id), s.Config.StreamBufferSize, broker.DropOldest),
+		conn: conn,
+	}
+	go client.writePump()
+	go client.readPump()
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/humamfauzi/go-notification/broker"
+	dba "github.com/humamfauzi/go-notification/database"
+)
+
+func TestPublishNotifications(t *testing.T) {
+	receiver := testServer.broker.Subscribe(userTopic("user/receiver"), 2, broker.DropOldest)
+	other := testServer.broker.Subscribe(userTopic("user/other"), 2, broker.DropOldest)
+	defer testServer.broker.Unsubscribe(receiver)
+	defer testServer.broker.Unsubscribe(other)
+
+	testServer.publishNotifications(dba.Notifications{
+		dba.Notification{Id: 1, UserId: "user/receiver", Message: "hello"},
+	})
+	select {
+	case message := <-receiver.Messages():
+		notification := message.Payload.(dba.Notification)
+		if notification.Id != 1 {
+			t.Fatalf("want 1 get %v", notification.Id)
+		}
+	default:
+		t.Fatalf("receiver should get the notification")
+	}
+	if len(other.Messages()) != 0 {
+		t.Fatalf("other user should not get the notification")
+	}
+}
+
+func TestStreamAuthentication(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, baseUrl + "/notification/stream?token=abc", nil)
+	if result := streamAuthentication(req); result != "Bearer abc" {
+		t.Fatalf("want Bearer abc get %v", result)
+	}
+	req.Header["Authentication"] = []string{"Bearer def"}
+	if result := streamAuthentication(req); result != "Bearer def" {
+		t.Fatalf("want Bearer def get %v", result)
+	}
+}
+
+func TestNotificationStreamHandlerWithoutToken(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, baseUrl + "/notification/stream", nil)
+	w := httptest.NewRecorder()
+	testServer.Routes().ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("want %v get %v", http.StatusUnauthorized, w.Code)
+	}
+}
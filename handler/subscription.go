@@ -0,0 +1,290 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/humamfauzi/go-notification/auth"
+	dba "github.com/humamfauzi/go-notification/database"
+)
+
+/**
+	Notification about the topic itself, e.g a subscription request, go
+	through the same path as a published one so it reach the stream and
+	the webhook of the receiver. Failing it should not fail the request
+*/
+func (s *Server) notifyUser(userId string, topicId int, message string) {
+	cn := CreateNotification{s}
+	webhookSubscribers, err := cn.GetWebhookSubscribers(topicId)
+	if err != nil {
+		s.Logger.Println("NOTIFICATION NOT SENT", userId, topicId, err)
+		return
+	}
+	notifications := cn.ComposeNotification(dba.Subscribers{dba.Subscriber{UserId: userId}}, topicId, message)
+	if err := cn.InsertNotifications(notifications, webhookSubscribers); err != nil {
+		s.Logger.Println("NOTIFICATION NOT SENT", userId, topicId, err)
+		return
+	}
+	s.publishNotifications(notifications)
+}
+
+// Subscriber is kept in the request until the owner approve it
+func (s *Server) requestSubscription(subscriber dba.Subscriber, w http.ResponseWriter) {
+	qb := dba.NewQueryBuilder().
+		Select("id").
+		Where("topic_id", "=", subscriber.TopicId).
+		Where("user_id", "=", subscriber.UserId).
+		Where("status", "=", dba.SUBSCRIPTION_REQUEST_PENDING)
+	if _, err := s.Store.GetSubscriptionRequests(qb); err == nil {
+		WriteReply(int(http.StatusConflict), false, "Already Requested", w)
+		return
+	}
+	subscriptionRequest := dba.SubscriptionRequest{
+		TopicId: subscriber.TopicId,
+		UserId: subscriber.UserId,
+		CallbackUrl: subscriber.CallbackUrl,
+		Secret: subscriber.Secret,
+		Status: dba.SUBSCRIPTION_REQUEST_PENDING,
+		CreatedAt: time.Now().Unix(),
+	}
+	requestId, err := s.Store.InsertSubscriptionRequest(subscriptionRequest)
+	if err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	qb = dba.NewQueryBuilder().Select("user_id").Where("id", "=", subscriber.TopicId)
+	if topics, err := s.Store.GetTopics(qb); err == nil {
+		message := fmt.Sprintf("%v request to subscribe, approve or reject request %d", subscriber.UserId, requestId)
+		s.notifyUser(topics[0].UserId, subscriber.TopicId, message)
+	}
+	// Secret is only shown once, same as a direct subscribe
+	reply := struct {
+		RequestId int64 `json:"request_id"`
+		Status string `json:"status"`
+		Secret string `json:"secret,omitempty"`
+	}{ requestId, subscriptionRequest.Status, subscriber.Secret }
+	WriteReply(int(http.StatusAccepted), true, reply, w)
+}
+
+// Pending request by default, other status through the status query
+func (s *Server) GetSubscriptionRequestHandler(w http.ResponseWriter, r *http.Request) {
+	_, topicId, _, ok := s.topicRequester(w, r, dba.TOPIC_ROLE_ADMIN)
+	if !ok {
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if len(status) == 0 {
+		status = dba.SUBSCRIPTION_REQUEST_PENDING
+	}
+	qb := dba.NewQueryBuilder().
+		Where("topic_id", "=", topicId).
+		Where("status", "=", status).
+		OrderBy("id", dba.ORDER_ASC)
+	subscriptionRequests, err := s.Store.GetSubscriptionRequests(qb)
+	if err == sql.ErrNoRows {
+		WriteReply(int(http.StatusOK), true, dba.SubscriptionRequests{}, w)
+		return
+	}
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	WriteReply(int(http.StatusOK), true, subscriptionRequests, w)
+	return
+}
+
+func (s *Server) ApproveSubscriptionRequestHandler(w http.ResponseWriter, r *http.Request) {
+	s.decideSubscriptionRequest(w, r, dba.SUBSCRIPTION_REQUEST_APPROVED, dba.AUDIT_SUBSCRIPTION_APPROVED)
+}
+
+func (s *Server) RejectSubscriptionRequestHandler(w http.ResponseWriter, r *http.Request) {
+	s.decideSubscriptionRequest(w, r, dba.SUBSCRIPTION_REQUEST_REJECTED, dba.AUDIT_SUBSCRIPTION_REJECTED)
+}
+
+/**
+	Owner and admin of the topic decide a pending request, the requester
+	is notified of the decision
+*/
+func (s *Server) decideSubscriptionRequest(w http.ResponseWriter, r *http.Request, status, action string) {
+	requester, topicId, _, ok := s.topicRequester(w, r, dba.TOPIC_ROLE_ADMIN)
+	if !ok {
+		return
+	}
+	requestId, err := strconv.Atoi(mux.Vars(r)["requestId"])
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Invalid Request Id", w)
+		return
+	}
+	qb := dba.NewQueryBuilder().
+		Where("id", "=", requestId).
+		Where("topic_id", "=", topicId)
+	subscriptionRequests, err := s.Store.GetSubscriptionRequests(qb)
+	if err != nil {
+		WriteReply(int(http.StatusNotFound), false, "Request Not Found", w)
+		return
+	}
+	subscriptionRequest := subscriptionRequests[0]
+	if subscriptionRequest.Status != dba.SUBSCRIPTION_REQUEST_PENDING {
+		WriteReply(int(http.StatusConflict), false, "Already Decided", w)
+		return
+	}
+	subscriptionRequest.Status = status
+	subscriptionRequest.DecidedBy = requester.Id
+	subscriptionRequest.DecidedAt = time.Now().Unix()
+	subscriber := subscriptionRequest.Subscriber()
+	if subscriber.UnsubscribeToken, err = auth.GenerateUnsubscribeToken(); err != nil {
+		WriteReply(int(http.StatusInternalServerError), false, "Cannot Generate Token", w)
+		return
+	}
+	err = s.Store.DecideSubscriptionRequest(subscriptionRequest, subscriber)
+	if err == dba.ErrAlreadyDecided {
+		WriteReply(int(http.StatusConflict), false, "Already Decided", w)
+		return
+	}
+	if err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	s.audit(requester.Id, action, topicTarget(topicId), subscriptionRequest.UserId)
+	message := fmt.Sprintf("subscription request %d is %v", requestId, status)
+	s.notifyUser(subscriptionRequest.UserId, topicId, message)
+	WriteReply(int(http.StatusOK), true, nil, w)
+	return
+}
+
+// Every subscription of the requester, oldest first
+func (s *Server) GetSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	requester, err := getRequesterProfile(r)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
+	}
+	qb := dba.NewQueryBuilder().
+		Select("id", "topic_id", "user_id", "callback_url").
+		Where("user_id", "=", requester.Id).
+		OrderBy("id", dba.ORDER_ASC)
+	subscribers, err := s.Store.GetSubscribers(qb)
+	if err == sql.ErrNoRows {
+		WriteReply(int(http.StatusOK), true, dba.Subscribers{}, w)
+		return
+	}
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	WriteReply(int(http.StatusOK), true, subscribers, w)
+	return
+}
+
+func (s *Server) unsubscribe(subscriber dba.Subscriber, detail string, w http.ResponseWriter) {
+	if err := s.Store.DeleteSubscriber(subscriber); err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	s.audit(subscriber.UserId, dba.AUDIT_UNSUBSCRIBED, topicTarget(subscriber.TopicId), detail)
+	WriteReply(int(http.StatusOK), true, nil, w)
+}
+
+// Subscription of another user look the same as a missing one
+func (s *Server) DeleteSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	requester, err := getRequesterProfile(r)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
+	}
+	subscriberId, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Invalid Subscription Id", w)
+		return
+	}
+	qb := dba.NewQueryBuilder().
+		Select("id", "topic_id", "user_id").
+		Where("id", "=", subscriberId).
+		Where("user_id", "=", requester.Id)
+	subscribers, err := s.Store.GetSubscribers(qb)
+	if err != nil {
+		WriteReply(int(http.StatusNotFound), false, "Subscription Not Found", w)
+		return
+	}
+	s.unsubscribe(subscribers[0], "", w)
+	return
+}
+
+// Reply is already written when the token does not match a subscription
+func (s *Server) tokenSubscriber(w http.ResponseWriter, r *http.Request) (dba.Subscriber, bool) {
+	token := r.URL.Query().Get("token")
+	if len(token) == 0 {
+		WriteReply(int(http.StatusBadRequest), false, "Token is Needed", w)
+		return dba.Subscriber{}, false
+	}
+	qb := dba.NewQueryBuilder().
+		Select("id", "topic_id", "user_id").
+		Where("unsubscribe_token", "=", token)
+	subscribers, err := s.Store.GetSubscribers(qb)
+	if err != nil {
+		WriteReply(int(http.StatusNotFound), false, "Subscription Not Found", w)
+		return dba.Subscriber{}, false
+	}
+	return subscribers[0], true
+}
+
+var unsubscribeConfirmation = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Unsubscribe</title></head>
+<body>
+<form method="post" action="?token={{.Token}}">
+<p>Stop receiving notification from {{.Title}}?</p>
+<button type="submit">Unsubscribe</button>
+</form>
+</body>
+</html>
+`))
+
+/**
+	Link in the message open this page. Link scanner and prefetcher follow
+	link too, so GET only ask for confirmation and never unsubscribe
+*/
+func (s *Server) UnsubscribeConfirmationHandler(w http.ResponseWriter, r *http.Request) {
+	subscriber, ok := s.tokenSubscriber(w, r)
+	if !ok {
+		return
+	}
+	title := "this topic"
+	qb := dba.NewQueryBuilder().Select("id", "title").Where("id", "=", subscriber.TopicId)
+	if topics, err := s.Store.GetTopics(qb); err == nil {
+		title = topics[0].Title
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	confirmation := struct {
+		Token string
+		Title string
+	}{ r.URL.Query().Get("token"), title }
+	if err := unsubscribeConfirmation.Execute(w, confirmation); err != nil {
+		s.Logger.Println(err)
+	}
+}
+
+/**
+	One click unsubscribe from the token embedded in the message, no login
+	needed. Only POST, from the confirmation page or a mail client that
+	support List-Unsubscribe-Post, remove the subscription
+*/
+func (s *Server) UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	subscriber, ok := s.tokenSubscriber(w, r)
+	if !ok {
+		return
+	}
+	s.unsubscribe(subscriber, "unsubscribe_token", w)
+	return
+}
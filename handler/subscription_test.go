@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+
+	dba "github.com/humamfauzi/go-notification/database"
+	"github.com/humamfauzi/go-notification/utils"
+)
+
+func TestPrivateTopicSubscription(t *testing.T) {
+	randName := utils.RandomStringId("", 10)
+	owner, ownerToken := createUserOn(t, testServer, fmt.Sprintf("owner%v@asd.asd", randName), "rahasia")
+	approved, approvedToken := createUserOn(t, testServer, fmt.Sprintf("approved%v@asd.asd", randName), "rahasia")
+	rejected, rejectedToken := createUserOn(t, testServer, fmt.Sprintf("rejected%v@asd.asd", randName), "rahasia")
+
+	if reply := serveRoute(testServer, http.MethodPost, "/topics", `{"title": "incident", "visibility": "secret"}`, ownerToken); reply.Code != http.StatusBadRequest {
+		t.Fatalf("want %v get %v", http.StatusBadRequest, reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, "/topics", `{"title": "incident", "visibility": "private"}`, ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	topics, err := testServer.Store.GetTopics(dba.NewQueryBuilder().Where("user_id", "=", owner.Id))
+	if err != nil || topics[0].Visibility != dba.TOPIC_VISIBILITY_PRIVATE {
+		t.Fatalf("want private topic get %v %v", topics, err)
+	}
+	topicId := topics[0].Id
+	subscribe := fmt.Sprintf(`{"topic_id": %d}`, topicId)
+	requests := fmt.Sprintf("/topics/%d/requests", topicId)
+
+	reply := serveRoute(testServer, http.MethodPost, "/subscribe", subscribe, approvedToken)
+	if reply.Code != http.StatusAccepted {
+		t.Fatalf("want %v get %v", http.StatusAccepted, reply)
+	}
+	requestId := int(reply.Message.(map[string]interface{})["request_id"].(float64))
+	if reply := serveRoute(testServer, http.MethodPost, "/subscribe", subscribe, approvedToken); reply.Code != http.StatusConflict {
+		t.Fatalf("want %v get %v", http.StatusConflict, reply)
+	}
+	if reply := serveRoute(testServer, http.MethodGet, fmt.Sprintf("/topics/%d/members", topicId), "", approvedToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("non member should not see private topic get %v", reply)
+	}
+	notifications, err := testServer.Store.GetNotifications(dba.NewQueryBuilder().Where("user_id", "=", owner.Id))
+	if err != nil || !strings.Contains(notifications[0].Message, approved.Id) {
+		t.Fatalf("owner should be notified of the request get %v %v", notifications, err)
+	}
+
+	reply = serveRoute(testServer, http.MethodGet, requests, "", ownerToken)
+	if reply.Code != http.StatusOK || len(reply.Message.([]interface{})) != 1 {
+		t.Fatalf("want one pending request get %v", reply)
+	}
+	approve := fmt.Sprintf("%v/%d/approve", requests, requestId)
+	if reply := serveRoute(testServer, http.MethodPost, approve, "", approvedToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("want %v get %v", http.StatusForbidden, reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, approve, "", ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, approve, "", ownerToken); reply.Code != http.StatusConflict {
+		t.Fatalf("want %v get %v", http.StatusConflict, reply)
+	}
+	subscribers, err := testServer.Store.GetSubscribers(dba.NewQueryBuilder().Where("user_id", "=", approved.Id))
+	if err != nil {
+		t.Fatalf("approved request should subscribe get %v", err)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, "/subscribe", subscribe, approvedToken); reply.Code != http.StatusConflict {
+		t.Fatalf("want %v get %v", http.StatusConflict, reply)
+	}
+	if reply := serveRoute(testServer, http.MethodGet, fmt.Sprintf("/topics/%d/members", topicId), "", approvedToken); reply.Code != http.StatusOK {
+		t.Fatalf("approved user should be a member get %v", reply)
+	}
+
+	reply = serveRoute(testServer, http.MethodPost, "/subscribe", subscribe, rejectedToken)
+	if reply.Code != http.StatusAccepted {
+		t.Fatalf("want %v get %v", http.StatusAccepted, reply)
+	}
+	reject := fmt.Sprintf("%v/%v/reject", requests, reply.Message.(map[string]interface{})["request_id"])
+	if reply := serveRoute(testServer, http.MethodPost, reject, "", ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if _, err := testServer.Store.GetSubscribers(dba.NewQueryBuilder().Where("user_id", "=", rejected.Id)); err == nil {
+		t.Fatalf("rejected request should not subscribe")
+	}
+	notifications, err = testServer.Store.GetNotifications(dba.NewQueryBuilder().Where("user_id", "=", rejected.Id))
+	if err != nil || !strings.Contains(notifications[0].Message, dba.SUBSCRIPTION_REQUEST_REJECTED) {
+		t.Fatalf("requester should be notified of the decision get %v %v", notifications, err)
+	}
+
+	// still a member so subscribing again need no approval
+	subscription := fmt.Sprintf("/subscriptions/%d", subscribers[0].Id)
+	if reply := serveRoute(testServer, http.MethodDelete, subscription, "", approvedToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, "/subscribe", subscribe, approvedToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+}
+
+func TestSubscriptionManagement(t *testing.T) {
+	server := NewServer(dba.NewMemoryStore())
+	server.webhookSender.LookupIPAddr = fakeLookupIPAddr
+	owner, ownerToken := createUserOn(t, server, "owner@asd.asd", "rahasia")
+	user, userToken := createUserOn(t, server, "subscriber@asd.asd", "rahasia")
+	topicId := createTopicOn(t, server, owner, ownerToken)
+
+	subscribe := fmt.Sprintf(`{"topic_id": %d, "callback_url": "https://service.example.com/hook"}`, topicId)
+	if reply := serveRoute(server, http.MethodPost, "/subscribe", subscribe, userToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if reply := serveRoute(server, http.MethodPost, "/subscribe", subscribe, userToken); reply.Code != http.StatusConflict {
+		t.Fatalf("want %v get %v", http.StatusConflict, reply)
+	}
+	reply := serveRoute(server, http.MethodGet, "/subscriptions", "", userToken)
+	if reply.Code != http.StatusOK || len(reply.Message.([]interface{})) != 1 {
+		t.Fatalf("want one subscription get %v", reply)
+	}
+	subscription := reply.Message.([]interface{})[0].(map[string]interface{})
+	if _, ok := subscription["secret"]; ok {
+		t.Fatalf("secret should not be listed get %v", subscription)
+	}
+	path := fmt.Sprintf("/subscriptions/%v", subscription["id"])
+	if reply := serveRoute(server, http.MethodDelete, path, "", ownerToken); reply.Code != http.StatusNotFound {
+		t.Fatalf("other user subscription should not be found get %v", reply)
+	}
+
+	// the token reach the subscriber inside the webhook payload
+	notification := fmt.Sprintf(`{"topic_id": %d, "message": "hello"}`, topicId)
+	if reply := serveRoute(server, http.MethodPost, "/notification", notification, ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	jobs := server.Store.(*dba.MemoryStore).DeliveryJobs()
+	sent := dba.Notification{}
+	if len(jobs) != 1 || json.Unmarshal([]byte(jobs[0].Payload), &sent) != nil || len(sent.UnsubscribeToken) == 0 {
+		t.Fatalf("want unsubscribe token in the payload get %v", jobs)
+	}
+	if reply := serveRoute(server, http.MethodGet, "/subscriptions/unsubscribe?token=unknown", "", ""); reply.Code != http.StatusNotFound {
+		t.Fatalf("want %v get %v", http.StatusNotFound, reply)
+	}
+	// following the link only show the confirmation
+	req := httptest.NewRequest(http.MethodGet, baseUrl + "/subscriptions/unsubscribe?token=" + sent.UnsubscribeToken, nil)
+	w := httptest.NewRecorder()
+	server.Routes().ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<form method="post"`) || !strings.Contains(w.Body.String(), "member topic") {
+		t.Fatalf("want confirmation page get %v %v", w.Code, w.Body.String())
+	}
+	if reply := serveRoute(server, http.MethodGet, "/subscriptions", "", userToken); len(reply.Message.([]interface{})) != 1 {
+		t.Fatalf("GET should not unsubscribe get %v", reply)
+	}
+	if reply := serveRoute(server, http.MethodPost, "/subscriptions/unsubscribe?token=" + sent.UnsubscribeToken, "", ""); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if reply := serveRoute(server, http.MethodGet, "/subscriptions", "", userToken); len(reply.Message.([]interface{})) != 0 {
+		t.Fatalf("want no subscription get %v", reply)
+	}
+	if len(server.Store.(*dba.MemoryStore).DeliveryJobs()) != 0 {
+		t.Fatalf("pending job should be deleted with the subscription")
+	}
+
+	if reply := serveRoute(server, http.MethodPost, "/subscribe", fmt.Sprintf(`{"topic_id": %d}`, topicId), userToken); reply.Code != http.StatusOK {
+		t.Fatalf("should subscribe again get %v", reply)
+	}
+	subscribers, _ := server.Store.GetSubscribers(dba.NewQueryBuilder().Where("user_id", "=", user.Id))
+	if reply := serveRoute(server, http.MethodDelete, fmt.Sprintf("/subscriptions/%d", subscribers[0].Id), "", userToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	qb := dba.NewQueryBuilder().Where("action", "=", dba.AUDIT_UNSUBSCRIBED)
+	if auditLogs, err := server.Store.GetAuditLogs(qb); err != nil || len(auditLogs) != 2 {
+		t.Fatalf("want two unsubscribe audited get %v %v", auditLogs, err)
+	}
+}
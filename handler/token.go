@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	dba "github.com/humamfauzi/go-notification/database"
+	"github.com/humamfauzi/go-notification/auth"
+	"github.com/humamfauzi/go-notification/utils"
+)
+
+type TokenReply struct {
+	Token string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+/**
+	New access token replace the one stored in users.token so the JWT
+	issued before it stop working
+*/
+func (s *Server) issueAccessToken(user dba.UserProfile) (string, error) {
+	accessToken := utils.RandomStringId("accessToken", 64)
+	token, err := LoginOps{s}.generateJWT(accessToken)
+	if err != nil {
+		return "", err
+	}
+	user.Token = accessToken
+	if err := s.Store.UpdateUser(user, []string{"token"}); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Return the token for the client and its hashed row for the store
+func (s *Server) newRefreshToken(userId, familyId string) (string, dba.RefreshToken, error) {
+	token, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return "", dba.RefreshToken{}, err
+	}
+	now := time.Now()
+	refreshToken := dba.RefreshToken{
+		UserId: userId,
+		FamilyId: familyId,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: now.Add(s.Config.RefreshTokenExpiry).Unix(),
+		CreatedAt: now.Unix(),
+	}
+	return token, refreshToken, nil
+}
+
+/**
+	A rotated refresh token presented again mean it was copied. We cannot
+	tell who is the legit owner so the whole family and the current access
+	token are revoked, the user need to login again
+*/
+func (s *Server) revokeReusedFamily(refreshToken dba.RefreshToken) {
+	if err := s.Store.RevokeRefreshTokenFamily(refreshToken.FamilyId, time.Now().Unix()); err != nil {
+		s.Logger.Println("REFRESH TOKEN FAMILY NOT REVOKED", refreshToken.FamilyId, err)
+	}
+	if err := s.Store.UpdateUser(dba.UserProfile{Id: refreshToken.UserId}, []string{"token"}); err != nil {
+		s.Logger.Println("ACCESS TOKEN NOT REVOKED", refreshToken.UserId, err)
+	}
+	s.audit(refreshToken.UserId, dba.AUDIT_REFRESH_TOKEN_REUSED, refreshToken.UserId, refreshToken.FamilyId)
+}
+
+func (s *Server) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Read Payload", w)
+		return
+	}
+	request := TokenReply{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Parse Payload", w)
+		return
+	}
+	if len(request.RefreshToken) == 0 {
+		WriteReply(int(http.StatusBadRequest), false, "Refresh Token is Needed", w)
+		return
+	}
+	qb := dba.NewQueryBuilder().
+		Where("token_hash", "=", auth.HashToken(request.RefreshToken)).
+		Limit(1)
+	storedRefreshTokens, err := s.Store.GetRefreshTokens(qb)
+	if err != nil {
+		WriteReply(int(http.StatusUnauthorized), false, "Invalid Refresh Token", w)
+		return
+	}
+	current := storedRefreshTokens[0]
+	if current.RevokedAt != 0 {
+		s.revokeReusedFamily(current)
+		WriteReply(int(http.StatusUnauthorized), false, "Refresh Token Revoked", w)
+		return
+	}
+	if time.Now().Unix() >= current.ExpiresAt {
+		WriteReply(int(http.StatusUnauthorized), false, "Refresh Token Expired", w)
+		return
+	}
+
+	refreshToken, next, err := s.newRefreshToken(current.UserId, current.FamilyId)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Token Generation Error", w)
+		return
+	}
+	err = s.Store.RotateRefreshToken(current, next)
+	if err == dba.ErrRefreshTokenReused {
+		// lost the race against another request using the same token
+		s.revokeReusedFamily(current)
+		WriteReply(int(http.StatusUnauthorized), false, "Refresh Token Revoked", w)
+		return
+	}
+	if err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	token, err := s.issueAccessToken(dba.UserProfile{Id: current.UserId})
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Token Generation Error", w)
+		return
+	}
+	WriteReply(int(http.StatusOK), true, TokenReply{token, refreshToken}, w)
+	return
+}
+
+// Revoke every refresh token and the access token of the requester
+func (s *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	requester, err := getRequesterProfile(r)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
+	}
+	if err := s.Store.RevokeUserRefreshTokens(requester.Id, time.Now().Unix()); err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	if err := s.Store.UpdateUser(dba.UserProfile{Id: requester.Id}, []string{"token"}); err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	WriteReply(int(http.StatusOK), true, nil, w)
+	return
+}
+
+/**
+	Public keys for other service to verify our JWT without the secret.
+	Written as is, not inside HandlerReply, since JWKS consumer expect
+	the standard {"keys": [...]} document
+*/
+func (s *Server) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	reply, err := json.Marshal(s.Keys.JWKS())
+	if err != nil {
+		WriteReply(int(http.StatusInternalServerError), false, "Cannot Encode Keys", w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(reply)
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/humamfauzi/go-notification/auth"
+	dba "github.com/humamfauzi/go-notification/database"
+	"github.com/humamfauzi/go-notification/utils"
+)
+
+func loginOn(t *testing.T, server *Server, credential string) (string, string) {
+	reply := serveRoute(server, http.MethodPost, "/user/login", credential, "")
+	if reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	message := reply.Message.(map[string]interface{})
+	return message["token"].(string), message["refresh_token"].(string)
+}
+
+func refreshOn(server *Server, refreshToken string) HandlerReply {
+	return serveRoute(server, http.MethodPost, "/user/token/refresh", fmt.Sprintf(`{"refresh_token": "%v"}`, refreshToken), "")
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	email := fmt.Sprintf("refresh%v@asd.asd", utils.RandomStringId("", 10))
+	createUserOn(t, testServer, email, "rahasia")
+	token, refreshToken := loginOn(t, testServer, fmt.Sprintf(`{"email": "%v", "password": "rahasia"}`, email))
+
+	reply := refreshOn(testServer, refreshToken)
+	if reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	message := reply.Message.(map[string]interface{})
+	rotatedToken, rotatedRefreshToken := message["token"].(string), message["refresh_token"].(string)
+	if rotatedRefreshToken == refreshToken {
+		t.Fatalf("refresh token should be rotated")
+	}
+	if reply := serveRoute(testServer, http.MethodPost, "/user/check", "", token); reply.Code != http.StatusUnauthorized {
+		t.Fatalf("previous access token should be replaced get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, "/user/check", "", rotatedToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+
+	// reusing the rotated token revoke the whole family
+	if reply := refreshOn(testServer, refreshToken); reply.Code != http.StatusUnauthorized {
+		t.Fatalf("want %v get %v", http.StatusUnauthorized, reply)
+	}
+	if reply := refreshOn(testServer, rotatedRefreshToken); reply.Code != http.StatusUnauthorized {
+		t.Fatalf("family should be revoked get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, "/user/check", "", rotatedToken); reply.Code != http.StatusUnauthorized {
+		t.Fatalf("access token should be revoked get %v", reply)
+	}
+	if reply := refreshOn(testServer, "unknown"); reply.Code != http.StatusUnauthorized {
+		t.Fatalf("want %v get %v", http.StatusUnauthorized, reply)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	email := fmt.Sprintf("logout%v@asd.asd", utils.RandomStringId("", 10))
+	createUserOn(t, testServer, email, "rahasia")
+	token, refreshToken := loginOn(t, testServer, fmt.Sprintf(`{"email": "%v", "password": "rahasia"}`, email))
+
+	if reply := serveRoute(testServer, http.MethodPost, "/user/logout", "", token); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, "/user/check", "", token); reply.Code != http.StatusUnauthorized {
+		t.Fatalf("access token should be revoked get %v", reply)
+	}
+	if reply := refreshOn(testServer, refreshToken); reply.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh token should be revoked get %v", reply)
+	}
+}
+
+func TestJWKSRoute(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	keys, err := auth.NewKeySet(auth.Key{Id: "ed-1", Method: auth.SigningMethodEd25519, Private: private, Public: private.Public()})
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	server := NewServer(dba.NewMemoryStore())
+	server.Keys = keys
+
+	req := httptest.NewRequest(http.MethodGet, baseUrl + "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	server.Routes().ServeHTTP(w, req)
+	jwks := auth.JWKS{}
+	if err := json.Unmarshal(w.Body.Bytes(), &jwks); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if w.Code != http.StatusOK || len(jwks.Keys) != 1 || jwks.Keys[0].Kid != "ed-1" {
+		t.Fatalf("want ed-1 get %v %v", w.Code, w.Body.String())
+	}
+
+	// token issued by login carry the kid and pass the middleware
+	_, token := createUserOn(t, server, "jwks@asd.asd", "rahasia")
+	if reply := serveRoute(server, http.MethodPost, "/user/check", "", token); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+}
@@ -0,0 +1,382 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	dba "github.com/humamfauzi/go-notification/database"
+)
+
+const (
+	MAX_TOPIC_TAGS = 10
+	DEFAULT_TOPIC_SEARCH_LIMIT = 20
+	MAX_TOPIC_SEARCH_LIMIT = 100
+	// Word of the search query after this is ignored
+	MAX_TOPIC_SEARCH_WORDS = 5
+)
+
+var (
+	tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+	errInvalidTag = errors.New("Tag should be lowercase letter, digit or dash, at most 32 character")
+	errTooManyTags = errors.New("Too Many Tags")
+)
+
+// Tag is compared lowercase, duplicate is dropped
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !tagPattern.MatchString(tag) {
+			return nil, errInvalidTag
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > MAX_TOPIC_TAGS {
+		return nil, errTooManyTags
+	}
+	return normalized, nil
+}
+
+// Tags of every topic by its id, topic without tag get an empty list
+func (s *Server) topicTags(topicIds []int) (map[int][]string, error) {
+	tags := make(map[int][]string)
+	if len(topicIds) == 0 {
+		return tags, nil
+	}
+	values := make([]interface{}, len(topicIds))
+	for i, topicId := range topicIds {
+		tags[topicId] = []string{}
+		values[i] = topicId
+	}
+	qb := dba.NewQueryBuilder().In("topic_id", values...).OrderBy("tag", dba.ORDER_ASC)
+	topicTags, err := s.Store.GetTopicTags(qb)
+	if err == sql.ErrNoRows {
+		return tags, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, topicTag := range topicTags {
+		tags[topicTag.TopicId] = append(tags[topicTag.TopicId], topicTag.Tag)
+	}
+	return tags, nil
+}
+
+func (s *Server) withTags(topics dba.Topics) (dba.Topics, error) {
+	topicIds := make([]int, len(topics))
+	for i := range topics {
+		topicIds[i] = topics[i].Id
+	}
+	tags, err := s.topicTags(topicIds)
+	if err != nil {
+		return nil, err
+	}
+	for i := range topics {
+		topics[i].Tags = tags[topics[i].Id]
+	}
+	return topics, nil
+}
+
+type topicDetail struct {
+	dba.Topic
+	SubscriberCount int `json:"subscriber_count"`
+	MemberCount int `json:"member_count"`
+	// Role of the requester on the topic
+	Role string `json:"role"`
+}
+
+// Viewer and above, non member of public and unlisted topic count as subscriber
+func (s *Server) GetTopicDetailHandler(w http.ResponseWriter, r *http.Request) {
+	_, topicId, role, ok := s.topicRequester(w, r, dba.TOPIC_ROLE_VIEWER)
+	if !ok {
+		return
+	}
+	topics, err := s.Store.GetTopics(dba.NewQueryBuilder().Where("id", "=", topicId))
+	if err == nil {
+		topics, err = s.withTags(topics)
+	}
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	subscriberCount, err := s.Store.CountSubscribers(topicId)
+	if err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	topicMembers, err := s.Store.GetTopicMembers(dba.NewQueryBuilder().Select("id").Where("topic_id", "=", topicId))
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	detail := topicDetail{
+		Topic: topics[0],
+		SubscriberCount: subscriberCount,
+		MemberCount: len(topicMembers),
+		Role: role,
+	}
+	WriteReply(int(http.StatusOK), true, detail, w)
+	return
+}
+
+// Field left out of the payload is not changed
+type topicChange struct {
+	Title *string `json:"title"`
+	Desc *string `json:"description"`
+	Visibility *string `json:"visibility"`
+	// Replace every tag, an empty list remove them
+	Tags *[]string `json:"tags"`
+}
+
+func (s *Server) UpdateTopicHandler(w http.ResponseWriter, r *http.Request) {
+	requester, topicId, _, ok := s.topicRequester(w, r, dba.TOPIC_ROLE_ADMIN)
+	if !ok {
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Read Payload", w)
+		return
+	}
+	change := topicChange{}
+	if err := json.Unmarshal(body, &change); err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Parse Payload", w)
+		return
+	}
+	topic := dba.Topic{Id: topicId}
+	updateables := []string{}
+	if change.Title != nil {
+		topic.Title = *change.Title
+		updateables = append(updateables, "title")
+	}
+	if change.Desc != nil {
+		topic.Desc = *change.Desc
+		updateables = append(updateables, "description")
+	}
+	if change.Visibility != nil {
+		if !dba.IsTopicVisibility(*change.Visibility) {
+			WriteReply(int(http.StatusBadRequest), false, "Unknown Visibility", w)
+			return
+		}
+		topic.Visibility = *change.Visibility
+		updateables = append(updateables, "visibility")
+	}
+	if change.Tags != nil {
+		if topic.Tags, err = normalizeTags(*change.Tags); err != nil {
+			WriteReply(int(http.StatusBadRequest), false, err.Error(), w)
+			return
+		}
+		updateables = append(updateables, "tags")
+	}
+	if len(updateables) == 0 {
+		WriteReply(int(http.StatusBadRequest), false, "Nothing to Update", w)
+		return
+	}
+	if err := s.Store.UpdateTopic(topic, updateables); err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	if topic.Visibility == dba.TOPIC_VISIBILITY_PRIVATE {
+		if err := s.revalidateSubscriptions(topicId, ""); err != nil {
+			s.Logger.Println("SUBSCRIPTION NOT REVALIDATED", topicId, err)
+		}
+	}
+	s.audit(requester.Id, dba.AUDIT_TOPIC_UPDATED, topicTarget(topicId), strings.Join(updateables, ","))
+	WriteReply(int(http.StatusOK), true, nil, w)
+	return
+}
+
+/**
+	Only the owner can delete. The topic is soft deleted, every route
+	treat it as missing afterward. Subscriber is removed so nothing is
+	published or delivered anymore but notification already sent is
+	kept in the inbox of its receiver
+*/
+func (s *Server) DeleteTopicHandler(w http.ResponseWriter, r *http.Request) {
+	requester, topicId, _, ok := s.topicRequester(w, r, dba.TOPIC_ROLE_OWNER)
+	if !ok {
+		return
+	}
+	topic := dba.Topic{Id: topicId, DeletedAt: time.Now().Unix()}
+	if err := s.Store.DeleteTopic(topic); err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Write Payload", w)
+		return
+	}
+	s.audit(requester.Id, dba.AUDIT_TOPIC_DELETED, topicTarget(topicId), "")
+	WriteReply(int(http.StatusOK), true, nil, w)
+	return
+}
+
+type topicSearchPage struct {
+	Topics dba.TopicStats `json:"topics"`
+	// Offset of the next page, zero when there is no more page
+	NextOffset int `json:"next_offset"`
+	HasMore bool `json:"has_more"`
+}
+
+var topicSearchOrders = map[string]string{
+	"newest": "id",
+	"subscribers": "subscriber_count",
+	"activity": "last_activity_at",
+}
+
+/**
+	Topic the requester can see, every public topic and any topic it is
+	a member of. Unlisted and private topic of other is never listed.
+	Site admin see every topic that is not deleted
+*/
+func (s *Server) visibleTopics(requester dba.UserProfile, qb *dba.QueryBuilder) (*dba.QueryBuilder, error) {
+	qb.Where("deleted_at", "=", 0)
+	if requester.Role == dba.USER_ROLE_ADMIN {
+		return qb, nil
+	}
+	memberQuery := dba.NewQueryBuilder().Select("topic_id").Where("user_id", "=", requester.Id)
+	topicMembers, err := s.Store.GetTopicMembers(memberQuery)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	topicIds := make([]interface{}, len(topicMembers))
+	for i := range topicMembers {
+		topicIds[i] = topicMembers[i].TopicId
+	}
+	return qb.Group(func(group *dba.QueryBuilder) {
+		group.Where("visibility", "=", dba.TOPIC_VISIBILITY_PUBLIC)
+		if len(topicIds) != 0 {
+			group.Or().In("id", topicIds...)
+		}
+	}), nil
+}
+
+// Id of topic having every tag, empty when none has
+func (s *Server) taggedTopicIds(tags []string) ([]interface{}, error) {
+	values := make([]interface{}, len(tags))
+	for i, tag := range tags {
+		values[i] = tag
+	}
+	topicTags, err := s.Store.GetTopicTags(dba.NewQueryBuilder().Select("topic_id").In("tag", values...))
+	if err == sql.ErrNoRows {
+		return []interface{}{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	matched := make(map[int]int)
+	for _, topicTag := range topicTags {
+		matched[topicTag.TopicId]++
+	}
+	topicIds := []interface{}{}
+	for topicId, count := range matched {
+		if count == len(tags) {
+			topicIds = append(topicIds, topicId)
+		}
+	}
+	return topicIds, nil
+}
+
+/**
+	Discover topic to subscribe. q match every word, ignoring case, against the title or
+	the description, tags is a comma separated list and the topic need all
+	of them. sort is newest, subscribers or activity, biggest first
+*/
+func (s *Server) SearchTopicHandler(w http.ResponseWriter, r *http.Request) {
+	requester, err := getRequesterProfile(r)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
+	}
+	query := r.URL.Query()
+	sort := query.Get("sort")
+	if len(sort) == 0 {
+		sort = "newest"
+	}
+	orderColumn, ok := topicSearchOrders[sort]
+	if !ok {
+		WriteReply(int(http.StatusBadRequest), false, "Unknown Sort", w)
+		return
+	}
+	qb, err := s.visibleTopics(requester, dba.NewQueryBuilder())
+	if err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	words := strings.Fields(query.Get("q"))
+	if len(words) > MAX_TOPIC_SEARCH_WORDS {
+		words = words[:MAX_TOPIC_SEARCH_WORDS]
+	}
+	for _, word := range words {
+		qb.Group(func(group *dba.QueryBuilder) {
+			group.Contains("title", word).Or().Contains("description", word)
+		})
+	}
+	page := topicSearchPage{Topics: dba.TopicStats{}}
+	if tagQuery := query.Get("tags"); len(tagQuery) != 0 {
+		tags, err := normalizeTags(strings.Split(tagQuery, ","))
+		if err != nil {
+			WriteReply(int(http.StatusBadRequest), false, err.Error(), w)
+			return
+		}
+		topicIds, err := s.taggedTopicIds(tags)
+		if err != nil {
+			s.Logger.Println(err)
+			WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+			return
+		}
+		if len(topicIds) == 0 {
+			WriteReply(int(http.StatusOK), true, page, w)
+			return
+		}
+		qb.In("id", topicIds...)
+	}
+	limit := queryInt(r, "limit", DEFAULT_TOPIC_SEARCH_LIMIT, MAX_TOPIC_SEARCH_LIMIT)
+	if limit == 0 {
+		limit = DEFAULT_TOPIC_SEARCH_LIMIT
+	}
+	offset := queryInt(r, "offset", 0, 0)
+	// One more row tell whether there is another page
+	qb.OrderBy(orderColumn, dba.ORDER_DESC).OrderBy("id", dba.ORDER_DESC).Limit(limit + 1).Offset(offset)
+	topicStats, err := s.Store.SearchTopics(qb)
+	if err == sql.ErrNoRows {
+		WriteReply(int(http.StatusOK), true, page, w)
+		return
+	}
+	if err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	if len(topicStats) > limit {
+		topicStats = topicStats[:limit]
+		page.NextOffset = offset + limit
+		page.HasMore = true
+	}
+	topicIds := make([]int, len(topicStats))
+	for i := range topicStats {
+		topicIds[i] = topicStats[i].Id
+	}
+	tags, err := s.topicTags(topicIds)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	for i := range topicStats {
+		topicStats[i].Tags = tags[topicStats[i].Id]
+	}
+	page.Topics = topicStats
+	WriteReply(int(http.StatusOK), true, page, w)
+	return
+}
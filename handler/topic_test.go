@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	dba "github.com/humamfauzi/go-notification/database"
+	"github.com/humamfauzi/go-notification/utils"
+)
+
+func getTopicDetail(t *testing.T, path, token string) topicDetail {
+	reply := serveRoute(testServer, http.MethodGet, path, "", token)
+	if reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	message, _ := json.Marshal(reply.Message)
+	detail := topicDetail{}
+	if err := json.Unmarshal(message, &detail); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	return detail
+}
+
+func TestTopicDetail(t *testing.T) {
+	randName := utils.RandomStringId("", 10)
+	owner, ownerToken := createUserOn(t, testServer, fmt.Sprintf("owner%v@asd.asd", randName), "rahasia")
+	admin, adminToken := createUserOn(t, testServer, fmt.Sprintf("admin%v@asd.asd", randName), "rahasia")
+	_, userToken := createUserOn(t, testServer, fmt.Sprintf("detail%v@asd.asd", randName), "rahasia")
+	topicId := createTopicOn(t, testServer, owner, ownerToken)
+	path := fmt.Sprintf("/topics/%d", topicId)
+	notification := fmt.Sprintf(`{"topic_id": %d, "message": "hello"}`, topicId)
+
+	if reply := serveRoute(testServer, http.MethodPost, "/subscribe", fmt.Sprintf(`{"topic_id": %d}`, topicId), userToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	invite := fmt.Sprintf(`{"user_id": "%v", "role": "%v"}`, admin.Id, dba.TOPIC_ROLE_ADMIN)
+	if reply := serveRoute(testServer, http.MethodPost, path + "/members", invite, ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	detail := getTopicDetail(t, path, userToken)
+	if detail.Id != topicId || detail.Title != "member topic" || detail.SubscriberCount != 1 || detail.MemberCount != 2 || detail.Role != dba.TOPIC_ROLE_SUBSCRIBER {
+		t.Fatalf("want topic with 1 subscriber and 2 member get %v", detail)
+	}
+
+	if reply := serveRoute(testServer, http.MethodPatch, path, `{"title": "renamed"}`, userToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("want %v get %v", http.StatusForbidden, reply)
+	}
+	for _, change := range []string{`{}`, `{"visibility": "secret"}`} {
+		if reply := serveRoute(testServer, http.MethodPatch, path, change, adminToken); reply.Code != http.StatusBadRequest {
+			t.Fatalf("want %v get %v for %v", http.StatusBadRequest, reply, change)
+		}
+	}
+	if reply := serveRoute(testServer, http.MethodPatch, path, `{"title": "renamed", "visibility": "private"}`, adminToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	detail = getTopicDetail(t, path, ownerToken)
+	if detail.Title != "renamed" || detail.Visibility != dba.TOPIC_VISIBILITY_PRIVATE || detail.UserId != owner.Id || detail.Role != dba.TOPIC_ROLE_OWNER {
+		t.Fatalf("want renamed private topic get %v", detail)
+	}
+	// private topic is hidden from non member and its subscription is dropped
+	if reply := serveRoute(testServer, http.MethodGet, path, "", userToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("want %v get %v", http.StatusForbidden, reply)
+	}
+	if detail.SubscriberCount != 0 {
+		t.Fatalf("want 0 get %v", detail.SubscriberCount)
+	}
+
+	if reply := serveRoute(testServer, http.MethodPost, "/subscribe", fmt.Sprintf(`{"topic_id": %d}`, topicId), ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodPost, "/notification", notification, ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodDelete, path, "", adminToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("want %v get %v", http.StatusForbidden, reply)
+	}
+	if reply := serveRoute(testServer, http.MethodDelete, path, "", ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPatch, http.MethodDelete} {
+		if reply := serveRoute(testServer, method, path, `{"title": "again"}`, ownerToken); reply.Code != http.StatusNotFound {
+			t.Fatalf("want %v get %v for %v", http.StatusNotFound, reply, method)
+		}
+	}
+	if reply := serveRoute(testServer, http.MethodPost, "/notification", notification, ownerToken); reply.Code != http.StatusForbidden {
+		t.Fatalf("want %v get %v", http.StatusForbidden, reply)
+	}
+	reply := serveRoute(testServer, http.MethodGet, "/topics", "", ownerToken)
+	if reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	for _, topic := range reply.Message.([]interface{}) {
+		if int(topic.(map[string]interface{})["id"].(float64)) == topicId {
+			t.Fatalf("deleted topic should not be listed get %v", reply)
+		}
+	}
+	if count, err := testServer.Store.CountSubscribers(topicId); err != nil || count != 0 {
+		t.Fatalf("want 0 subscriber get %v %v", count, err)
+	}
+	// notification already sent is kept
+	inbox := dba.NewQueryBuilder().Where("user_id", "=", owner.Id).Where("topic_id", "=", topicId)
+	if countNotification(testServer, inbox) != 1 {
+		t.Fatalf("want 1 notification get %v", countNotification(testServer, inbox))
+	}
+}
+
+func searchTopics(t *testing.T, path, token string) topicSearchPage {
+	reply := serveRoute(testServer, http.MethodGet, path, "", token)
+	if reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	message, _ := json.Marshal(reply.Message)
+	page := topicSearchPage{}
+	if err := json.Unmarshal(message, &page); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	return page
+}
+
+func searchedIds(page topicSearchPage) []int {
+	topicIds := []int{}
+	for _, topicStat := range page.Topics {
+		topicIds = append(topicIds, topicStat.Id)
+	}
+	return topicIds
+}
+
+func TestTopicSearch(t *testing.T) {
+	randName := utils.RandomStringId("", 10)
+	word := strings.ToLower(strings.TrimPrefix(randName, "/"))
+	owner, ownerToken := createUserOn(t, testServer, fmt.Sprintf("owner%v@asd.asd", randName), "rahasia")
+	_, userToken := createUserOn(t, testServer, fmt.Sprintf("search%v@asd.asd", randName), "rahasia")
+	_, otherToken := createUserOn(t, testServer, fmt.Sprintf("other%v@asd.asd", randName), "rahasia")
+	topics := []string{
+		fmt.Sprintf(`{"title": "alpha %v", "description": "first", "tags": ["%v", "News"]}`, word, word),
+		fmt.Sprintf(`{"title": "beta %v", "description": "alpha inside", "tags": ["%v"]}`, word, word),
+		fmt.Sprintf(`{"title": "alpha %v hidden", "visibility": "unlisted", "tags": ["%v"]}`, word, word),
+		fmt.Sprintf(`{"title": "alpha %v secret", "visibility": "private", "tags": ["%v"]}`, word, word),
+	}
+	for _, topic := range topics {
+		if reply := serveRoute(testServer, http.MethodPost, "/topics", topic, ownerToken); reply.Code != http.StatusOK {
+			t.Fatalf("want 200 get %v", reply)
+		}
+	}
+	if reply := serveRoute(testServer, http.MethodPost, "/topics", `{"title": "bad", "tags": ["not a tag"]}`, ownerToken); reply.Code != http.StatusBadRequest {
+		t.Fatalf("want %v get %v", http.StatusBadRequest, reply)
+	}
+	qb := dba.NewQueryBuilder().Where("user_id", "=", owner.Id).OrderBy("id", dba.ORDER_ASC)
+	stored, err := testServer.Store.GetTopics(qb)
+	if err != nil || len(stored) != 4 {
+		t.Fatalf("want 4 topic get %v %v", stored, err)
+	}
+	alpha, beta, unlisted, private := stored[0].Id, stored[1].Id, stored[2].Id, stored[3].Id
+
+	// beta get two subscriber, alpha get the latest notification
+	subscribe := func(topicId int, token string) {
+		if reply := serveRoute(testServer, http.MethodPost, "/subscribe", fmt.Sprintf(`{"topic_id": %d}`, topicId), token); reply.Code != http.StatusOK {
+			t.Fatalf("want 200 get %v", reply)
+		}
+	}
+	subscribe(beta, userToken)
+	subscribe(beta, otherToken)
+	subscribe(alpha, userToken)
+	notification := fmt.Sprintf(`{"topic_id": %d, "message": "hello"}`, alpha)
+	if reply := serveRoute(testServer, http.MethodPost, "/notification", notification, ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+
+	cases := []struct {
+		path string
+		want []int
+	}{
+		{"/topics/search?q=" + word, []int{beta, alpha}},
+		{"/topics/search?q=alpha+" + word, []int{beta, alpha}},
+		{"/topics/search?q=beta+" + word, []int{beta}},
+		// case does not matter, wildcard only match itself
+		{"/topics/search?q=ALPHA+" + strings.ToUpper(word), []int{beta, alpha}},
+		{"/topics/search?q=Beta+" + word, []int{beta}},
+		{"/topics/search?q=_+" + word, []int{}},
+		{"/topics/search?q=al%25a+" + word, []int{}},
+		{"/topics/search?sort=subscribers&q=" + word, []int{beta, alpha}},
+		{"/topics/search?sort=activity&q=" + word, []int{alpha, beta}},
+		{"/topics/search?tags=" + word, []int{beta, alpha}},
+		{"/topics/search?tags=news," + strings.ToUpper(word), []int{alpha}},
+		{"/topics/search?tags=nothing-" + word, []int{}},
+	}
+	for _, c := range cases {
+		page := searchTopics(t, c.path, userToken)
+		if fmt.Sprint(searchedIds(page)) != fmt.Sprint(c.want) || page.HasMore {
+			t.Fatalf("want %v get %v for %v", c.want, page, c.path)
+		}
+	}
+	// tag come back sorted
+	tags := []string{"news", word}
+	sort.Strings(tags)
+	page := searchTopics(t, "/topics/search?sort=activity&q=" + word, userToken)
+	if fmt.Sprint(page.Topics[0].Tags) != fmt.Sprint(tags) || page.Topics[0].LastActivityAt == 0 || page.Topics[1].SubscriberCount != 2 {
+		t.Fatalf("want tags and activity get %v", page)
+	}
+
+	page = searchTopics(t, "/topics/search?limit=1&q=" + word, userToken)
+	if fmt.Sprint(searchedIds(page)) != fmt.Sprint([]int{beta}) || !page.HasMore || page.NextOffset != 1 {
+		t.Fatalf("want first page get %v", page)
+	}
+	page = searchTopics(t, "/topics/search?limit=1&offset=1&q=" + word, userToken)
+	if fmt.Sprint(searchedIds(page)) != fmt.Sprint([]int{alpha}) || page.HasMore || page.NextOffset != 0 {
+		t.Fatalf("want last page get %v", page)
+	}
+
+	// member see its unlisted and private topic
+	page = searchTopics(t, "/topics/search?q=" + word, ownerToken)
+	if fmt.Sprint(searchedIds(page)) != fmt.Sprint([]int{private, unlisted, beta, alpha}) {
+		t.Fatalf("want every topic get %v", page)
+	}
+	for _, path := range []string{"/topics/search?sort=oldest", "/topics/search?tags=not+a+tag"} {
+		if reply := serveRoute(testServer, http.MethodGet, path, "", userToken); reply.Code != http.StatusBadRequest {
+			t.Fatalf("want %v get %v for %v", http.StatusBadRequest, reply, path)
+		}
+	}
+
+	if reply := serveRoute(testServer, http.MethodPatch, fmt.Sprintf("/topics/%d", alpha), `{"tags": []}`, ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if page := searchTopics(t, "/topics/search?tags=" + word, userToken); fmt.Sprint(searchedIds(page)) != fmt.Sprint([]int{beta}) {
+		t.Fatalf("want %v get %v", beta, page)
+	}
+	if detail := getTopicDetail(t, fmt.Sprintf("/topics/%d", alpha), userToken); detail.Tags == nil || len(detail.Tags) != 0 {
+		t.Fatalf("want no tag get %v", detail)
+	}
+	if reply := serveRoute(testServer, http.MethodDelete, fmt.Sprintf("/topics/%d", beta), "", ownerToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if page := searchTopics(t, "/topics/search?q=" + word, userToken); fmt.Sprint(searchedIds(page)) != fmt.Sprint([]int{alpha}) {
+		t.Fatalf("deleted topic should not be found get %v", page)
+	}
+}
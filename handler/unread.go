@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	dba "github.com/humamfauzi/go-notification/database"
+)
+
+const (
+	UNREAD_CACHE_SIZE = 10000
+	UNREAD_CACHE_TTL = time.Minute
+)
+
+/**
+	Unread count per user and topic. A user is loaded from the aggregate
+	query the first time its summary is asked, after that every insert,
+	read and delete of this server adjust it so the query is not run again.
+	Write from another process is only seen once the user is older than
+	ttl and loaded again, the cache live in one Server. At most size user
+	is kept, an arbitrary one is evicted to make room and is loaded again
+	on its next summary
+*/
+type unreadCache struct {
+	mutex sync.Mutex
+	size int
+	ttl time.Duration
+	counts map[string]map[int]int
+	loadedAt map[string]time.Time
+	// Only user being loaded is tracked, so a load racing a change is not kept
+	loading map[string]*unreadLoad
+	now func() time.Time
+}
+
+type unreadLoad struct {
+	loaders int
+	changes int
+}
+
+func newUnreadCache(size int, ttl time.Duration) *unreadCache {
+	return &unreadCache{
+		size: size,
+		ttl: ttl,
+		counts: make(map[string]map[int]int),
+		loadedAt: make(map[string]time.Time),
+		loading: make(map[string]*unreadLoad),
+		now: time.Now,
+	}
+}
+
+func (uc *unreadCache) summary(userId string, load func() (dba.UnreadCounts, error)) (unreadSummary, error) {
+	uc.mutex.Lock()
+	if counts, ok := uc.counts[userId]; ok {
+		if uc.now().Sub(uc.loadedAt[userId]) < uc.ttl {
+			defer uc.mutex.Unlock()
+			return newUnreadSummary(counts), nil
+		}
+		uc.drop(userId)
+	}
+	loading, ok := uc.loading[userId]
+	if !ok {
+		loading = &unreadLoad{}
+		uc.loading[userId] = loading
+	}
+	loading.loaders++
+	version := loading.changes
+	uc.mutex.Unlock()
+
+	unreadCounts, err := load()
+
+	uc.mutex.Lock()
+	defer uc.mutex.Unlock()
+	loading.loaders--
+	if loading.loaders == 0 {
+		delete(uc.loading, userId)
+	}
+	if err != nil {
+		return unreadSummary{}, err
+	}
+	counts := make(map[int]int)
+	for _, unreadCount := range unreadCounts {
+		counts[unreadCount.TopicId] = unreadCount.Count
+	}
+	if loading.changes == version {
+		uc.keep(userId, counts)
+	}
+	return newUnreadSummary(counts), nil
+}
+
+// Caller hold the mutex
+func (uc *unreadCache) keep(userId string, counts map[int]int) {
+	if _, ok := uc.counts[userId]; !ok && len(uc.counts) >= uc.size {
+		for evicted := range uc.counts {
+			uc.drop(evicted)
+			break
+		}
+	}
+	uc.counts[userId] = counts
+	uc.loadedAt[userId] = uc.now()
+}
+
+// Caller hold the mutex
+func (uc *unreadCache) drop(userId string) {
+	delete(uc.counts, userId)
+	delete(uc.loadedAt, userId)
+}
+
+// Delta is added to the topic of every notification, user not loaded yet is skipped
+func (uc *unreadCache) add(notifications dba.Notifications, delta int) {
+	uc.mutex.Lock()
+	defer uc.mutex.Unlock()
+	for _, notification := range notifications {
+		if loading, ok := uc.loading[notification.UserId]; ok {
+			loading.changes++
+		}
+		counts, ok := uc.counts[notification.UserId]
+		if !ok {
+			continue
+		}
+		counts[notification.TopicId] += delta
+		if counts[notification.TopicId] <= 0 {
+			delete(counts, notification.TopicId)
+		}
+	}
+}
+
+func (uc *unreadCache) inserted(notifications dba.Notifications) {
+	uc.add(notifications, 1)
+}
+
+// Only pass notification that was unread before
+func (uc *unreadCache) read(notifications dba.Notifications) {
+	uc.add(notifications, -1)
+}
+
+func (uc *unreadCache) deleted(notifications dba.Notifications) {
+	unread := dba.Notifications{}
+	for _, notification := range notifications {
+		if !notification.IsRead {
+			unread = append(unread, notification)
+		}
+	}
+	uc.add(unread, -1)
+}
+
+/**
+	Bulk read and delete only know how many row is touched, not which
+	topic, so the user is dropped and loaded again on its next summary
+*/
+func (uc *unreadCache) forget(userId string) {
+	uc.mutex.Lock()
+	defer uc.mutex.Unlock()
+	if loading, ok := uc.loading[userId]; ok {
+		loading.changes++
+	}
+	uc.drop(userId)
+}
+
+type unreadSummary struct {
+	Total int `json:"total"`
+	Topics dba.UnreadCounts `json:"topics"`
+}
+
+func newUnreadSummary(counts map[int]int) unreadSummary {
+	summary := unreadSummary{Topics: dba.UnreadCounts{}}
+	for topicId, count := range counts {
+		summary.Total += count
+		summary.Topics = append(summary.Topics, dba.UnreadCount{TopicId: topicId, Count: count})
+	}
+	sort.Slice(summary.Topics, func(i, j int) bool {
+		return summary.Topics[i].TopicId < summary.Topics[j].TopicId
+	})
+	return summary
+}
+
+// Badge number for the app, total unread and unread per topic
+func (s *Server) GetNotificationSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	requester, err := getRequesterProfile(r)
+	if err != nil {
+		WriteReply(int(http.StatusBadRequest), false, "Cannot identify requester", w)
+		return
+	}
+	summary, err := s.unread.summary(requester.Id, func() (dba.UnreadCounts, error) {
+		return s.Store.CountUnreadNotifications(requester.Id)
+	})
+	if err != nil {
+		s.Logger.Println(err)
+		WriteReply(int(http.StatusBadRequest), false, "Cannot Get Payload", w)
+		return
+	}
+	WriteReply(int(http.StatusOK), true, summary, w)
+	return
+}
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	dba "github.com/humamfauzi/go-notification/database"
+	"github.com/humamfauzi/go-notification/utils"
+)
+
+func getUnreadSummary(t *testing.T, token string) unreadSummary {
+	reply := serveRoute(testServer, http.MethodGet, "/notification/summary", "", token)
+	if reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	message, _ := json.Marshal(reply.Message)
+	summary := unreadSummary{}
+	if err := json.Unmarshal(message, &summary); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	return summary
+}
+
+func TestNotificationSummary(t *testing.T) {
+	randName := utils.RandomStringId("", 10)
+	owner, ownerToken := createUserOn(t, testServer, fmt.Sprintf("owner%v@asd.asd", randName), "rahasia")
+	user, userToken := createUserOn(t, testServer, fmt.Sprintf("badge%v@asd.asd", randName), "rahasia")
+	topicIds := createTopicsOn(t, testServer, owner, ownerToken, 2)
+	publish := func(topicId int) {
+		notification := fmt.Sprintf(`{"topic_id": %d, "message": "hello"}`, topicId)
+		if reply := serveRoute(testServer, http.MethodPost, "/notification", notification, ownerToken); reply.Code != http.StatusOK {
+			t.Fatalf("want 200 get %v", reply)
+		}
+	}
+	// the cache should always agree with the aggregate query
+	check := func(total int, topics dba.UnreadCounts) {
+		summary := getUnreadSummary(t, userToken)
+		if summary.Total != total || fmt.Sprint(summary.Topics) != fmt.Sprint(topics) {
+			t.Fatalf("want %v %v get %v", total, topics, summary)
+		}
+		counted, err := testServer.Store.CountUnreadNotifications(user.Id)
+		if err != nil || fmt.Sprint(counted) != fmt.Sprint(topics) {
+			t.Fatalf("want %v get %v %v", topics, counted, err)
+		}
+	}
+
+	if summary := getUnreadSummary(t, userToken); summary.Total != 0 || summary.Topics == nil || len(summary.Topics) != 0 {
+		t.Fatalf("want empty summary get %v", summary)
+	}
+	for _, topicId := range topicIds {
+		if reply := serveRoute(testServer, http.MethodPost, "/subscribe", fmt.Sprintf(`{"topic_id": %d}`, topicId), userToken); reply.Code != http.StatusOK {
+			t.Fatalf("want 200 get %v", reply)
+		}
+	}
+	publish(topicIds[0])
+	publish(topicIds[0])
+	publish(topicIds[1])
+	check(3, dba.UnreadCounts{{TopicId: topicIds[0], Count: 2}, {TopicId: topicIds[1], Count: 1}})
+	if _, ok := testServer.unread.counts[user.Id]; !ok {
+		t.Fatalf("summary should be cached")
+	}
+
+	// the owner is not subscribed, nothing is counted for it
+	if summary := getUnreadSummary(t, ownerToken); summary.Total != 0 {
+		t.Fatalf("want 0 get %v", summary)
+	}
+
+	qb := dba.NewQueryBuilder().Where("user_id", "=", user.Id).OrderBy("id", dba.ORDER_ASC)
+	inbox, err := testServer.Store.GetNotifications(qb)
+	if err != nil || len(inbox) != 3 {
+		t.Fatalf("want 3 notification get %v %v", inbox, err)
+	}
+	read := fmt.Sprintf(`{"ids": [%d]}`, inbox[0].Id)
+	if reply := serveRoute(testServer, http.MethodPost, "/notification/read", read, userToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	// acknowledging an already read notification does not count twice
+	if err := testServer.markNotificationRead(user.Id, []int{inbox[0].Id, inbox[1].Id}); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	check(1, dba.UnreadCounts{{TopicId: topicIds[1], Count: 1}})
+
+	publish(topicIds[0])
+	check(2, dba.UnreadCounts{{TopicId: topicIds[0], Count: 1}, {TopicId: topicIds[1], Count: 1}})
+
+	if reply := serveRoute(testServer, http.MethodDelete, fmt.Sprintf("/notification/%d", inbox[0].Id), "", userToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if reply := serveRoute(testServer, http.MethodDelete, fmt.Sprintf("/notification/%d", inbox[2].Id), "", userToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	check(1, dba.UnreadCounts{{TopicId: topicIds[0], Count: 1}})
+
+	// bulk read does not know the topic, the user is loaded again
+	if reply := serveRoute(testServer, http.MethodPost, "/notification/read", `{"all": true}`, userToken); reply.Code != http.StatusOK {
+		t.Fatalf("want 200 get %v", reply)
+	}
+	if _, ok := testServer.unread.counts[user.Id]; ok {
+		t.Fatalf("summary should be forgotten")
+	}
+	check(0, dba.UnreadCounts{})
+
+	// read by another request between select and update is not counted twice
+	publish(topicIds[1])
+	check(1, dba.UnreadCounts{{TopicId: topicIds[1], Count: 1}})
+	unread, err := testServer.Store.GetNotifications(dba.NewQueryBuilder().Where("user_id", "=", user.Id).Where("is_read", "=", false))
+	if err != nil || len(unread) != 1 {
+		t.Fatalf("want 1 unread get %v %v", unread, err)
+	}
+	if updated, err := testServer.Store.UpdateReadNotification(unread); err != nil || updated != 1 {
+		t.Fatalf("want 1 get %v %v", updated, err)
+	}
+	if updated, err := testServer.readNotifications(user.Id, unread); err != nil || updated != 0 {
+		t.Fatalf("want 0 get %v %v", updated, err)
+	}
+	check(0, dba.UnreadCounts{})
+}
+
+func TestUnreadCacheBounded(t *testing.T) {
+	cache := newUnreadCache(2, time.Minute)
+	loaded := func(count int) func() (dba.UnreadCounts, error) {
+		return func() (dba.UnreadCounts, error) {
+			return dba.UnreadCounts{{TopicId: 1, Count: count}}, nil
+		}
+	}
+
+	// user nobody asked about is not tracked at all
+	cache.inserted(dba.Notifications{{UserId: "user/a", TopicId: 1}, {UserId: "user/b", TopicId: 1}})
+	if len(cache.counts) != 0 || len(cache.loading) != 0 {
+		t.Fatalf("want nothing tracked get %v %v", cache.counts, cache.loading)
+	}
+
+	for _, userId := range []string{"user/a", "user/b", "user/c"} {
+		if summary, err := cache.summary(userId, loaded(3)); err != nil || summary.Total != 3 {
+			t.Fatalf("want 3 get %v %v", summary, err)
+		}
+	}
+	if _, ok := cache.counts["user/c"]; !ok || len(cache.counts) != 2 {
+		t.Fatalf("want 2 user with the newest kept get %v", cache.counts)
+	}
+
+	// insert that land while loading make the loaded count stale
+	racing := func() (dba.UnreadCounts, error) {
+		cache.inserted(dba.Notifications{{UserId: "user/d", TopicId: 1}})
+		return loaded(1)()
+	}
+	if summary, err := cache.summary("user/d", racing); err != nil || summary.Total != 1 {
+		t.Fatalf("want 1 get %v %v", summary, err)
+	}
+	if _, ok := cache.counts["user/d"]; ok || len(cache.loading) != 0 {
+		t.Fatalf("stale load should not be kept get %v %v", cache.counts, cache.loading)
+	}
+}
+
+func TestUnreadCacheExpire(t *testing.T) {
+	now := time.Now()
+	cache := newUnreadCache(2, time.Minute)
+	cache.now = func() time.Time { return now }
+	// count changed by another instance is only in the database
+	stored := 3
+	load := func() (dba.UnreadCounts, error) {
+		return dba.UnreadCounts{{TopicId: 1, Count: stored}}, nil
+	}
+	if summary, err := cache.summary("user/a", load); err != nil || summary.Total != 3 {
+		t.Fatalf("want 3 get %v %v", summary, err)
+	}
+	stored = 5
+	now = now.Add(time.Minute - time.Second)
+	if summary, err := cache.summary("user/a", load); err != nil || summary.Total != 3 {
+		t.Fatalf("want cached 3 get %v %v", summary, err)
+	}
+	now = now.Add(time.Second)
+	if summary, err := cache.summary("user/a", load); err != nil || summary.Total != 5 {
+		t.Fatalf("want reloaded 5 get %v %v", summary, err)
+	}
+	if len(cache.counts) != 1 || len(cache.loadedAt) != 1 {
+		t.Fatalf("want only user/a kept get %v %v", cache.counts, cache.loadedAt)
+	}
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+
+	dba "github.com/humamfauzi/go-notification/database"
+	"github.com/humamfauzi/go-notification/queue"
+	"github.com/humamfauzi/go-notification/webhook"
+)
+
+const (
+	WEBHOOK_CHANNEL = "webhook"
+)
+
+/**
+	Callback inside our own network, loopback, private or link-local, is
+	refused so a subscriber cannot make the server call it. The sender
+	check the address again on every delivery
+*/
+func (s *Server) validateCallbackUrl(callbackUrl string) error {
+	parsed, err := url.Parse(callbackUrl)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return errors.New("Callback URL should use http or https")
+	}
+	if len(parsed.Hostname()) == 0 {
+		return errors.New("Callback URL should have a host")
+	}
+	err = s.webhookSender.CheckHost(parsed.Hostname())
+	if errors.Is(err, webhook.ErrPrivateAddress) {
+		return errors.New("Callback URL should be a public address")
+	}
+	if err != nil {
+		return errors.New("Callback URL host cannot be resolved")
+	}
+	return nil
+}
+
+func (s *Server) recordDeliveryAttempt(job dba.DeliveryJob, callbackUrl string, attempt webhook.Attempt) {
+	deliveryAttempt := dba.DeliveryAttempt{
+		SubscriberId: job.SubscriberId,
+		NotificationId: job.NotificationId,
+		Url: callbackUrl,
+		Attempt: job.Attempts,
+		StatusCode: attempt.StatusCode,
+	}
+	if attempt.Err != nil {
+		deliveryAttempt.Error = attempt.Err.Error()
+	}
+	if _, err := deliveryAttempt.Insert(s.DB); err != nil {
+		s.Logger.Println("WEBHOOK ATTEMPT NOT RECORDED", job.SubscriberId, job.NotificationId, err)
+	}
+}
+
+/**
+	Subscriber is read on every attempt so a changed or removed callback
+	URL apply to job that is still waiting in the queue
+*/
+func (s *Server) deliverWebhookJob(job dba.DeliveryJob) error {
+	qb := dba.NewQueryBuilder().Where("id", "=", job.SubscriberId)
+	subscribers, err := s.Store.GetSubscribers(qb)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	subscriber := subscribers[0]
+	if len(subscriber.CallbackUrl) == 0 {
+		return nil
+	}
+	delivery := webhook.Delivery{
+		Url: subscriber.CallbackUrl,
+		Secret: subscriber.Secret,
+		Payload: []byte(job.Payload),
+	}
+	attempt := s.webhookSender.Post(delivery)
+	s.recordDeliveryAttempt(job, subscriber.CallbackUrl, attempt)
+	return attempt.Err
+}
+
+/**
+	Start the worker of the durable delivery queue. Every channel outside
+	the database, currently only webhook, is delivered through it
+*/
+func (s *Server) StartDeliveryQueue() func() {
+	if s.DB == nil {
+		s.Logger.Println("NO DATABASE, DELIVERY QUEUE NOT STARTED")
+		return func() {}
+	}
+	s.deliveryQueue = queue.NewQueue(s.DB)
+	s.deliveryQueue.Register(WEBHOOK_CHANNEL, s.deliverWebhookJob)
+	stop := make(chan struct{})
+	go s.deliveryQueue.Run(stop)
+	return func() {
+		close(stop)
+	}
+}
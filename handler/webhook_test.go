@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	dba "github.com/humamfauzi/go-notification/database"
+)
+
+// No DNS in test, localhost and host with internal in it resolve to a private address
+func fakeLookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IPAddr{{IP: ip}}, nil
+	}
+	if host == "localhost" {
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+	}
+	if strings.Contains(host, "internal") {
+		return []net.IPAddr{{IP: net.ParseIP("10.0.0.5")}}, nil
+	}
+	return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}}, nil
+}
+
+func TestValidateCallbackUrl(t *testing.T) {
+	server := NewServer(dba.NewMemoryStore())
+	server.webhookSender.LookupIPAddr = fakeLookupIPAddr
+	valid := []string{
+		"http://example.com/hook",
+		"https://example.com:8443/hook?source=notification",
+	}
+	for _, callbackUrl := range valid {
+		if err := server.validateCallbackUrl(callbackUrl); err != nil {
+			t.Fatalf("%v should be valid %v", callbackUrl, err)
+		}
+	}
+	invalid := []string{
+		"ftp://example.com/hook",
+		"example.com/hook",
+		"https:///hook",
+		"://",
+		"http://localhost/hook",
+		"http://127.0.0.1:8080/hook",
+		"http://10.0.0.1/hook",
+		"http://192.168.1.10/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"https://internal.example.com/hook",
+	}
+	for _, callbackUrl := range invalid {
+		if err := server.validateCallbackUrl(callbackUrl); err == nil {
+			t.Fatalf("%v should be invalid", callbackUrl)
+		}
+	}
+}
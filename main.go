@@ -1,67 +1,156 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"sort"
 	"time"
 
-	"github.com/gorilla/mux"
+	"github.com/humamfauzi/go-notification/auth"
 	dba "github.com/humamfauzi/go-notification/database"
 	"github.com/humamfauzi/go-notification/handler"
 )
 
 const (
-	queryMapDir = "database/queryMap.json"
+	queryMapDir = "database/"
 )
 
-func main() {
-	connProp := dba.MysqlDatabaseAccess{
-		Username: "root",
-		Password: "",
-		Protocol: "tcp",
-		Address: "localhost",
-		DBName: "try1",
+/**
+	Database is picked at startup, its query map follow
+	so every query is written in the right dialect
+*/
+func databaseProfile(env Environement) handler.DbConnection {
+	switch env.DatabaseDialect() {
+	case dba.DIALECT_POSTGRES:
+		return dba.PostgresDatabaseAccess{
+			Username: "postgres",
+			Password: "",
+			Address: "localhost:5432",
+			DBName: "try1",
+		}
+	case dba.DIALECT_SQLITE:
+		return dba.SqliteDatabaseAccess{
+			Path: "try1.db",
+		}
+	default:
+		return dba.MysqlDatabaseAccess{
+			Username: "root",
+			Password: "",
+			Protocol: "tcp",
+			Address: "localhost",
+			DBName: "try1",
+		}
+	}
+}
+
+/**
+	Connect the database and check the schema. Return false when
+	the process should stop, e.g after a migrate command
+*/
+func startDatabase(env Environement) (dba.ITransactionSQL, bool) {
+	connDB, err := handler.ConnectDatabase(databaseProfile(env), queryMapDir)
+	if err != nil {
+		log.Fatal("Failed to connect database ", err)
 	}
-	connDB, err := connProp.ConnectDatabase()
+	migrator, err := dba.NewMigrator(connDB, dba.MigrationDirectory(migrationBaseDir))
 	if err != nil {
-		panic(err)
+		log.Fatal("Failed to load migration ", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(migrator, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		connDB.Close()
+		return nil, false
 	}
-	defer connDB.Close()
-	if err := dba.ConvertJsonToQueryMap(queryMapDir); err != nil {
-		panic("Failed to read query map")
+	if err := migrator.EnsureCurrent(); err != nil {
+		log.Fatal(err, ", run migrate up first")
 	}
 	log.Println("OK")
-	
-	log.Println("Init server")
-	router := mux.NewRouter()
-	router.Use(handler.LoggerMiddleware)
-
-	router.HandleFunc("/user", handler.CreateUserHandler).Methods(http.MethodPost)
-
-	loginHandler := handler.LoginOps{}
-	router.Handle("/user/login", loginHandler).Methods(http.MethodPost)
-
-	checkLoginHandler := handler.CheckLogin{}
-	router.Handle("/user/check", checkLoginHandler).Methods(http.MethodPost)
+	return connDB, true
+}
 
-	router.HandleFunc("/user", handler.UpdateUserHandler).Methods(http.MethodPut)
-	router.HandleFunc("/user", handler.DeleteUserHandler).Methods(http.MethodPut)
+/**
+	Signing key from the environment, nil when none is set so the
+	server keep the default HS256 secret
+*/
+func authKeys(env Environement) (*auth.KeySet, error) {
+	var signing auth.Key
+	var err error
+	switch {
+	case len(env.JWTSigningKey()) != 0:
+		signing, err = auth.ParseKey(env.JWTSigningKeyId(), []byte(env.JWTSigningKey()))
+	case len(env.JWTSigningKeyFile()) != 0:
+		signing, err = auth.LoadKey(env.JWTSigningKeyId(), env.JWTSigningKeyFile())
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	verifying := []auth.Key{}
+	// token from before the switch has no kid and is signed with the secret
+	if !env.JWTRetireSecret() {
+		if len(signing.Id) == 0 {
+			return nil, errors.New("JWT_SIGNING_KEY_ID is needed while the HS256 secret is not retired")
+		}
+		verifying = append(verifying, auth.VerifySecretKey("", auth.GetAuthSecret()))
+	}
+	// map order is random, sorted so JWKS list the keys the same on every start
+	files := env.JWTVerifyKeyFiles()
+	kids := make([]string, 0, len(files))
+	for kid := range files {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	for _, kid := range kids {
+		key, err := auth.LoadKey(kid, files[kid])
+		if err != nil {
+			return nil, err
+		}
+		verifying = append(verifying, key)
+	}
+	return auth.NewKeySet(signing, verifying...)
+}
 
-	router.HandleFunc("/topics", handler.CreateTopicHandler).Methods(http.MethodPost)
-	router.HandleFunc("/topics", handler.GetTopicHandler).Methods(http.MethodGet)
-	router.HandleFunc("/subscribe", handler.CreateSubscribeHandler).Methods(http.MethodPost)
+func main() {
+	env := Environement("")
+	var server *handler.Server
+	// GO_ENV=test keep everything in memory, no database and no delivery queue
+	if env.IsTest() {
+		server = handler.NewServer(dba.NewMemoryStore())
+	} else {
+		connDB, ok := startDatabase(env)
+		if !ok {
+			return
+		}
+		defer connDB.Close()
+		server = handler.NewServer(dba.NewSQLStore(connDB))
+		server.DB = connDB
+	}
 
-	createNotificationHandler := handler.CreateNotification{}
-	router.Handle("/notification", createNotificationHandler).Methods(http.MethodPost)
-	router.HandleFunc("/notification", handler.GetNotificationHandler).Methods(http.MethodGet)
+	keys, err := authKeys(env)
+	if err != nil {
+		log.Fatal("Failed to load JWT key ", err)
+	}
+	if keys != nil {
+		server.Keys = keys
+	}
 
+	stopDeliveryQueue := server.StartDeliveryQueue()
+	defer stopDeliveryQueue()
 
-	server := &http.Server{
-		Handler:      router,
+	log.Println("Init server")
+	// WriteTimeout is not set because it would cut the long lived
+	// /notification/events stream after the timeout passed
+	httpServer := &http.Server{
+		Handler:      server.Routes(),
 		Addr:         "127.0.0.1:8000",
-		WriteTimeout: 15 * time.Second,
 		ReadTimeout:  15 * time.Second,
+		IdleTimeout:  60 * time.Second,
 	}
 	log.Println("Server working")
-	log.Fatal(server.ListenAndServe())
+	log.Fatal(httpServer.ListenAndServe())
 }
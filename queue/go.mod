@@ -0,0 +1,7 @@
+module github.com/humamfauzi/go-notification/queue
+
+go 1.15
+
+require github.com/humamfauzi/go-notification/database v0.0.0-00010101000000-000000000000
+
+replace github.com/humamfauzi/go-notification/database => ../database
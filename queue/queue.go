@@ -0,0 +1,296 @@
+package queue
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	mrand "math/rand"
+	"time"
+
+	dba "github.com/humamfauzi/go-notification/database"
+)
+
+const (
+	DEFAULT_VISIBILITY_TIMEOUT = time.Minute
+	DEFAULT_MAX_ATTEMPTS = 8
+	DEFAULT_BATCH_SIZE = 16
+	DEFAULT_POLL_INTERVAL = time.Second
+	DEFAULT_BASE_DELAY = 5 * time.Second
+	DEFAULT_MAX_DELAY = time.Hour
+)
+
+var (
+	ErrUnknownChannel = errors.New("NO HANDLER REGISTERED FOR CHANNEL")
+)
+
+// Handler deliver a single job, returning an error schedule a retry
+type Handler func(job dba.DeliveryJob) error
+
+/**
+	Queue is a durable job queue stored in the same database as the
+	notification. A job move through pending -> in_flight -> delivered,
+	a failed attempt move it to failed until it is retried and a job
+	that used up MaxAttempts move to dead and copied to dead_letters.
+
+	An in_flight job that is not finished within VisibilityTimeout become
+	claimable again, so a worker that crash does not lose the job
+*/
+type Queue struct {
+	DB dba.ITransactionSQL
+	VisibilityTimeout time.Duration
+	MaxAttempts int
+	BatchSize int
+	PollInterval time.Duration
+	BaseDelay time.Duration
+	MaxDelay time.Duration
+	handlers map[string]Handler
+	now func() time.Time
+}
+
+func NewQueue(db dba.ITransactionSQL) *Queue {
+	return &Queue{
+		DB: db,
+		VisibilityTimeout: DEFAULT_VISIBILITY_TIMEOUT,
+		MaxAttempts: DEFAULT_MAX_ATTEMPTS,
+		BatchSize: DEFAULT_BATCH_SIZE,
+		PollInterval: DEFAULT_POLL_INTERVAL,
+		BaseDelay: DEFAULT_BASE_DELAY,
+		MaxDelay: DEFAULT_MAX_DELAY,
+		handlers: make(map[string]Handler),
+		now: time.Now,
+	}
+}
+
+func (q *Queue) Register(channel string, handler Handler) {
+	q.handlers[channel] = handler
+}
+
+// Pending job that is available right away
+func NewJob(channel string, subscriberId, notificationId int, payload []byte) dba.DeliveryJob {
+	now := time.Now().Unix()
+	return dba.DeliveryJob{
+		Channel: channel,
+		SubscriberId: subscriberId,
+		NotificationId: notificationId,
+		Payload: string(payload),
+		State: dba.JOB_STATE_PENDING,
+		AvailableAt: now,
+		CreatedAt: now,
+	}
+}
+
+/**
+	Enqueue take a transaction so the job is written together with
+	the notification it deliver, either both exist or none
+*/
+func Enqueue(tx dba.ITransaction, channel string, subscriberId, notificationId int, payload []byte) (int64, error) {
+	job := NewJob(channel, subscriberId, notificationId, payload)
+	return job.Insert(tx)
+}
+
+/**
+	Exponential backoff with full jitter. Attempt start from 1,
+	the delay is random between 0 and min(maxDelay, baseDelay * 2^(attempt-1))
+*/
+func Backoff(attempt int, baseDelay, maxDelay time.Duration) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	ceiling := maxDelay
+	if attempt < 32 {
+		if exponential := baseDelay << uint(attempt-1); exponential > 0 && exponential < maxDelay {
+			ceiling = exponential
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(mrand.Int63n(int64(ceiling) + 1))
+}
+
+func generateClaimToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+func claimableQuery(now int64) *dba.QueryBuilder {
+	return dba.NewQueryBuilder().
+		Group(func(g *dba.QueryBuilder) {
+			g.In("state", dba.JOB_STATE_PENDING, dba.JOB_STATE_FAILED).
+				Where("available_at", "<=", now)
+		}).
+		Or().
+		Group(func(g *dba.QueryBuilder) {
+			g.Where("state", "=", dba.JOB_STATE_IN_FLIGHT).
+				Where("locked_until", "<=", now)
+		})
+}
+
+/**
+	Claim mark up to BatchSize claimable job as in_flight. Every candidate is
+	claimed with a conditional update so two worker never get the same job
+*/
+func (q *Queue) Claim() (dba.DeliveryJobs, error) {
+	now := q.now()
+	candidates := dba.DeliveryJobs{}
+	qb := claimableQuery(now.Unix()).
+		Select("id").
+		OrderBy("id", dba.ORDER_ASC).
+		Limit(q.BatchSize)
+	err := candidates.Get(q.DB, qb)
+	if err == sql.ErrNoRows {
+		return dba.DeliveryJobs{}, nil
+	}
+	if err != nil {
+		return dba.DeliveryJobs{}, err
+	}
+	claimToken, err := generateClaimToken()
+	if err != nil {
+		return dba.DeliveryJobs{}, err
+	}
+	lockedUntil := now.Add(q.VisibilityTimeout).Unix()
+	for _, candidate := range candidates {
+		candidate.LockedUntil = lockedUntil
+		candidate.ClaimToken = claimToken
+		if _, err := candidate.Claim(q.DB, now.Unix()); err != nil {
+			return dba.DeliveryJobs{}, err
+		}
+	}
+	claimed := dba.DeliveryJobs{}
+	qb = dba.NewQueryBuilder().
+		Where("claim_token", "=", claimToken).
+		Where("state", "=", dba.JOB_STATE_IN_FLIGHT)
+	err = claimed.Get(q.DB, qb)
+	if err == sql.ErrNoRows {
+		return dba.DeliveryJobs{}, nil
+	}
+	return claimed, err
+}
+
+func (q *Queue) markDelivered(job dba.DeliveryJob) error {
+	job.State = dba.JOB_STATE_DELIVERED
+	job.LastError = ""
+	_, err := job.Update(q.DB, []string{"state", "last_error"})
+	return err
+}
+
+/**
+	A failed job is scheduled again after backoff. When it already used
+	MaxAttempts it become dead and a snapshot is kept in dead_letters
+*/
+func (q *Queue) markFailed(job dba.DeliveryJob, failure error) error {
+	now := q.now()
+	job.LastError = failure.Error()
+	if job.Attempts < q.MaxAttempts {
+		job.State = dba.JOB_STATE_FAILED
+		job.AvailableAt = now.Add(Backoff(job.Attempts, q.BaseDelay, q.MaxDelay)).Unix()
+		_, err := job.Update(q.DB, []string{"state", "last_error", "available_at"})
+		return err
+	}
+	return dba.CreateSQLTransaction(q.DB, func(tx *sql.Tx) error {
+		job.State = dba.JOB_STATE_DEAD
+		if _, err := job.Update(tx, []string{"state", "last_error"}); err != nil {
+			return err
+		}
+		_, err := dba.NewDeadLetter(job, now.Unix()).Insert(tx)
+		return err
+	})
+}
+
+func (q *Queue) handle(job dba.DeliveryJob) error {
+	handler, ok := q.handlers[job.Channel]
+	if !ok {
+		return q.markFailed(job, ErrUnknownChannel)
+	}
+	if err := handler(job); err != nil {
+		return q.markFailed(job, err)
+	}
+	return q.markDelivered(job)
+}
+
+// Claim and handle one batch, return how many job was claimed
+func (q *Queue) Process() (int, error) {
+	jobs, err := q.Claim()
+	if err != nil {
+		return 0, err
+	}
+	for _, job := range jobs {
+		if err := q.handle(job); err != nil {
+			log.Println("QUEUE JOB NOT UPDATED", job.Id, err)
+		}
+	}
+	return len(jobs), nil
+}
+
+/**
+	Run keep processing until stop is closed. A full batch is followed
+	immediately by the next one, otherwise it wait for PollInterval
+*/
+func (q *Queue) Run(stop <-chan struct{}) {
+	for {
+		processed, err := q.Process()
+		if err != nil {
+			log.Println("QUEUE PROCESS FAILED", err)
+		}
+		if processed == q.BatchSize && err == nil {
+			select {
+			case <-stop:
+				return
+			default:
+				continue
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(q.PollInterval):
+		}
+	}
+}
+
+func (q *Queue) DeadLetters(limit, offset int) (dba.DeadLetters, error) {
+	deadLetters := dba.DeadLetters{}
+	qb := dba.NewQueryBuilder().
+		OrderBy("id", dba.ORDER_DESC).
+		Limit(limit).
+		Offset(offset)
+	err := deadLetters.Get(q.DB, qb)
+	if err == sql.ErrNoRows {
+		return dba.DeadLetters{}, nil
+	}
+	return deadLetters, err
+}
+
+/**
+	Requeue put the job of a dead letter back to pending with a fresh
+	attempt count and remove the dead letter
+*/
+func (q *Queue) Requeue(deadLetterId int) error {
+	deadLetters := dba.DeadLetters{}
+	qb := dba.NewQueryBuilder().Where("id", "=", deadLetterId)
+	if err := deadLetters.Get(q.DB, qb); err != nil {
+		return err
+	}
+	deadLetter := deadLetters[0]
+	return dba.CreateSQLTransaction(q.DB, func(tx *sql.Tx) error {
+		job := dba.DeliveryJob{
+			Id: deadLetter.JobId,
+			State: dba.JOB_STATE_PENDING,
+			Attempts: 0,
+			AvailableAt: q.now().Unix(),
+			LockedUntil: 0,
+			ClaimToken: "",
+		}
+		updateables := []string{"state", "attempts", "available_at", "locked_until", "claim_token"}
+		if _, err := job.Update(tx, updateables); err != nil {
+			return err
+		}
+		_, err := deadLetter.Delete(tx)
+		return err
+	})
+}
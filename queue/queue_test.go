@@ -0,0 +1,204 @@
+package queue
+
+import (
+	"testing"
+	"errors"
+	"path/filepath"
+	"time"
+
+	dba "github.com/humamfauzi/go-notification/database"
+)
+
+func TestBackoff(t *testing.T) {
+	base := 100 * time.Millisecond
+	max := time.Second
+	for attempt := 1; attempt < 40; attempt++ {
+		ceiling := max
+		if attempt < 5 {
+			ceiling = base << uint(attempt-1)
+		}
+		delay := Backoff(attempt, base, max)
+		if delay < 0 || delay > ceiling {
+			t.Fatalf("attempt %d want between 0 and %v get %v", attempt, ceiling, delay)
+		}
+	}
+}
+
+func TestGenerateClaimToken(t *testing.T) {
+	first, err := generateClaimToken()
+	if err != nil {
+		t.Fatalf("cannot generate claim token %v", err)
+	}
+	second, _ := generateClaimToken()
+	if first == second {
+		t.Fatalf("claim token should be random")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	q := NewQueue(nil)
+	q.Register("webhook", func(job dba.DeliveryJob) error {
+		return errors.New("should not be called")
+	})
+	if _, ok := q.handlers["email"]; ok {
+		t.Fatalf("email channel should not be registered")
+	}
+	if _, ok := q.handlers["webhook"]; !ok {
+		t.Fatalf("webhook channel should be registered")
+	}
+}
+
+func TestClaimableQuery(t *testing.T) {
+	_, clause, args, err := claimableQuery(100).Build(&dba.DeliveryJob{})
+	if err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	want := "WHERE (state IN (?,?) AND available_at <= ?) OR (state = ? AND locked_until <= ?)"
+	if clause != want {
+		t.Fatalf("want %v get %v", want, clause)
+	}
+	if len(args) != 5 {
+		t.Fatalf("want 5 get %v", len(args))
+	}
+}
+
+// Queue on a migrated in-memory SQLite with one pending job, now is the returned clock
+func sqliteQueue(t *testing.T) (*Queue, *time.Time) {
+	base := filepath.Join("..", "database")
+	if err := dba.ConvertJsonToQueryMap(filepath.Join(base, dba.SQLITE_QUERY_MAP)); err != nil {
+		t.Fatalf("Failed to read query map %v", err)
+	}
+	memoryDB, err := dba.SqliteDatabaseAccess{}.ConnectDatabase()
+	if err != nil {
+		t.Fatalf("Cannot Connect to DB %v", err)
+	}
+	t.Cleanup(func() { memoryDB.Close() })
+	migrator, err := dba.NewMigrator(memoryDB, dba.MigrationDirectory(base))
+	if err != nil {
+		t.Fatalf("Failed to load migration %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Failed to migrate %v", err)
+	}
+	store := dba.NewSQLStore(memoryDB)
+	user := dba.UserProfile{Id: "user/queue", Email: "queue@example.com"}
+	if err := store.InsertUser(user); err != nil {
+		t.Fatalf("Failed to insert user %v", err)
+	}
+	topicId, err := store.InsertTopic(dba.Topic{UserId: user.Id, Title: "queue"})
+	if err != nil {
+		t.Fatalf("Failed to insert topic %v", err)
+	}
+	subscriberId, err := store.InsertSubscriber(dba.Subscriber{TopicId: int(topicId), UserId: user.Id, UnsubscribeToken: "queue"})
+	if err != nil {
+		t.Fatalf("Failed to insert subscriber %v", err)
+	}
+	withJob := func(notification dba.Notification) (*dba.DeliveryJob, error) {
+		job := NewJob("webhook", int(subscriberId), notification.Id, []byte("{}"))
+		return &job, nil
+	}
+	notifications := dba.Notifications{dba.Notification{UserId: user.Id, TopicId: int(topicId), Message: "queued"}}
+	if err := store.InsertNotifications(notifications, withJob); err != nil {
+		t.Fatalf("Failed to insert notification %v", err)
+	}
+	now := time.Now()
+	q := NewQueue(memoryDB)
+	q.now = func() time.Time { return now }
+	return q, &now
+}
+
+func storedJob(t *testing.T, q *Queue, id int) dba.DeliveryJob {
+	jobs := dba.DeliveryJobs{}
+	if err := jobs.Get(q.DB, dba.NewQueryBuilder().Where("id", "=", id)); err != nil {
+		t.Fatalf("Failed to get job %v", err)
+	}
+	return jobs[0]
+}
+
+func TestJobLifecycle(t *testing.T) {
+	q, now := sqliteQueue(t)
+	q.MaxAttempts = 2
+	q.BaseDelay = time.Minute
+	q.MaxDelay = time.Minute
+
+	claimed, err := q.Claim()
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("want 1 job get %v %v", claimed, err)
+	}
+	job := claimed[0]
+	if job.State != dba.JOB_STATE_IN_FLIGHT || job.Attempts != 1 || job.LockedUntil != now.Add(q.VisibilityTimeout).Unix() {
+		t.Fatalf("want in flight job get %v", job)
+	}
+	if claimed, err := q.Claim(); err != nil || len(claimed) != 0 {
+		t.Fatalf("in flight job should not be claimed again get %v %v", claimed, err)
+	}
+
+	// first failure is retried after backoff
+	if err := q.markFailed(job, errors.New("unreachable")); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	job = storedJob(t, q, job.Id)
+	if job.State != dba.JOB_STATE_FAILED || job.LastError != "unreachable" || job.AvailableAt < now.Unix() || job.AvailableAt > now.Add(q.BaseDelay).Unix() {
+		t.Fatalf("want failed job available within backoff get %v", job)
+	}
+	*now = now.Add(q.BaseDelay + time.Second)
+	claimed, err = q.Claim()
+	if err != nil || len(claimed) != 1 || claimed[0].Attempts != 2 {
+		t.Fatalf("want retried job get %v %v", claimed, err)
+	}
+
+	// last attempt move the job to dead letters
+	if err := q.markFailed(claimed[0], errors.New("still unreachable")); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if job = storedJob(t, q, job.Id); job.State != dba.JOB_STATE_DEAD {
+		t.Fatalf("want dead job get %v", job)
+	}
+	deadLetters, err := q.DeadLetters(10, 0)
+	if err != nil || len(deadLetters) != 1 || deadLetters[0].JobId != job.Id || deadLetters[0].Attempts != 2 || deadLetters[0].LastError != "still unreachable" {
+		t.Fatalf("want one dead letter of the job get %v %v", deadLetters, err)
+	}
+	*now = now.Add(q.MaxDelay)
+	if claimed, err := q.Claim(); err != nil || len(claimed) != 0 {
+		t.Fatalf("dead job should not be claimed get %v %v", claimed, err)
+	}
+
+	// requeue start over with a fresh attempt count
+	if err := q.Requeue(deadLetters[0].Id); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if deadLetters, err := q.DeadLetters(10, 0); err != nil || len(deadLetters) != 0 {
+		t.Fatalf("want no dead letter get %v %v", deadLetters, err)
+	}
+	if job = storedJob(t, q, job.Id); job.State != dba.JOB_STATE_PENDING || job.Attempts != 0 || len(job.ClaimToken) != 0 {
+		t.Fatalf("want pending job get %v", job)
+	}
+	claimed, err = q.Claim()
+	if err != nil || len(claimed) != 1 || claimed[0].Attempts != 1 {
+		t.Fatalf("want requeued job claimed get %v %v", claimed, err)
+	}
+}
+
+func TestReclaimAfterVisibilityTimeout(t *testing.T) {
+	q, now := sqliteQueue(t)
+	first, err := q.Claim()
+	if err != nil || len(first) != 1 {
+		t.Fatalf("want 1 job get %v %v", first, err)
+	}
+	// the worker holding the job never report back
+	*now = now.Add(q.VisibilityTimeout - time.Second)
+	if claimed, err := q.Claim(); err != nil || len(claimed) != 0 {
+		t.Fatalf("job should stay locked get %v %v", claimed, err)
+	}
+	*now = now.Add(time.Second)
+	second, err := q.Claim()
+	if err != nil || len(second) != 1 {
+		t.Fatalf("want reclaimed job get %v %v", second, err)
+	}
+	if second[0].Id != first[0].Id || second[0].Attempts != 2 || second[0].ClaimToken == first[0].ClaimToken {
+		t.Fatalf("want same job with a new claim get %v after %v", second[0], first[0])
+	}
+	if second[0].LockedUntil != now.Add(q.VisibilityTimeout).Unix() {
+		t.Fatalf("want locked until %v get %v", now.Add(q.VisibilityTimeout).Unix(), second[0].LockedUntil)
+	}
+}
@@ -13,7 +13,7 @@ type UserDetail struct {
 	FirstName   string `json:"first_name"`
 	LastName    string `json:"last_name"`
 	PhoneNumber string `json:"phone_number"`
-	Email       string `json:"email`
+	Email       string `json:"email"`
 }
 
 type UserCredential struct {
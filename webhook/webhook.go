@@ -0,0 +1,206 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	SIGNATURE_HEADER = "X-Notification-Signature"
+	TIMESTAMP_HEADER = "X-Notification-Timestamp"
+	SIGNATURE_PREFIX = "sha256="
+
+	DEFAULT_TIMEOUT = 10 * time.Second
+)
+
+var (
+	ErrUnexpectedStatus = errors.New("WEBHOOK RETURN NON 2XX STATUS")
+	ErrPrivateAddress = errors.New("WEBHOOK ADDRESS IS NOT PUBLIC")
+)
+
+/**
+	Network inside the one the server run in. Callback is never sent
+	there, including the cloud metadata address 169.254.169.254
+*/
+var privateNetworks = parseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// IPv4 mapped IPv6 is checked as IPv4
+func PublicAddress(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsMulticast() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Dialer control, address is already resolved here so it is what is connected to
+func publicOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !PublicAddress(ip) {
+		return fmt.Errorf("%w %v", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// Generate a random hex secret used to sign payload of a single subscription
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+/**
+	Signature is HMAC-SHA256 of "<timestamp>.<payload>" using the subscription
+	secret. Including the timestamp let the receiver reject replayed request
+*/
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return SIGNATURE_PREFIX + hex.EncodeToString(mac.Sum(nil))
+}
+
+func Verify(secret string, timestamp int64, payload []byte, signature string) bool {
+	expected := Sign(secret, timestamp, payload)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+type Delivery struct {
+	Url string
+	Secret string
+	Payload []byte
+}
+
+type Attempt struct {
+	StatusCode int
+	Err error
+	Duration time.Duration
+}
+
+func (a Attempt) Success() bool {
+	return a.Err == nil
+}
+
+type Sender struct {
+	Client *http.Client
+	LookupIPAddr func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+/**
+	Client only connect to public address, checked on every connection
+	including redirect, so a host that resolve somewhere else after it
+	is registered is still refused. Proxy is not used since the address
+	checked would be the proxy instead of the callback
+*/
+func NewSender() *Sender {
+	dialer := &net.Dialer{
+		Timeout: DEFAULT_TIMEOUT,
+		Control: publicOnly,
+	}
+	transport := &http.Transport{
+		DialContext: dialer.DialContext,
+		TLSHandshakeTimeout: DEFAULT_TIMEOUT,
+	}
+	return &Sender{
+		Client: &http.Client{Timeout: DEFAULT_TIMEOUT, Transport: transport},
+		LookupIPAddr: net.DefaultResolver.LookupIPAddr,
+	}
+}
+
+// Checked when the callback is registered, every address of the host need to be public
+func (s *Sender) CheckHost(host string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DEFAULT_TIMEOUT)
+	defer cancel()
+	addrs, err := s.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !PublicAddress(addr.IP) {
+			return fmt.Errorf("%w %v", ErrPrivateAddress, addr.IP)
+		}
+	}
+	return nil
+}
+
+/**
+	A single signed POST, any non 2xx response is considered failed.
+	Retry is left to the caller, usually the delivery queue
+*/
+func (s *Sender) Post(delivery Delivery) Attempt {
+	started := time.Now()
+	attempt := Attempt{}
+	timestamp := started.Unix()
+	req, err := http.NewRequest(http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Err = err
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TIMESTAMP_HEADER, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SIGNATURE_HEADER, Sign(delivery.Secret, timestamp, delivery.Payload))
+	resp, err := s.Client.Do(req)
+	attempt.Duration = time.Since(started)
+	if err != nil {
+		attempt.Err = err
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Err = fmt.Errorf("%w %d", ErrUnexpectedStatus, resp.StatusCode)
+	}
+	return attempt
+}
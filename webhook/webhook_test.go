@@ -0,0 +1,136 @@
+package webhook
+
+import (
+	"testing"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	payload := []byte(`{"id":1}`)
+	signature := Sign("secret", 1000, payload)
+	if !Verify("secret", 1000, payload, signature) {
+		t.Fatalf("signature should be valid")
+	}
+	if Verify("other secret", 1000, payload, signature) {
+		t.Fatalf("signature with other secret should be invalid")
+	}
+	if Verify("secret", 1001, payload, signature) {
+		t.Fatalf("signature with other timestamp should be invalid")
+	}
+	if Verify("secret", 1000, []byte(`{"id":2}`), signature) {
+		t.Fatalf("signature with other payload should be invalid")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	first, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("cannot generate secret %v", err)
+	}
+	second, _ := GenerateSecret()
+	if len(first) != 64 {
+		t.Fatalf("want 64 get %v", len(first))
+	}
+	if first == second {
+		t.Fatalf("secret should be random")
+	}
+}
+
+// Test server listen on loopback which the default sender refuse
+func localSender(server *httptest.Server) *Sender {
+	return &Sender{Client: server.Client()}
+}
+
+func TestPostSignedPayload(t *testing.T) {
+	payload := []byte(`{"message":"hello"}`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(TIMESTAMP_HEADER), 10, 64)
+		if !Verify("secret", timestamp, body, r.Header.Get(SIGNATURE_HEADER)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	attempt := localSender(server).Post(Delivery{
+		Url: server.URL,
+		Secret: "secret",
+		Payload: payload,
+	})
+	if !attempt.Success() {
+		t.Fatalf("should deliver %v", attempt.Err)
+	}
+	if attempt.StatusCode != http.StatusOK {
+		t.Fatalf("want %v get %v", http.StatusOK, attempt.StatusCode)
+	}
+}
+
+func TestPostNon2xx(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	attempt := localSender(server).Post(Delivery{Url: server.URL, Secret: "secret"})
+	if attempt.Success() {
+		t.Fatalf("non 2xx response should fail")
+	}
+	if attempt.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("want %v get %v", http.StatusServiceUnavailable, attempt.StatusCode)
+	}
+	if !errors.Is(attempt.Err, ErrUnexpectedStatus) {
+		t.Fatalf("want %v get %v", ErrUnexpectedStatus, attempt.Err)
+	}
+
+	attempt = NewSender().Post(Delivery{Url: "http://127.0.0.1:0", Secret: "secret"})
+	if attempt.Success() {
+		t.Fatalf("unreachable callback should fail")
+	}
+}
+
+func TestPrivateAddress(t *testing.T) {
+	private := []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "0.0.0.0", "::1", "fe80::1", "fd00::1", "::ffff:127.0.0.1"}
+	for _, address := range private {
+		if PublicAddress(net.ParseIP(address)) {
+			t.Fatalf("%v should not be public", address)
+		}
+	}
+	for _, address := range []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"} {
+		if !PublicAddress(net.ParseIP(address)) {
+			t.Fatalf("%v should be public", address)
+		}
+	}
+
+	// host resolving to any private address is refused on registration
+	sender := NewSender()
+	sender.LookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		if host == "internal.example.com" {
+			return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}, {IP: net.ParseIP("10.0.0.5")}}, nil
+		}
+		return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}}, nil
+	}
+	if err := sender.CheckHost("hook.example.com"); err != nil {
+		t.Fatalf("want nil get %v", err)
+	}
+	if err := sender.CheckHost("internal.example.com"); !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("want %v get %v", ErrPrivateAddress, err)
+	}
+
+	// and on sending, whatever it resolved to when registered
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	attempt := sender.Post(Delivery{Url: server.URL, Secret: "secret"})
+	if !errors.Is(attempt.Err, ErrPrivateAddress) {
+		t.Fatalf("want %v get %v", ErrPrivateAddress, attempt.Err)
+	}
+}